@@ -5,6 +5,7 @@ import (
 	"image"
 	"image/color"
 	"image/draw"
+	"strings"
 )
 
 type TextAlign int
@@ -85,6 +86,152 @@ func ParserTextBaseline(x string) TextBaseline {
 	return AlignAlphabetic
 }
 
+// WritingMode is the direction of text, like the CSS writing-mode property.
+// In vertical modes glyphs advance downward, CJK characters are set upright
+// and other text is rotated clockwise. The x coordinate given to FillText
+// is then on the vertical baseline selected by TextBaseline: the right edge
+// of the line for top and hanging, its center for middle, its left edge for
+// bottom and ideographic, and the alphabetic baseline of rotated text for
+// alphabetic.
+type WritingMode int
+
+const (
+	HorizontalTB WritingMode = iota
+	VerticalRL
+	VerticalLR
+)
+
+func (m WritingMode) String() string {
+	switch m {
+	case HorizontalTB:
+		return "horizontal-tb"
+	case VerticalRL:
+		return "vertical-rl"
+	case VerticalLR:
+		return "vertical-lr"
+	}
+	return ""
+}
+
+func ParserWritingMode(x string) WritingMode {
+	switch x {
+	case "vertical-rl":
+		return VerticalRL
+	case "vertical-lr":
+		return VerticalLR
+	}
+	return HorizontalTB
+}
+
+// IsVertical reports whether m is a vertical writing mode.
+func (m WritingMode) IsVertical() bool {
+	return m == VerticalRL || m == VerticalLR
+}
+
+// Antialias is how the edges of fills, strokes, clips and text are
+// sampled. AntialiasNone covers a pixel entirely or not at all, by whether
+// its center is inside, or on a left or top edge, for crisp edges.
+// AntialiasHigh computes the coverage on a grid of 4x4 samples per pixel,
+// which renders thin lines more accurately.
+type Antialias int
+
+const (
+	AntialiasDefault Antialias = iota
+	AntialiasNone
+	AntialiasHigh
+)
+
+func (a Antialias) String() string {
+	switch a {
+	case AntialiasDefault:
+		return "default"
+	case AntialiasNone:
+		return "none"
+	case AntialiasHigh:
+		return "high"
+	}
+	return ""
+}
+
+func ParserAntialias(x string) Antialias {
+	switch x {
+	case "none":
+		return AntialiasNone
+	case "high":
+		return AntialiasHigh
+	}
+	return AntialiasDefault
+}
+
+// TextPathSide is the side of a path text is set on, like the SVG textPath
+// side attribute. On the right side the path is followed backwards.
+type TextPathSide int
+
+const (
+	TextPathLeft TextPathSide = iota
+	TextPathRight
+)
+
+// TextDecorationLine is a set of text decoration lines.
+type TextDecorationLine int
+
+const (
+	DecorationUnderline TextDecorationLine = 1 << iota
+	DecorationOverline
+	DecorationLineThrough
+	DecorationNone TextDecorationLine = 0
+)
+
+func (l TextDecorationLine) String() string {
+	if l == DecorationNone {
+		return "none"
+	}
+	var ar []string
+	if l&DecorationUnderline != 0 {
+		ar = append(ar, "underline")
+	}
+	if l&DecorationOverline != 0 {
+		ar = append(ar, "overline")
+	}
+	if l&DecorationLineThrough != 0 {
+		ar = append(ar, "line-through")
+	}
+	return strings.Join(ar, " ")
+}
+
+type TextDecorationStyle int
+
+const (
+	DecorationSolid TextDecorationStyle = iota
+	DecorationDouble
+	DecorationDashed
+	DecorationWavy
+)
+
+func (s TextDecorationStyle) String() string {
+	switch s {
+	case DecorationSolid:
+		return "solid"
+	case DecorationDouble:
+		return "double"
+	case DecorationDashed:
+		return "dashed"
+	case DecorationWavy:
+		return "wavy"
+	}
+	return ""
+}
+
+// TextDecoration describes the lines drawn with FillText and StrokeText,
+// like the CSS text-decoration property.
+type TextDecoration struct {
+	Line      TextDecorationLine
+	Style     TextDecorationStyle
+	Thickness float64     // 0 uses the thickness of the font metrics
+	Color     color.Color // nil uses the style of the text
+	SkipInk   bool        // interrupt underlines and overlines where they cross glyphs
+}
+
 type LineCap int
 
 const (
@@ -511,11 +658,23 @@ type Context2D interface {
 	TextAlign() TextAlign
 	SetTextBaseline(base TextBaseline)
 	TextBaseline() TextBaseline
+	SetTextDecoration(d TextDecoration)
+	TextDecoration() TextDecoration
+	SetWritingMode(mode WritingMode)
+	WritingMode() WritingMode
+	SetAntialias(a Antialias)
+	Antialias() Antialias
 
 	// text (see also the CanvasDrawingStyles interface)
 	FillText(text string, x float64, y float64)
 	StrokeText(text string, x float64, y float64)
+	FillTextOnPath(text string, path *Path, offset float64, side TextPathSide)
+	StrokeTextOnPath(text string, path *Path, offset float64, side TextPathSide)
+	FillGlyphs(run *GlyphRun, x, y float64)
+	StrokeGlyphs(run *GlyphRun, x, y float64)
 	MeasureText(text string) float64
+	// FontMetrics returns the metrics of the current font, nil if unknown
+	FontMetrics() *FontMetrics
 
 	// drawing images
 	DrawImage(img image.Image, dx float64, dy float64)
@@ -0,0 +1,319 @@
+package canvas
+
+import (
+	"image"
+	"math"
+	"sort"
+
+	"github.com/golang/freetype/raster"
+	"golang.org/x/image/math/fixed"
+)
+
+// superSamples is the number of samples per pixel in each direction of
+// AntialiasHigh.
+const superSamples = 4
+
+// rasterBounds returns the size of the rasterizers of the context, which
+// grows by the offset of the shadow.
+func (gc *GraphicContext2D) rasterBounds() (width, height int) {
+	width, height = gc.width, gc.height
+	if gc.HasShadow() {
+		width += int(math.Abs(gc.Current.ShadowOffsetX))
+		height += int(math.Abs(gc.Current.ShadowOffsetY))
+	}
+	return
+}
+
+// rasterize paints with painter the paths added to r, or recorded in lines
+// when they are rasterized in bands, supersampled or sampled at the centers
+// of the pixels, with the antialiasing of the context.
+func (gc *GraphicContext2D) rasterize(r *raster.Rasterizer, lines *lineRecorder, painter raster.Painter) {
+	_, bands := painter.(bandPainter)
+	switch {
+	case gc.Current.Antialias == AntialiasHigh:
+		gc.supersample(r, lines, painter)
+	case lines == nil:
+		r.Rasterize(painter)
+		r.Clear()
+	case bands && gc.parallel():
+		gc.rasterizeBands(r, lines, painter)
+	default:
+		width, height := gc.rasterBounds()
+		newCenterSampler(lines, r.UseNonZeroWinding).paint(painter, 0, height, width, r.Dx, r.Dy)
+	}
+}
+
+// supersample rasterizes the recorded segments with the settings of r on a
+// grid superSamples times finer, and paints the averaged samples with
+// painter.
+func (gc *GraphicContext2D) supersample(r *raster.Rasterizer, lines *lineRecorder, painter raster.Painter) {
+	width, height := gc.rasterBounds()
+	size := image.Pt(width*superSamples, height*superSamples)
+	if gc.super == nil {
+		gc.super = &superRasterizer{raster.NewRasterizer(size.X, size.Y), size}
+	} else if gc.super.size != size {
+		gc.super.SetBounds(size.X, size.Y)
+		gc.super.size = size
+	}
+	sr := gc.super.Rasterizer
+	sr.UseNonZeroWinding = r.UseNonZeroWinding
+	lines.replay(scaledAdder{sr}, math.MinInt32, math.MaxInt32)
+	sr.Rasterize(&superPainter{
+		painter: painter,
+		dx:      r.Dx,
+		dy:      r.Dy,
+		y:       -1,
+		cover:   make([]uint32, width),
+		x0:      width,
+	})
+	sr.Clear()
+}
+
+// superRasterizer is the rasterizer of AntialiasHigh, kept with its bounds
+// as setting them allocates.
+type superRasterizer struct {
+	*raster.Rasterizer
+	size image.Point
+}
+
+// scaledAdder adds segments superSamples times larger to a rasterizer.
+type scaledAdder struct {
+	raster.Adder
+}
+
+func superPoint(p fixed.Point26_6) fixed.Point26_6 {
+	return fixed.Point26_6{X: p.X * superSamples, Y: p.Y * superSamples}
+}
+
+func (a scaledAdder) Start(p fixed.Point26_6) {
+	a.Adder.Start(superPoint(p))
+}
+
+func (a scaledAdder) Add1(b fixed.Point26_6) {
+	a.Adder.Add1(superPoint(b))
+}
+
+func (a scaledAdder) Add2(b, c fixed.Point26_6) {
+	a.Adder.Add2(superPoint(b), superPoint(c))
+}
+
+func (a scaledAdder) Add3(b, c, d fixed.Point26_6) {
+	a.Adder.Add3(superPoint(b), superPoint(c), superPoint(d))
+}
+
+// superPainter sums the spans of a supersampled rasterizer into the
+// coverage of the pixels, row by row, and paints them moved by dx, dy.
+type superPainter struct {
+	painter raster.Painter
+	dx, dy  int
+	y       int      // the pixel row summed
+	cover   []uint32 // the sums of the samples of the row
+	x0, x1  int      // the pixels of cover that are not 0
+	spans   []raster.Span
+}
+
+func (p *superPainter) Paint(ss []raster.Span, done bool) {
+	for _, s := range ss {
+		if y := s.Y / superSamples; y != p.y {
+			p.flush()
+			p.y = y
+		}
+		x := s.X0
+		if px := x / superSamples; px < p.x0 {
+			p.x0 = px
+		}
+		for x < s.X1 {
+			px := x / superSamples
+			end := (px + 1) * superSamples
+			if end > s.X1 {
+				end = s.X1
+			}
+			p.cover[px] += s.Alpha * uint32(end-x)
+			x = end
+		}
+		if px := (s.X1 - 1) / superSamples; px >= p.x1 {
+			p.x1 = px + 1
+		}
+	}
+	if done {
+		p.flush()
+	}
+	if len(p.spans) > 0 || done {
+		p.painter.Paint(p.spans, done)
+		p.spans = p.spans[:0]
+	}
+}
+
+// flush adds the spans of the row summed, runs of pixels of the same
+// coverage, and clears its sums.
+func (p *superPainter) flush() {
+	for x := p.x0; x < p.x1; {
+		c := p.cover[x]
+		end := x + 1
+		for end < p.x1 && p.cover[end] == c {
+			end++
+		}
+		if c != 0 {
+			p.spans = append(p.spans, raster.Span{
+				Y:     p.y + p.dy,
+				X0:    x + p.dx,
+				X1:    end + p.dx,
+				Alpha: c / (superSamples * superSamples),
+			})
+		}
+		for i := x; i < end; i++ {
+			p.cover[i] = 0
+		}
+		x = end
+	}
+	p.x0, p.x1 = len(p.cover), 0
+}
+
+// centerEdge is an edge of the paths sampled by a centerSampler, from its
+// top to its bottom.
+type centerEdge struct {
+	x0, y0, x1, y1 float64
+	dir            int // of the winding, 1 when the edge goes down
+	row0, row1     int // rows whose centers the edge crosses
+}
+
+// centerSampler paints the pixels whose center is inside the paths entirely
+// and leaves the others, the crisp edges of AntialiasNone. A center on an
+// edge is inside when the edge is a left or a top edge, so paths sharing an
+// edge paint each pixel once.
+type centerSampler struct {
+	edges   []centerEdge // sorted by row0
+	nonZero bool
+}
+
+// curveSteps is the number of lines a curve added to a lineRecorder is
+// sampled as, the flatteners of the context only add lines.
+const curveSteps = 16
+
+// newCenterSampler returns a sampler of the recorded segments, with every
+// path closed, filled with the nonzero winding rule or else the even-odd
+// rule.
+func newCenterSampler(lines *lineRecorder, nonZero bool) *centerSampler {
+	s := &centerSampler{nonZero: nonZero}
+	var start, last [2]float64
+	for _, seg := range lines.segs {
+		pts := [4][2]float64{point(seg.a), point(seg.b), point(seg.c), point(seg.d)}
+		switch seg.n {
+		case 0:
+			s.addEdge(last, start)
+			start, last = pts[0], pts[0]
+		case 1:
+			s.addEdge(last, pts[1])
+			last = pts[1]
+		default:
+			for i := 1; i <= curveSteps; i++ {
+				p := bezierPoint(pts[:seg.n+1], float64(i)/curveSteps)
+				s.addEdge(last, p)
+				last = p
+			}
+		}
+	}
+	s.addEdge(last, start)
+	sort.SliceStable(s.edges, func(i, j int) bool { return s.edges[i].row0 < s.edges[j].row0 })
+	return s
+}
+
+func point(p fixed.Point26_6) [2]float64 {
+	return [2]float64{float64(p.X) / 64, float64(p.Y) / 64}
+}
+
+// bezierPoint returns the point at t of the Bézier curve of pts.
+func bezierPoint(pts [][2]float64, t float64) [2]float64 {
+	var q [4][2]float64
+	n := copy(q[:], pts)
+	for ; n > 1; n-- {
+		for i := 0; i < n-1; i++ {
+			q[i][0] += (q[i+1][0] - q[i][0]) * t
+			q[i][1] += (q[i+1][1] - q[i][1]) * t
+		}
+	}
+	return q[0]
+}
+
+// addEdge adds the edge from a to b, unless it crosses no row center.
+func (s *centerSampler) addEdge(a, b [2]float64) {
+	e := centerEdge{x0: a[0], y0: a[1], x1: b[0], y1: b[1], dir: 1}
+	if e.y0 > e.y1 {
+		e.x0, e.y0, e.x1, e.y1 = e.x1, e.y1, e.x0, e.y0
+		e.dir = -1
+	}
+	// the rows y of the centers y+0.5 in [y0, y1)
+	e.row0 = int(math.Ceil(e.y0 - 0.5))
+	e.row1 = int(math.Ceil(e.y1 - 0.5))
+	if e.row0 < e.row1 {
+		s.edges = append(s.edges, e)
+	}
+}
+
+// paint paints with painter the rows [y0, y1) of a raster width pixels
+// wide, moved by dx, dy.
+func (s *centerSampler) paint(painter raster.Painter, y0, y1, width, dx, dy int) {
+	var active []*centerEdge
+	var crossings []centerCrossing
+	var spans []raster.Span
+	i := 0
+	for y := y0; y < y1; y++ {
+		for ; i < len(s.edges) && s.edges[i].row0 <= y; i++ {
+			active = append(active, &s.edges[i])
+		}
+		crossings = crossings[:0]
+		n := 0
+		for _, e := range active {
+			if e.row1 <= y {
+				continue
+			}
+			active[n] = e
+			n++
+			yc := float64(y) + 0.5
+			x := e.x0 + (yc-e.y0)*(e.x1-e.x0)/(e.y1-e.y0)
+			crossings = append(crossings, centerCrossing{x, e.dir})
+		}
+		active = active[:n]
+		sort.Slice(crossings, func(i, j int) bool { return crossings[i].x < crossings[j].x })
+
+		// the pixels x of the centers x+0.5 in [left, right)
+		winding, x0 := 0, 0
+		for _, c := range crossings {
+			inside := s.inside(winding)
+			winding += c.dir
+			if inside == s.inside(winding) {
+				continue
+			}
+			x := int(math.Ceil(c.x - 0.5))
+			if x < 0 {
+				x = 0
+			} else if x > width {
+				x = width
+			}
+			if !inside {
+				x0 = x
+			} else if x > x0 {
+				spans = append(spans, raster.Span{Y: y + dy, X0: x0 + dx, X1: x + dx, Alpha: 0xffff})
+			}
+		}
+		if len(spans) > 0 {
+			painter.Paint(spans, false)
+			spans = spans[:0]
+		}
+	}
+	painter.Paint(nil, true)
+}
+
+// centerCrossing is the crossing of an edge with the center line of a row.
+type centerCrossing struct {
+	x   float64
+	dir int
+}
+
+// inside reports whether the winding number w is inside the paths.
+func (s *centerSampler) inside(w int) bool {
+	if s.nonZero {
+		return w != 0
+	}
+	return w%2 != 0
+}
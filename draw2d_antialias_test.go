@@ -0,0 +1,81 @@
+package canvas
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// painted returns the points of the pixels of img that are not transparent.
+func painted(img image.Image) []image.Point {
+	var ps []image.Point
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0 {
+				ps = append(ps, image.Pt(x, y))
+			}
+		}
+	}
+	return ps
+}
+
+// TestAntialiasNoneLine strokes a line of width 1 along x = 10, whose edges
+// go through the centers of the columns 9 and 10: only the left edge is
+// inside.
+func TestAntialiasNoneLine(t *testing.T) {
+	for _, workers := range []int{1, 7} {
+		gc := NewGraphicContext2D(20, 80)
+		gc.SetWorkers(workers)
+		gc.SetAntialias(AntialiasNone)
+		gc.SetStrokeColor(color.Black)
+		gc.SetLineWidth(1)
+		gc.BeginPath()
+		gc.MoveTo(10, 0)
+		gc.LineTo(10, 5)
+		gc.Stroke()
+		ps := painted(gc.Image())
+		if len(ps) != 5 {
+			t.Fatalf("workers %d: painted %v, want column 9 of rows 0 to 4", workers, ps)
+		}
+		for y, p := range ps {
+			if p != image.Pt(9, y) {
+				t.Errorf("workers %d: painted %v, want %v", workers, p, image.Pt(9, y))
+			}
+		}
+	}
+}
+
+// TestAntialiasNoneCenters fills shapes that cover the centers of pixels or
+// miss them.
+func TestAntialiasNoneCenters(t *testing.T) {
+	gc := NewGraphicContext2D(20, 10)
+	gc.SetAntialias(AntialiasNone)
+	gc.SetFillColor(color.NRGBA{0, 0, 0, 0x80})
+	gc.FillRect(0.4, 0.4, 2.2, 1.2) // the centers of 3x2 pixels
+	gc.FillRect(10.6, 0, 0.3, 10)   // no center
+	gc.FillRect(3, 5, 2.5, 1)       // two rectangles sharing the
+	gc.FillRect(5.5, 5, 2, 1)       // center of pixel 5
+	img := gc.Image()
+	want := map[image.Point]bool{}
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 3; x++ {
+			want[image.Pt(x, y)] = true
+		}
+	}
+	for x := 3; x < 7; x++ {
+		want[image.Pt(x, 5)] = true
+	}
+	ps := painted(img)
+	if len(ps) != len(want) {
+		t.Errorf("painted %v, want %d pixels", ps, len(want))
+	}
+	for _, p := range ps {
+		if !want[p] {
+			t.Errorf("painted %v", p)
+		}
+		if _, _, _, a := img.At(p.X, p.Y).RGBA(); a>>8 != 0x80 {
+			t.Errorf("alpha of %v is %#x, want 0x80", p, a>>8)
+		}
+	}
+}
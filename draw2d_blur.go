@@ -0,0 +1,213 @@
+package canvas
+
+import (
+	"image"
+	"math"
+	"sync"
+)
+
+// shadowSigma returns the standard deviation of the Gaussian blur of a
+// shadow, which the canvas spec defines as half of shadowBlur.
+func shadowSigma(blur float64) float64 {
+	return blur / 2
+}
+
+// boxSize returns the size of the three box blurs that approximate a
+// Gaussian of sigma >= 2, as SVG's feGaussianBlur defines it.
+func boxSize(sigma float64) int {
+	return int(math.Floor(sigma*3*math.Sqrt(2*math.Pi)/4 + 0.5))
+}
+
+// blurExtent returns the distance in pixels a Gaussian blur of sigma
+// spreads to.
+func blurExtent(sigma float64) int {
+	switch {
+	case sigma <= 0:
+		return 0
+	case sigma < 2:
+		return int(math.Ceil(3 * sigma))
+	}
+	return 3 * boxSize(sigma) / 2
+}
+
+// gaussianKernel returns the weights of a Gaussian of sigma from -r to r.
+func gaussianKernel(sigma float64) []float64 {
+	r := blurExtent(sigma)
+	k := make([]float64, 2*r+1)
+	sum := 0.0
+	for i := range k {
+		d := float64(i - r)
+		k[i] = math.Exp(-d * d / (2 * sigma * sigma))
+		sum += k[i]
+	}
+	for i := range k {
+		k[i] /= sum
+	}
+	return k
+}
+
+// blurAlpha returns a blurred by a Gaussian of sigma, at the bounds of a.
+// Pixels outside of a are transparent.
+func blurAlpha(a *image.Alpha, sigma float64, workers int) *image.Alpha {
+	w, h := a.Rect.Dx(), a.Rect.Dy()
+	pix := make([]float32, w*h)
+	for y := 0; y < h; y++ {
+		for x, v := range a.Pix[y*a.Stride : y*a.Stride+w] {
+			pix[y*w+x] = float32(v)
+		}
+	}
+	blurPlanes(pix, w, h, 1, sigma, workers)
+	m := image.NewAlpha(a.Rect)
+	for i, v := range pix {
+		m.Pix[i] = clampUint8(v)
+	}
+	return m
+}
+
+// blurAlpha16 is blurAlpha for 16-bit alpha.
+func blurAlpha16(a *image.Alpha16, sigma float64, workers int) *image.Alpha16 {
+	w, h := a.Rect.Dx(), a.Rect.Dy()
+	pix := make([]float32, w*h)
+	for y := 0; y < h; y++ {
+		row := a.Pix[y*a.Stride:]
+		for x := 0; x < w; x++ {
+			pix[y*w+x] = float32(uint16(row[2*x])<<8 | uint16(row[2*x+1]))
+		}
+	}
+	blurPlanes(pix, w, h, 1, sigma, workers)
+	m := image.NewAlpha16(a.Rect)
+	for i, v := range pix {
+		var c uint16
+		switch {
+		case v >= 0xffff:
+			c = 0xffff
+		case v > 0:
+			c = uint16(v + 0.5)
+		}
+		m.Pix[2*i], m.Pix[2*i+1] = uint8(c>>8), uint8(c)
+	}
+	return m
+}
+
+func clampUint8(v float32) uint8 {
+	switch {
+	case v <= 0:
+		return 0
+	case v >= 0xff:
+		return 0xff
+	}
+	return uint8(v + 0.5)
+}
+
+// blurPlanes blurs the w x h pixels of ch interleaved channels of pix, the
+// rows then the columns, each pass split into bands of rows across workers.
+func blurPlanes(pix []float32, w, h, ch int, sigma float64, workers int) {
+	if sigma <= 0 || w == 0 || h == 0 {
+		return
+	}
+	tmp := make([]float32, len(pix))
+	blurLines(pix, tmp, w, h, ch, sigma, workers)
+	transposePlanes(pix, tmp, w, h, ch)
+	blurLines(tmp, pix, h, w, ch, sigma, workers)
+	transposePlanes(tmp, pix, h, w, ch)
+}
+
+// blurLines blurs the h lines of w pixels of pix, buf is scratch of the
+// same size.
+func blurLines(pix, buf []float32, w, h, ch int, sigma float64, workers int) {
+	var kernel []float64
+	if sigma < 2 {
+		kernel = gaussianKernel(sigma)
+	}
+	n := w * ch
+	parallelRows(h, workers, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			line, scratch := pix[y*n:(y+1)*n], buf[y*n:(y+1)*n]
+			if kernel != nil {
+				convolveLine(line, scratch, ch, kernel)
+				continue
+			}
+			if d := boxSize(sigma); d%2 == 1 {
+				boxLine(line, scratch, ch, d/2, d/2)
+				boxLine(line, scratch, ch, d/2, d/2)
+				boxLine(line, scratch, ch, d/2, d/2)
+			} else {
+				// two boxes centered on the left and the right edges of
+				// the pixel, and one of d+1 on its center
+				boxLine(line, scratch, ch, d/2, d/2-1)
+				boxLine(line, scratch, ch, d/2-1, d/2)
+				boxLine(line, scratch, ch, d/2, d/2)
+			}
+		}
+	})
+}
+
+// convolveLine replaces the pixels of line with their weighted sums by
+// kernel.
+func convolveLine(line, buf []float32, ch int, kernel []float64) {
+	n, r := len(line)/ch, len(kernel)/2
+	for x := 0; x < n; x++ {
+		for c := 0; c < ch; c++ {
+			sum := 0.0
+			for k, wt := range kernel {
+				if i := x + k - r; i >= 0 && i < n {
+					sum += wt * float64(line[i*ch+c])
+				}
+			}
+			buf[x*ch+c] = float32(sum)
+		}
+	}
+	copy(line, buf)
+}
+
+// boxLine replaces the pixels of line with the averages of the windows
+// from left pixels before them to right pixels after them.
+func boxLine(line, buf []float32, ch, left, right int) {
+	n, size := len(line)/ch, float64(left+right+1)
+	for c := 0; c < ch; c++ {
+		sum := 0.0
+		for i := 0; i <= right && i < n; i++ {
+			sum += float64(line[i*ch+c])
+		}
+		for x := 0; x < n; x++ {
+			buf[x*ch+c] = float32(sum / size)
+			if i := x + right + 1; i < n {
+				sum += float64(line[i*ch+c])
+			}
+			if i := x - left; i >= 0 {
+				sum -= float64(line[i*ch+c])
+			}
+		}
+	}
+	copy(line, buf)
+}
+
+// transposePlanes writes the w x h pixels of src to dst as h x w.
+func transposePlanes(src, dst []float32, w, h, ch int) {
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			copy(dst[(x*h+y)*ch:(x*h+y+1)*ch], src[(y*w+x)*ch:(y*w+x+1)*ch])
+		}
+	}
+}
+
+// parallelRows calls f with bands of the rows [0, h) on up to workers
+// goroutines.
+func parallelRows(h, workers int, f func(y0, y1 int)) {
+	if workers > h/minBandHeight {
+		workers = h / minBandHeight
+	}
+	if workers <= 1 {
+		f(0, h)
+		return
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(y0, y1 int) {
+			defer wg.Done()
+			f(y0, y1)
+		}(h*i/workers, h*(i+1)/workers)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,101 @@
+package canvas
+
+import (
+	"bytes"
+	"image"
+	"math"
+	"testing"
+)
+
+func TestBoxSize(t *testing.T) {
+	tests := []struct {
+		sigma  float64
+		box    int // floor(sigma * 3 * sqrt(2 * pi) / 4 + 0.5) of SVG
+		extent int
+	}{
+		{0, 0, 0},
+		{1, 2, 3}, // 3 sigma of the Gaussian kernel
+		{2, 4, 6},
+		{3, 6, 9},
+		{5, 9, 13},
+		{10, 19, 28},
+	}
+	for _, tt := range tests {
+		if tt.sigma >= 2 {
+			if b := boxSize(tt.sigma); b != tt.box {
+				t.Errorf("boxSize(%v) = %d, want %d", tt.sigma, b, tt.box)
+			}
+		}
+		if e := blurExtent(tt.sigma); e != tt.extent {
+			t.Errorf("blurExtent(%v) = %d, want %d", tt.sigma, e, tt.extent)
+		}
+	}
+}
+
+// TestBlurLines blurs an impulse: below a sigma of 2 it spreads as the
+// Gaussian kernel, from 2 as three boxes close to it.
+func TestBlurLines(t *testing.T) {
+	tests := []struct {
+		sigma float64
+		exact bool
+	}{
+		{0.5, true},
+		{1.9, true},
+		{2, false}, // boxes of even size
+		{3, false},
+		{5, false}, // boxes of odd size
+		{8, false},
+	}
+	for _, tt := range tests {
+		const n = 101
+		line := make([]float32, n)
+		line[n/2] = 1
+		blurLines(line, make([]float32, n), n, 1, 1, tt.sigma, 1)
+		k := gaussianKernel(tt.sigma)
+		r := len(k) / 2
+		sum, maxErr := 0.0, 0.0
+		for x, v := range line {
+			sum += float64(v)
+			want := 0.0
+			if i := x - n/2 + r; i >= 0 && i < len(k) {
+				want = k[i]
+			}
+			maxErr = math.Max(maxErr, math.Abs(float64(v)-want))
+			if d := math.Abs(float64(v) - float64(line[n-1-x])); d > 1e-6 {
+				t.Errorf("sigma %v: %v at %d, %v at %d", tt.sigma, v, x, line[n-1-x], n-1-x)
+				break
+			}
+		}
+		if math.Abs(sum-1) > 1e-5 {
+			t.Errorf("sigma %v: sum %v, want 1", tt.sigma, sum)
+		}
+		// the boxes of SVG are within 15% of the peak of the Gaussian
+		switch peak := k[r]; {
+		case tt.exact && maxErr > 1e-6:
+			t.Errorf("sigma %v: differs from the Gaussian by %v", tt.sigma, maxErr)
+		case !tt.exact && (maxErr < 1e-6 || maxErr > 0.15*peak):
+			t.Errorf("sigma %v: boxes differ from the Gaussian by %v, peak %v", tt.sigma, maxErr, peak)
+		}
+	}
+}
+
+// TestBlurParallel checks that the bands of several workers blur like one.
+func TestBlurParallel(t *testing.T) {
+	r := image.Rect(10, 20, 210, 220)
+	a := image.NewAlpha(r)
+	a16 := image.NewAlpha16(r)
+	for i := range a.Pix {
+		a.Pix[i] = uint8(i * i % 251)
+	}
+	for i := range a16.Pix {
+		a16.Pix[i] = uint8(i * 7 % 253)
+	}
+	for _, sigma := range []float64{1.5, 4, 9} {
+		if got, want := blurAlpha(a, sigma, 7), blurAlpha(a, sigma, 1); got.Rect != r || !bytes.Equal(got.Pix, want.Pix) {
+			t.Errorf("sigma %v: bands differ from serial", sigma)
+		}
+		if got, want := blurAlpha16(a16, sigma, 7), blurAlpha16(a16, sigma, 1); got.Rect != r || !bytes.Equal(got.Pix, want.Pix) {
+			t.Errorf("sigma %v: 16-bit bands differ from serial", sigma)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package canvas
+
+// composeRow composites the premultiplied RGBA pixels of src with the ones
+// of dst into dst, with the arithmetic of op.ComposeRGBA. The result is
+// mixed with dst by the mask: pixels whose mask is 0 are left as is, a nil
+// mask covers every pixel.
+func composeRow(op CompositeOperation, dst, src, mask []uint8) {
+	n := len(src)
+	if n > len(dst) {
+		n = len(dst)
+	}
+	if mask == nil {
+		composeOp(op, dst[:n:n], src[:n:n])
+		return
+	}
+	if n > 4*len(mask) {
+		n = 4 * len(mask)
+	}
+	for x := 0; 4*x < n; {
+		m, end := mask[x], x+1
+		if m == 0 || m == 0xff {
+			for 4*end < n && mask[end] == m {
+				end++
+			}
+		}
+		switch m {
+		case 0:
+		case 0xff:
+			composeOp(op, dst[4*x:4*end:4*end], src[4*x:4*end:4*end])
+		default:
+			d := dst[4*x : 4*x+4 : 4*x+4]
+			old := [4]uint8{d[0], d[1], d[2], d[3]}
+			composeOp(op, d, src[4*x:4*x+4:4*x+4])
+			lerpPixel(d, old, m)
+		}
+		x = end
+	}
+}
+
+// lerpPixel mixes the premultiplied pixel d with old by the coverage m.
+func lerpPixel(d []uint8, old [4]uint8, m uint8) {
+	a, b := uint32(m), uint32(0xff-m)
+	d[0] = uint8((uint32(d[0])*a + uint32(old[0])*b) / 0xff)
+	d[1] = uint8((uint32(d[1])*a + uint32(old[1])*b) / 0xff)
+	d[2] = uint8((uint32(d[2])*a + uint32(old[2])*b) / 0xff)
+	d[3] = uint8((uint32(d[3])*a + uint32(old[3])*b) / 0xff)
+}
+
+// composeOp composites every pixel of src with the one of dst, which have
+// the same length.
+func composeOp(op CompositeOperation, dst, src []uint8) {
+	n := len(src)
+	switch op {
+	case Copy:
+		copy(dst, src)
+		return
+	case Lighter:
+		// the fast path of additive particles
+		for i, s := range src {
+			if v := uint32(dst[i]) + uint32(s); v > 0xff {
+				dst[i] = 0xff
+			} else {
+				dst[i] = uint8(v)
+			}
+		}
+		return
+	}
+	switch op {
+	case SourceOver:
+		for i := 0; i < n; i += 4 {
+			d, s := dst[i:i+4:i+4], src[i:i+4:i+4]
+			mb := uint32(0xff - s[3])
+			d[0] = uint8(uint32(s[0]) + uint32(d[0])*mb/0xff)
+			d[1] = uint8(uint32(s[1]) + uint32(d[1])*mb/0xff)
+			d[2] = uint8(uint32(s[2]) + uint32(d[2])*mb/0xff)
+			d[3] = uint8(uint32(s[3]) + uint32(d[3])*mb/0xff)
+		}
+	case SourceIn:
+		for i := 0; i < n; i += 4 {
+			d, s := dst[i:i+4:i+4], src[i:i+4:i+4]
+			da := uint32(d[3])
+			d[0] = uint8(uint32(s[0]) * da / 0xff)
+			d[1] = uint8(uint32(s[1]) * da / 0xff)
+			d[2] = uint8(uint32(s[2]) * da / 0xff)
+			d[3] = uint8(uint32(s[3]) * da / 0xff)
+		}
+	case SourceOut:
+		for i := 0; i < n; i += 4 {
+			d, s := dst[i:i+4:i+4], src[i:i+4:i+4]
+			ma := uint32(0xff - d[3])
+			d[0] = uint8(uint32(s[0]) * ma / 0xff)
+			d[1] = uint8(uint32(s[1]) * ma / 0xff)
+			d[2] = uint8(uint32(s[2]) * ma / 0xff)
+			d[3] = uint8(uint32(s[3]) * ma / 0xff)
+		}
+	case SourceAtop:
+		for i := 0; i < n; i += 4 {
+			d, s := dst[i:i+4:i+4], src[i:i+4:i+4]
+			da, mb := uint32(d[3]), uint32(0xff-s[3])
+			d[0] = uint8(uint32(s[0])*da/0xff + uint32(d[0])*mb/0xff)
+			d[1] = uint8(uint32(s[1])*da/0xff + uint32(d[1])*mb/0xff)
+			d[2] = uint8(uint32(s[2])*da/0xff + uint32(d[2])*mb/0xff)
+			d[3] = uint8(uint32(s[3])*da/0xff + da*mb/0xff)
+		}
+	case DestinationOver:
+		for i := 0; i < n; i += 4 {
+			d, s := dst[i:i+4:i+4], src[i:i+4:i+4]
+			ma := uint32(0xff - d[3])
+			d[0] = uint8(uint32(s[0])*ma/0xff + uint32(d[0]))
+			d[1] = uint8(uint32(s[1])*ma/0xff + uint32(d[1]))
+			d[2] = uint8(uint32(s[2])*ma/0xff + uint32(d[2]))
+			d[3] = uint8(uint32(s[3])*ma/0xff + uint32(d[3]))
+		}
+	case DestinationIn:
+		for i := 0; i < n; i += 4 {
+			d, s := dst[i:i+4:i+4], src[i:i+4:i+4]
+			sa := uint32(s[3])
+			d[0] = uint8(uint32(d[0]) * sa / 0xff)
+			d[1] = uint8(uint32(d[1]) * sa / 0xff)
+			d[2] = uint8(uint32(d[2]) * sa / 0xff)
+			d[3] = uint8(uint32(d[3]) * sa / 0xff)
+		}
+	case DestinationOut:
+		for i := 0; i < n; i += 4 {
+			d, s := dst[i:i+4:i+4], src[i:i+4:i+4]
+			mb := uint32(0xff - s[3])
+			d[0] = uint8(uint32(d[0]) * mb / 0xff)
+			d[1] = uint8(uint32(d[1]) * mb / 0xff)
+			d[2] = uint8(uint32(d[2]) * mb / 0xff)
+			d[3] = uint8(uint32(d[3]) * mb / 0xff)
+		}
+	case DestinationAtop:
+		for i := 0; i < n; i += 4 {
+			d, s := dst[i:i+4:i+4], src[i:i+4:i+4]
+			sa, ma := uint32(s[3]), uint32(0xff-d[3])
+			d[0] = uint8(uint32(s[0])*ma/0xff + uint32(d[0])*sa/0xff)
+			d[1] = uint8(uint32(s[1])*ma/0xff + uint32(d[1])*sa/0xff)
+			d[2] = uint8(uint32(s[2])*ma/0xff + uint32(d[2])*sa/0xff)
+			d[3] = uint8(sa*ma/0xff + uint32(d[3])*sa/0xff)
+		}
+	case Xor:
+		for i := 0; i < n; i += 4 {
+			d, s := dst[i:i+4:i+4], src[i:i+4:i+4]
+			ma, mb := uint32(0xff-d[3]), uint32(0xff-s[3])
+			c := makeRGBA(
+				uint32(s[0])*ma/0xff+uint32(d[0])*mb/0xff,
+				uint32(s[1])*ma/0xff+uint32(d[1])*mb/0xff,
+				uint32(s[2])*ma/0xff+uint32(d[2])*mb/0xff,
+				uint32(s[3])*ma/0xff+uint32(d[3])*mb/0xff)
+			d[0], d[1], d[2], d[3] = c.R, c.G, c.B, c.A
+		}
+	default:
+		clearRow(dst, nil)
+	}
+}
+
+// clearRow makes the pixels of dst transparent by their mask, a nil mask
+// covers every pixel.
+func clearRow(dst, mask []uint8) {
+	for i := 0; i+3 < len(dst); i += 4 {
+		if mask == nil || mask[i>>2] == 0xff {
+			dst[i], dst[i+1], dst[i+2], dst[i+3] = 0, 0, 0, 0
+		} else if b := uint32(0xff - mask[i>>2]); b != 0xff {
+			dst[i] = uint8(uint32(dst[i]) * b / 0xff)
+			dst[i+1] = uint8(uint32(dst[i+1]) * b / 0xff)
+			dst[i+2] = uint8(uint32(dst[i+2]) * b / 0xff)
+			dst[i+3] = uint8(uint32(dst[i+3]) * b / 0xff)
+		}
+	}
+}
+
+// boundedOp reports whether op leaves the destination as is where the
+// source is transparent, which lets it be composited span by span.
+func boundedOp(op CompositeOperation) bool {
+	switch op {
+	case SourceOver, SourceAtop, DestinationOver, DestinationOut, Lighter, Xor:
+		return true
+	}
+	return false
+}
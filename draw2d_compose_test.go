@@ -0,0 +1,110 @@
+package canvas
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestComposeRowMask(t *testing.T) {
+	black := []uint8{0, 0, 0, 0xff}
+	tests := []struct {
+		name     string
+		op       CompositeOperation
+		dst, src []uint8
+		mask     uint8
+		want     []uint8
+	}{
+		{"copy", Copy, black, []uint8{0xff, 0, 0, 0xff}, 0xff, []uint8{0xff, 0, 0, 0xff}},
+		{"copy clipped", Copy, black, []uint8{0xff, 0, 0, 0xff}, 0, black},
+		{"copy half", Copy, black, []uint8{0xff, 0, 0, 0xff}, 0x80, []uint8{0x80, 0, 0, 0xff}},
+		{"copy transparent half", Copy, black, []uint8{0, 0, 0, 0}, 0x80, []uint8{0, 0, 0, 0x7f}},
+		{"over half", SourceOver, black, []uint8{0x80, 0x80, 0x80, 0x80}, 0x80, []uint8{0x40, 0x40, 0x40, 0xff}},
+		{"in half", SourceIn, black, []uint8{0xff, 0, 0, 0xff}, 0x80, []uint8{0x80, 0, 0, 0xff}},
+		// the sum saturates before it is mixed
+		{"lighter half", Lighter, []uint8{0xff, 0, 0, 0xff}, []uint8{0xff, 0xff, 0, 0xff}, 0x80, []uint8{0xff, 0x80, 0, 0xff}},
+		{"clear half", DestinationIn, black, []uint8{0, 0, 0, 0}, 0x40, []uint8{0, 0, 0, 0xbf}},
+	}
+	for _, tt := range tests {
+		dst := append([]uint8(nil), tt.dst...)
+		composeRow(tt.op, dst, tt.src, []uint8{tt.mask})
+		if string(dst) != string(tt.want) {
+			t.Errorf("%s: %v, want %v", tt.name, dst, tt.want)
+		}
+	}
+
+	// a row of runs of every coverage composites like its pixels one by one
+	mask := []uint8{0xff, 0xff, 0, 0, 0x80, 0xff, 0x20, 0}
+	src := make([]uint8, 4*len(mask))
+	dst := make([]uint8, 4*len(mask))
+	for i := range src {
+		src[i], dst[i] = uint8(i*7), uint8(0xff-i*5)
+	}
+	for op := SourceAtop; op <= Xor; op++ {
+		got := append([]uint8(nil), dst...)
+		composeRow(op, got, src, mask)
+		for x, m := range mask {
+			want := append([]uint8(nil), dst[4*x:4*x+4]...)
+			composeRow(op, want, src[4*x:4*x+4], []uint8{m})
+			if string(got[4*x:4*x+4]) != string(want) {
+				t.Errorf("%v: pixel %d is %v, want %v", op, x, got[4*x:4*x+4], want)
+			}
+		}
+	}
+}
+
+// TestClipComposite draws with an unbounded operation in a clip whose left
+// edge covers half of a column: the image is left as is outside of the clip
+// and mixed on its edge.
+func TestClipComposite(t *testing.T) {
+	backings := []struct {
+		name string
+		gc   *GraphicContext2D
+	}{
+		{"RGBA", NewGraphicContext2D(40, 40)},
+		{"RGBA64", NewGraphicContext2DForRGBA64(image.NewRGBA64(image.Rect(0, 0, 40, 40)))},
+		{"Float", NewGraphicContext2DForFloat(NewFloatRGBA(image.Rect(0, 0, 40, 40)))},
+	}
+	tests := []struct {
+		x          int
+		want       color.RGBA
+		wantShadow color.RGBA // the transparent shadow is mixed in first
+	}{
+		{5, color.RGBA{0, 0, 0xff, 0xff}, color.RGBA{0, 0, 0xff, 0xff}}, // outside of the clip
+		{10, color.RGBA{0x80, 0, 0x7f, 0xff}, color.RGBA{0x80, 0, 0x3f, 0xbf}},
+		{20, color.RGBA{0xff, 0, 0, 0xff}, color.RGBA{0xff, 0, 0, 0xff}},
+		{35, color.RGBA{0, 0, 0xff, 0xff}, color.RGBA{0, 0, 0xff, 0xff}}, // outside of the clip
+	}
+	for _, b := range backings {
+		for _, shadow := range []bool{false, true} {
+			gc := b.gc
+			gc.SetGlobalCompositeOperation(SourceOver)
+			gc.SetFillColor(color.RGBA{0, 0, 0xff, 0xff})
+			gc.FillRect(0, 0, 40, 40)
+			gc.Save()
+			gc.BeginPath()
+			gc.Rect(10.5, 0, 19.5, 40)
+			gc.Clip()
+			if shadow {
+				// a shadow off the canvas composites transparent pixels
+				gc.SetShadowColor(color.Black)
+				gc.SetShadowOffset(100, 0)
+			}
+			gc.SetGlobalCompositeOperation(Copy)
+			gc.SetFillColor(color.RGBA{0xff, 0, 0, 0xff})
+			gc.FillRect(0, 0, 40, 40)
+			gc.Restore()
+			for _, tt := range tests {
+				want := tt.want
+				if shadow {
+					want = tt.wantShadow
+				}
+				got := image.NewRGBA(image.Rect(0, 0, 1, 1))
+				got.Set(0, 0, gc.Image().At(tt.x, 20))
+				if d, _ := maxDiff(got, &image.Uniform{want}); d > 1 {
+					t.Errorf("%s, shadow %v: at %d %v, want %v", b.name, shadow, tt.x, got.RGBAAt(0, 0), want)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package canvas
+
+import (
+	"image"
+	"math"
+)
+
+// maxDamageRects is the number of rectangles the damage of a context is
+// merged down to.
+const maxDamageRects = 8
+
+// TakeDamage returns the rectangles of the pixels changed since the last
+// call, or since the context was created, and resets them. The rectangles
+// do not overlap and may cover some unchanged pixels.
+func (gc *GraphicContext2D) TakeDamage() []image.Rectangle {
+	d := gc.damage
+	gc.damage = nil
+	return d
+}
+
+// addDamage adds r to the damage of the context. Overlapping or touching
+// rectangles are merged, as are the two closest ones when there are too
+// many.
+func (gc *GraphicContext2D) addDamage(r image.Rectangle) {
+	r = r.Intersect(image.Rect(0, 0, gc.width, gc.height))
+	if r.Empty() {
+		return
+	}
+	for {
+		merged := false
+		for i := 0; i < len(gc.damage); i++ {
+			if d := gc.damage[i]; d.Inset(-1).Overlaps(r) {
+				r = r.Union(d)
+				gc.damage = append(gc.damage[:i], gc.damage[i+1:]...)
+				merged = true
+				i--
+			}
+		}
+		if !merged {
+			break
+		}
+	}
+	gc.damage = append(gc.damage, r)
+	for len(gc.damage) > maxDamageRects {
+		// merge the pair that adds the least area
+		bi, bj, best := 0, 1, -1
+		for i := range gc.damage {
+			for j := i + 1; j < len(gc.damage); j++ {
+				a, b := gc.damage[i], gc.damage[j]
+				if grow := area(a.Union(b)) - area(a) - area(b); best < 0 || grow < best {
+					bi, bj, best = i, j, grow
+				}
+			}
+		}
+		r := gc.damage[bi].Union(gc.damage[bj])
+		gc.damage = append(gc.damage[:bj], gc.damage[bj+1:]...)
+		gc.damage = append(gc.damage[:bi], gc.damage[bi+1:]...)
+		gc.addDamage(r)
+	}
+}
+
+func area(r image.Rectangle) int {
+	return r.Dx() * r.Dy()
+}
+
+// imageDamage returns the pixels covered by a w x h image drawn with tr,
+// with a pixel more for the filter.
+func imageDamage(tr Matrix, w, h int) image.Rectangle {
+	x0, y0, x1, y1 := tr.TransformRectangle(0, 0, float64(w), float64(h))
+	return image.Rect(int(math.Floor(x0)), int(math.Floor(y0)), int(math.Ceil(x1)), int(math.Ceil(y1))).Inset(-1)
+}
+
+// damage returns the pixels changed by the last draw of the painter.
+func (r *RGBAPainter) damage() image.Rectangle {
+	switch r.Op {
+	case SourceAtop, SourceOver, DestinationOver, DestinationOut, Lighter, Xor:
+	default:
+		// the whole canvas is composited
+		return r.Image.Rect
+	}
+	return spanDamage(r.spanRect, r.hasShadow, r.shadowOffsetX, r.shadowOffsetY, blurExtent(shadowSigma(r.shadowBlur))).Intersect(r.Image.Rect)
+}
+
+// damage returns the pixels changed by the last draw of the painter.
+func (r *deepPainter) damage() image.Rectangle {
+	b := r.Image.Bounds()
+	if r.layer != nil {
+		switch r.Op {
+		case SourceAtop, SourceOver, DestinationOver, DestinationOut, Lighter, Xor:
+		default:
+			return b
+		}
+	}
+	return spanDamage(r.spanRect, r.hasShadow, r.shadowOffsetX, r.shadowOffsetY, blurExtent(shadowSigma(r.shadowBlur))).Intersect(b)
+}
+
+// spanDamage returns the pixels of the span rectangle of a painter, which
+// includes its maximum, and of its shadow.
+func spanDamage(spanRect image.Rectangle, shadow bool, offsetX, offsetY float64, blur int) image.Rectangle {
+	if spanRect.Min.X > spanRect.Max.X || spanRect.Min.Y > spanRect.Max.Y {
+		return image.Rectangle{}
+	}
+	rect := spanRect
+	rect.Max = rect.Max.Add(image.Pt(1, 1))
+	if shadow {
+		rect = rect.Union(rect.Add(image.Pt(int(offsetX), int(offsetY))).Inset(-blur))
+	}
+	return rect
+}
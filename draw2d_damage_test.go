@@ -0,0 +1,122 @@
+package canvas
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// covers reports whether p is in one of rs.
+func covers(rs []image.Rectangle, p image.Point) bool {
+	for _, r := range rs {
+		if p.In(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDamage checks that rs do not overlap and lie in bound.
+func checkDamage(t *testing.T, name string, rs []image.Rectangle, bound image.Rectangle) {
+	t.Helper()
+	for i, r := range rs {
+		if !r.In(bound) {
+			t.Errorf("%s: damage %v is not in %v", name, r, bound)
+		}
+		for _, s := range rs[i+1:] {
+			if r.Overlaps(s) {
+				t.Errorf("%s: damage %v overlaps %v", name, r, s)
+			}
+		}
+	}
+}
+
+func TestTakeDamage(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	tests := []struct {
+		name  string
+		draw  func(gc *GraphicContext2D)
+		bound image.Rectangle // the damage lies in bound
+	}{
+		{"fill", func(gc *GraphicContext2D) {
+			gc.FillRect(10, 10, 20, 20)
+		}, image.Rect(9, 9, 32, 32)},
+		{"stroke", func(gc *GraphicContext2D) {
+			gc.SetLineWidth(4)
+			gc.StrokeRect(20, 20, 30, 10)
+		}, image.Rect(17, 17, 53, 33)},
+		{"shadow", func(gc *GraphicContext2D) {
+			gc.SetShadowColor(color.Black)
+			gc.SetShadowOffset(20, 0)
+			gc.FillRect(10, 10, 10, 10)
+		}, image.Rect(9, 9, 42, 22)},
+		{"image", func(gc *GraphicContext2D) {
+			gc.DrawImage(img, 40, 50)
+		}, image.Rect(39, 49, 49, 59)},
+		{"clipped", func(gc *GraphicContext2D) {
+			gc.FillRect(90, 90, 20, 20)
+		}, image.Rect(89, 89, 100, 100)},
+		{"clear", func(gc *GraphicContext2D) {
+			gc.Clear(color.White)
+		}, image.Rect(0, 0, 100, 100)},
+	}
+	for _, tt := range tests {
+		gc := NewGraphicContext2D(100, 100)
+		if d := gc.TakeDamage(); d != nil {
+			t.Errorf("%s: new context damaged %v", tt.name, d)
+		}
+		gc.SetFillColor(color.Black)
+		gc.SetStrokeColor(color.Black)
+		tt.draw(gc)
+		d := gc.TakeDamage()
+		if len(d) == 0 {
+			t.Errorf("%s: no damage", tt.name)
+			continue
+		}
+		checkDamage(t, tt.name, d, tt.bound)
+		for _, p := range painted(gc.Image()) {
+			if !covers(d, p) {
+				t.Errorf("%s: painted %v is not in the damage %v", tt.name, p, d)
+				break
+			}
+		}
+		if tt.name == "clear" && (len(d) != 1 || d[0] != tt.bound) {
+			t.Errorf("clear: damage %v, want the canvas", d)
+		}
+		if d := gc.TakeDamage(); d != nil {
+			t.Errorf("%s: damage %v after TakeDamage", tt.name, d)
+		}
+	}
+}
+
+func TestAddDamage(t *testing.T) {
+	gc := NewGraphicContext2D(200, 200)
+	gc.addDamage(image.Rect(0, 0, 10, 10))
+	gc.addDamage(image.Rect(10, 0, 20, 10)) // touching
+	gc.addDamage(image.Rect(5, 5, 15, 30))  // overlapping
+	gc.addDamage(image.Rect(300, 300, 310, 310))
+	if d := gc.TakeDamage(); len(d) != 1 || d[0] != image.Rect(0, 0, 20, 30) {
+		t.Errorf("merged damage %v, want one rectangle", d)
+	}
+
+	// far apart rectangles are merged down to the closest ones
+	var rs []image.Rectangle
+	for i := 0; i < 12; i++ {
+		r := image.Rect(i*16, (i%3)*60, i*16+4, (i%3)*60+4)
+		rs = append(rs, r)
+		gc.addDamage(r)
+	}
+	d := gc.TakeDamage()
+	if len(d) != maxDamageRects {
+		t.Errorf("%d rectangles, want %d", len(d), maxDamageRects)
+	}
+	checkDamage(t, "merged", d, image.Rect(0, 0, 200, 200))
+	for _, r := range rs {
+		if !covers(d, r.Min) || !covers(d, r.Max.Sub(image.Pt(1, 1))) {
+			t.Errorf("%v is not in the damage %v", r, d)
+		}
+	}
+}
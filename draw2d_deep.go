@@ -0,0 +1,350 @@
+package canvas
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/golang/freetype/raster"
+)
+
+// FloatRGBA is an in-memory image of premultiplied float32 colors, which
+// does not band or drift when many translucent layers are composited.
+type FloatRGBA struct {
+	Pix    []float32
+	Stride int
+	Rect   image.Rectangle
+}
+
+// NewFloatRGBA returns a transparent FloatRGBA with the given bounds.
+func NewFloatRGBA(r image.Rectangle) *FloatRGBA {
+	return &FloatRGBA{
+		Pix:    make([]float32, 4*r.Dx()*r.Dy()),
+		Stride: 4 * r.Dx(),
+		Rect:   r,
+	}
+}
+
+// FRGBAModel converts colors to premultiplied FRGBA.
+var FRGBAModel = color.ModelFunc(func(c color.Color) color.Color {
+	return ToFRGBA(c)
+})
+
+func (p *FloatRGBA) ColorModel() color.Model { return FRGBAModel }
+
+func (p *FloatRGBA) Bounds() image.Rectangle { return p.Rect }
+
+func (p *FloatRGBA) At(x, y int) color.Color {
+	return p.FRGBAAt(x, y)
+}
+
+func (p *FloatRGBA) FRGBAAt(x, y int) FRGBA {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return FRGBA{}
+	}
+	s := p.Pix[p.PixOffset(x, y):]
+	return FRGBA{float64(s[0]), float64(s[1]), float64(s[2]), float64(s[3])}
+}
+
+// PixOffset returns the index of the first element of Pix that corresponds
+// to the pixel at (x, y).
+func (p *FloatRGBA) PixOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.Stride + (x-p.Rect.Min.X)*4
+}
+
+func (p *FloatRGBA) Set(x, y int, c color.Color) {
+	p.SetFRGBA(x, y, ToFRGBA(c))
+}
+
+func (p *FloatRGBA) SetFRGBA(x, y int, c FRGBA) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	s := p.Pix[p.PixOffset(x, y):]
+	s[0], s[1], s[2], s[3] = float32(c.R), float32(c.G), float32(c.B), float32(c.A)
+}
+
+// RGBA converts the image down to 8 bits per channel.
+func (p *FloatRGBA) RGBA() *image.RGBA {
+	img := image.NewRGBA(p.Rect)
+	for y := p.Rect.Min.Y; y < p.Rect.Max.Y; y++ {
+		s := p.Pix[p.PixOffset(p.Rect.Min.X, y):]
+		d := img.Pix[img.PixOffset(p.Rect.Min.X, y):]
+		for i := 0; i < 4*p.Rect.Dx(); i++ {
+			d[i] = uint8(math.Max(0, math.Min(1, float64(s[i])))*0xff + 0.5)
+		}
+	}
+	return img
+}
+
+// deepImage is a backing store of more than 8 bits per channel.
+type deepImage interface {
+	draw.Image
+	FRGBAAt(x, y int) FRGBA
+	SetFRGBA(x, y int, c FRGBA)
+}
+
+type rgba64Image struct {
+	*image.RGBA64
+}
+
+func (p rgba64Image) FRGBAAt(x, y int) FRGBA {
+	c := p.RGBA64At(x, y)
+	return FRGBA{float64(c.R) / 0xffff, float64(c.G) / 0xffff, float64(c.B) / 0xffff, float64(c.A) / 0xffff}
+}
+
+func (p rgba64Image) SetFRGBA(x, y int, c FRGBA) {
+	v := func(f float64) uint16 {
+		return uint16(math.Max(0, math.Min(1, f))*0xffff + 0.5)
+	}
+	p.SetRGBA64(x, y, color.RGBA64{v(c.R), v(c.G), v(c.B), v(c.A)})
+}
+
+// toRGBA converts a deep image down to 8 bits per channel.
+func toRGBA(img deepImage) *image.RGBA {
+	switch img := img.(type) {
+	case *FloatRGBA:
+		return img.RGBA()
+	case rgba64Image:
+		dst := image.NewRGBA(img.Rect)
+		draw.Draw(dst, dst.Rect, img.RGBA64, img.Rect.Min, draw.Src)
+		return dst
+	}
+	return imageToRGBA(img)
+}
+
+// deepPainter is the painter of a deep image, it composites FRGBA colors
+// with CompositeOperation.Compose.
+type deepPainter struct {
+	Image         deepImage
+	Mask          *image.Alpha
+	Op            CompositeOperation
+	layer         *FloatRGBA // the source, when it is not painted over directly
+	spanRect      image.Rectangle
+	pattern       Pattern
+	solid         bool
+	solidColor    FRGBA
+	canvasAlpha   float64
+	shadowOffsetX float64
+	shadowOffsetY float64
+	shadowBlur    float64
+	shadowColor   color.Color
+	hasShadow     bool
+	linear        bool
+	shadows       *shadowCache
+}
+
+func newDeepPainter(img deepImage) *deepPainter {
+	return &deepPainter{Image: img, canvasAlpha: 1.0, Op: SourceOver, shadows: newShadowCache(defaultShadowCacheSize)}
+}
+
+func (r *deepPainter) SetMask(mask *image.Alpha) {
+	r.Mask = mask
+}
+
+func (r *deepPainter) SetGlobalAlpha(alpha float64) {
+	r.canvasAlpha = alpha
+}
+
+func (r *deepPainter) SetPattern(p Pattern, m Matrix) {
+	if solid, ok := p.(*SolidPattern); ok {
+		r.solid = true
+		r.solidColor = ToFRGBA(solid.color)
+	} else {
+		r.solid = false
+		if m.IsIdentity() {
+			r.pattern = p
+		} else {
+			r.pattern = &tranPattern{p, m}
+		}
+	}
+}
+
+func (r *deepPainter) SetCompositeOperation(op CompositeOperation) {
+	r.Op = op
+}
+
+func (r *deepPainter) SetShadow(offsetX float64, offsetY float64, blur float64, clr color.Color) {
+	r.shadowOffsetX = offsetX
+	r.shadowOffsetY = offsetY
+	r.shadowBlur = blur
+	r.shadowColor = clr
+	_, _, _, a := r.shadowColor.RGBA()
+	r.hasShadow = a != 0 && (offsetX != 0 || offsetY != 0 || blur != 0)
+}
+
+func (r *deepPainter) SetLinearLight(linear bool) {
+	r.linear = linear
+}
+
+func (r *deepPainter) LinearLight() bool {
+	return r.linear
+}
+
+func (r *deepPainter) Begin() {
+	r.spanRect = image.Rectangle{image.Pt(1e9, 1e9), image.Pt(-1e9, -1e9)}
+	r.layer = nil
+	if r.hasShadow || r.Op != SourceOver {
+		r.layer = NewFloatRGBA(r.Image.Bounds())
+	}
+}
+
+// Paint satisfies the Painter interface.
+func (r *deepPainter) Paint(ss []raster.Span, done bool) {
+	b := r.Image.Bounds()
+	for _, s := range ss {
+		if s.Y < b.Min.Y {
+			continue
+		}
+		if s.Y >= b.Max.Y {
+			return
+		}
+		if s.X0 < b.Min.X {
+			s.X0 = b.Min.X
+		}
+		if s.X1 > b.Max.X {
+			s.X1 = b.Max.X
+		}
+		if s.X0 >= s.X1 {
+			continue
+		}
+		r.spanRect = unionSpanRect(r.spanRect, image.Rect(s.X0, s.Y, s.X1, s.Y))
+		ma := float64(s.Alpha) / 0xffff * r.canvasAlpha
+		for x := s.X0; x < s.X1; x++ {
+			// the mask scales the coverage of a source painted over
+			// directly, the layer is mixed with the image by it in End
+			cov := ma
+			if r.Mask != nil && r.layer == nil {
+				cov *= float64(r.Mask.AlphaAt(x, s.Y).A) / 0xff
+				if cov == 0 {
+					continue
+				}
+			}
+			c := r.solidColor
+			if !r.solid {
+				c = ToFRGBA(r.pattern.ColorAt(x, s.Y))
+			}
+			c = c.Mul(cov)
+			if r.layer != nil {
+				r.layer.SetFRGBA(x, s.Y, c)
+				continue
+			}
+			r.Image.SetFRGBA(x, s.Y, r.compose(c, r.Image.FRGBAAt(x, s.Y)))
+		}
+	}
+}
+
+func (r *deepPainter) shadowCache() *shadowCache {
+	return r.shadows
+}
+
+func (r *deepPainter) fork() raster.Painter {
+	p := *r
+	return &p
+}
+
+func (r *deepPainter) join(p raster.Painter) {
+	r.spanRect = unionSpanRect(r.spanRect, p.(*deepPainter).spanRect)
+}
+
+func (r *deepPainter) compose(src, dst FRGBA) FRGBA {
+	if r.linear {
+		return linearToFRGBA(r.Op.Compose(frgbaToLinear(src), frgbaToLinear(dst)))
+	}
+	return r.Op.Compose(src, dst)
+}
+
+func (r *deepPainter) End() {
+	if r.layer == nil {
+		return
+	}
+	b := r.Image.Bounds()
+	rect := b
+	switch r.Op {
+	case SourceAtop, SourceOver, DestinationOver, DestinationOut, Lighter, Xor:
+		// the destination is left as is outside of the source
+		rect = r.spanRect
+		rect.Max = rect.Max.Add(image.Pt(1, 1))
+	}
+	var shadow *image.Alpha16
+	var shadowColor FRGBA
+	if r.hasShadow {
+		shadow = r.shadowMask()
+		shadowColor = ToFRGBA(r.shadowColor)
+		if rect != b {
+			rect = rect.Union(shadow.Rect)
+		}
+	}
+	rect = rect.Intersect(b)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			m := 1.0
+			if r.Mask != nil {
+				if m = float64(r.Mask.AlphaAt(x, y).A) / 0xff; m == 0 {
+					continue
+				}
+			}
+			dst := r.Image.FRGBAAt(x, y)
+			if shadow != nil {
+				dst = lerpFRGBA(dst, r.compose(shadowColor.Mul(float64(shadow.Alpha16At(x, y).A)/0xffff), dst), m)
+			}
+			r.Image.SetFRGBA(x, y, lerpFRGBA(dst, r.compose(r.layer.FRGBAAt(x, y), dst), m))
+		}
+	}
+}
+
+// lerpFRGBA mixes a with b by m.
+func lerpFRGBA(a, b FRGBA, m float64) FRGBA {
+	if m == 1 {
+		return b
+	}
+	return FRGBA{a.R + (b.R-a.R)*m, a.G + (b.G-a.G)*m, a.B + (b.B-a.B)*m, a.A + (b.A-a.A)*m}
+}
+
+// shadowMask returns the 16-bit alpha of the source blurred and moved by
+// the shadow offset, which does not band in faint shadows.
+func (r *deepPainter) shadowMask() *image.Alpha16 {
+	src := r.layer
+	sigma := shadowSigma(r.shadowBlur)
+	rect := spanDamage(r.spanRect, false, 0, 0, 0).Inset(-blurExtent(sigma)).Intersect(src.Rect)
+	a := image.NewAlpha16(rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			a.SetAlpha16(x, y, color.Alpha16{uint16(math.Min(1, src.FRGBAAt(x, y).A)*0xffff + 0.5)})
+		}
+	}
+	m := r.shadows.blur16(a, sigma)
+	m.Rect = m.Rect.Add(image.Pt(int(r.shadowOffsetX), int(r.shadowOffsetY)))
+	return m
+}
+
+// frgbaToLinear converts a premultiplied sRGB color to linear light.
+func frgbaToLinear(c FRGBA) FRGBA {
+	if c.A <= 0 {
+		return FRGBA{}
+	}
+	f := func(v float64) float64 {
+		v = math.Min(1, v/c.A)
+		if v <= 0.04045 {
+			return v / 12.92 * c.A
+		}
+		return math.Pow((v+0.055)/1.055, 2.4) * c.A
+	}
+	return FRGBA{f(c.R), f(c.G), f(c.B), c.A}
+}
+
+// linearToFRGBA converts a premultiplied linear color to sRGB.
+func linearToFRGBA(c FRGBA) FRGBA {
+	if c.A <= 0 {
+		return FRGBA{}
+	}
+	f := func(v float64) float64 {
+		v = math.Min(1, v/c.A)
+		if v <= 0.0031308 {
+			return v * 12.92 * c.A
+		}
+		return (1.055*math.Pow(v, 1/2.4) - 0.055) * c.A
+	}
+	return FRGBA{f(c.R), f(c.G), f(c.B), c.A}
+}
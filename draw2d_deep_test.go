@@ -0,0 +1,95 @@
+package canvas
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// maxDiff returns the largest difference between the 8-bit channels of a
+// and b, and where it is.
+func maxDiff(a, b image.Image) (d int, at image.Point) {
+	r := a.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			ca := color.RGBAModel.Convert(a.At(x, y)).(color.RGBA)
+			cb := color.RGBAModel.Convert(b.At(x, y)).(color.RGBA)
+			for _, p := range [][2]uint8{{ca.R, cb.R}, {ca.G, cb.G}, {ca.B, cb.B}, {ca.A, cb.A}} {
+				v := int(p[0]) - int(p[1])
+				if v < 0 {
+					v = -v
+				}
+				if v > d {
+					d, at = v, image.Pt(x, y)
+				}
+			}
+		}
+	}
+	return
+}
+
+// TestDeepMatches8Bit checks that the RGBA64 and float contexts composite
+// like the 8-bit one, within the rounding of its arithmetic which truncates
+// every composite, twice with a shadow.
+func TestDeepMatches8Bit(t *testing.T) {
+	const size = 200
+	deep := []struct {
+		name string
+		new  func() (*GraphicContext2D, image.Image)
+	}{
+		{"RGBA64", func() (*GraphicContext2D, image.Image) {
+			img := image.NewRGBA64(image.Rect(0, 0, size, size))
+			return NewGraphicContext2DForRGBA64(img), img
+		}},
+		{"Float", func() (*GraphicContext2D, image.Image) {
+			img := NewFloatRGBA(image.Rect(0, 0, size, size))
+			return NewGraphicContext2DForFloat(img), img
+		}},
+	}
+	for op := SourceAtop; op <= Xor; op++ {
+		for _, shadow := range []bool{false, true} {
+			for _, clip := range []bool{false, true} {
+				want := image.NewRGBA(image.Rect(0, 0, size, size))
+				drawBands(NewGraphicContext2DForImage(want), op, AntialiasDefault, shadow, clip)
+				for _, b := range deep {
+					name := fmt.Sprintf("%s/%v/shadow=%v/clip=%v", b.name, op, shadow, clip)
+					gc, got := b.new()
+					drawBands(gc, op, AntialiasDefault, shadow, clip)
+					if d, at := maxDiff(got, want); d > 6 {
+						t.Errorf("%s: differs by %d at %v", name, d, at)
+					}
+					if d, _ := maxDiff(gc.Image(), want); d > 6 {
+						t.Errorf("%s: Image differs by %d", name, d)
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestDeepNoBanding composites many faint layers of white over black, the
+// 8-bit context stops at mid gray where a layer rounds to no change.
+func TestDeepNoBanding(t *testing.T) {
+	tests := []struct {
+		name string
+		gc   *GraphicContext2D
+		want uint8
+	}{
+		{"RGBA", NewGraphicContext2DForImage(image.NewRGBA(image.Rect(0, 0, 4, 4))), 0x80},
+		{"RGBA64", NewGraphicContext2DForRGBA64(image.NewRGBA64(image.Rect(0, 0, 4, 4))), 0x8b},
+		{"Float", NewGraphicContext2DForFloat(NewFloatRGBA(image.Rect(0, 0, 4, 4))), 0x8b}, // 1 - (1 - 1/255)^200 of white
+	}
+	for _, tt := range tests {
+		tt.gc.SetFillColor(color.Black)
+		tt.gc.FillRect(0, 0, 4, 4)
+		tt.gc.SetFillColor(color.NRGBA{0xff, 0xff, 0xff, 1})
+		for i := 0; i < 200; i++ {
+			tt.gc.FillRect(0, 0, 4, 4)
+		}
+		c := color.RGBAModel.Convert(tt.gc.Image().At(1, 1)).(color.RGBA)
+		if d := int(c.R) - int(tt.want); d < -1 || d > 1 {
+			t.Errorf("%s: %v, want gray %#x", tt.name, c, tt.want)
+		}
+	}
+}
@@ -59,8 +59,27 @@ type Flattener interface {
 	End()
 }
 
-// Flatten convert curves into straight segments keeping join segments info
+// DefaultFlatteningTolerance is the distance in device pixels that a curve
+// may be from the segments it is flattened into. It is the square root of
+// 1/8, the tolerance of the fixed thresholds curves were flattened at.
+const DefaultFlatteningTolerance = 0.35355339059327376220
+
+// Flatten convert curves into straight segments keeping join segments info,
+// scale is the size in device pixels of a unit of the path
 func Flatten(path *Path, flattener Flattener, scale float64) {
+	FlattenTolerance(path, flattener, scale, DefaultFlatteningTolerance)
+}
+
+// FlattenTolerance is Flatten with curves at most tolerance device pixels
+// from their segments. Smaller tolerances give smoother curves with more
+// segments, tolerance <= 0 is DefaultFlatteningTolerance.
+func FlattenTolerance(path *Path, flattener Flattener, scale, tolerance float64) {
+	if tolerance <= 0 {
+		tolerance = DefaultFlatteningTolerance
+	}
+	// the tolerance in units of the path
+	tolerance /= scale
+	quadThreshold, cubicThreshold := quadFlatteningThreshold(tolerance), cubicFlatteningThreshold(tolerance)
 	// First Point
 	var startX, startY float64 = 0, 0
 	// Current Point
@@ -82,17 +101,17 @@ func Flatten(path *Path, flattener Flattener, scale float64) {
 			flattener.LineJoin()
 			i += 2
 		case QuadCurveToCmp:
-			TraceQuad(flattener, path.Points[i-2:], 0.5)
+			TraceQuad(flattener, path.Points[i-2:], quadThreshold)
 			x, y = path.Points[i+2], path.Points[i+3]
 			flattener.LineTo(x, y)
 			i += 4
 		case CubicCurveToCmp:
-			TraceCubic(flattener, path.Points[i-2:], 0.5)
+			TraceCubic(flattener, path.Points[i-2:], cubicThreshold)
 			x, y = path.Points[i+4], path.Points[i+5]
 			flattener.LineTo(x, y)
 			i += 6
 		case ArcAngleCmp:
-			x, y = TraceArc(flattener, path.Points[i], path.Points[i+1], path.Points[i+2], path.Points[i+3], path.Points[i+4], path.Points[i+5], scale)
+			x, y = TraceArcTolerance(flattener, path.Points[i], path.Points[i+1], path.Points[i+2], path.Points[i+3], path.Points[i+4], path.Points[i+5], arcTolerance(tolerance))
 			flattener.LineTo(x, y)
 			i += 6
 		case CloseCmp:
@@ -244,6 +263,14 @@ func TraceCubic(t Liner, cubic []float64, flatteningThreshold float64) error {
 	return nil
 }
 
+// cubicFlatteningThreshold returns the flattening threshold of TraceCubic
+// for curves within tolerance of their segments. A cubic is at most 4/9 of
+// the sum of the distances of its control points away from its chord, the
+// threshold is the one of quads.
+func cubicFlatteningThreshold(tolerance float64) float64 {
+	return quadFlatteningThreshold(tolerance)
+}
+
 // Quad
 // x1, y1, cpx1, cpy2, x2, y2 float64
 
@@ -301,15 +328,37 @@ func TraceQuad(t Liner, quad []float64, flatteningThreshold float64) error {
 	return nil
 }
 
+// quadFlatteningThreshold returns the flattening threshold of TraceQuad for
+// curves within tolerance of their segments. A quad is at most half of the
+// distance of its control point away from its chord, the threshold is
+// 4*tolerance*tolerance, exactly 0.5 at DefaultFlatteningTolerance.
+func quadFlatteningThreshold(tolerance float64) float64 {
+	t := tolerance / DefaultFlatteningTolerance
+	return 0.5 * t * t
+}
+
+// arcTolerance returns the tolerance arcs are traced within for curves
+// within tolerance. Arcs stay 0.125 pixels from their segments at the
+// default, as smooth as they were before the tolerance could be set.
+func arcTolerance(tolerance float64) float64 {
+	return 0.125 * tolerance / DefaultFlatteningTolerance
+}
+
 // TraceArc trace an arc using a Liner
 func TraceArc(t Liner, x, y, rx, ry, start, angle, scale float64) (lastX, lastY float64) {
+	return TraceArcTolerance(t, x, y, rx, ry, start, angle, arcTolerance(DefaultFlatteningTolerance)/scale)
+}
+
+// TraceArcTolerance traces an arc with segments at most tolerance away
+// from it using a Liner
+func TraceArcTolerance(t Liner, x, y, rx, ry, start, angle, tolerance float64) (lastX, lastY float64) {
 	end := start + angle
 	clockWise := true
 	if angle < 0 {
 		clockWise = false
 	}
 	ra := (math.Abs(rx) + math.Abs(ry)) / 2
-	da := math.Acos(ra/(ra+0.125/scale)) * 2
+	da := math.Acos(ra/(ra+tolerance)) * 2
 	//normalize
 	if !clockWise {
 		da = -da
@@ -382,5 +431,5 @@ func unfix(x fixed.Int26_6) float64 {
 }
 
 func fixp(x, y float64) fixed.Point26_6 {
-	return fixed.Point26_6{fix(x), fix(y)}
+	return fixed.Point26_6{X: fix(x), Y: fix(y)}
 }
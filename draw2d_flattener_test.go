@@ -0,0 +1,64 @@
+package canvas
+
+import (
+	"math"
+	"testing"
+)
+
+// TestDefaultFlattening checks that curves are flattened at the thresholds
+// they were before the tolerance could be set.
+func TestDefaultFlattening(t *testing.T) {
+	if q := quadFlatteningThreshold(DefaultFlatteningTolerance); q != 0.5 {
+		t.Errorf("quad threshold %v, want 0.5", q)
+	}
+	if c := cubicFlatteningThreshold(DefaultFlatteningTolerance); c != 0.5 {
+		t.Errorf("cubic threshold %v, want 0.5", c)
+	}
+	if a := arcTolerance(DefaultFlatteningTolerance); a != 0.125 {
+		t.Errorf("arc tolerance %v, want 0.125", a)
+	}
+	if q := quadFlatteningThreshold(1); math.Abs(q-4) > 1e-12 {
+		t.Errorf("quad threshold of 1 pixel %v, want 4", q)
+	}
+}
+
+// TestArcAngleTolerance adds a circle to the path of a context at several
+// tolerances and scales, its segments are within the tolerance in device
+// pixels.
+func TestArcAngleTolerance(t *testing.T) {
+	tests := []struct {
+		tolerance, scale float64
+	}{
+		{DefaultFlatteningTolerance, 1},
+		{DefaultFlatteningTolerance, 4},
+		{2, 1},
+		{0.05, 1},
+		{1, 0.25},
+	}
+	for _, tt := range tests {
+		gc := NewGraphicContext2D(10, 10)
+		gc.SetFlatteningTolerance(tt.tolerance)
+		gc.Scale(tt.scale, tt.scale)
+		gc.BeginPath()
+		gc.ArcAngle(0, 0, 50, 50, 0, 2*math.Pi)
+		p := gc.Current.Path
+		r := 50 * tt.scale
+		n := 0
+		for i, cmp := range p.Components {
+			if cmp != LineToCmp && (i > 0 || cmp != MoveToCmp) {
+				t.Fatalf("tolerance %v, scale %v: component %v", tt.tolerance, tt.scale, cmp)
+			}
+			x, y := p.Points[2*i], p.Points[2*i+1]
+			if d := math.Abs(math.Hypot(x, y) - r); d > 1e-9 {
+				t.Errorf("tolerance %v, scale %v: point %v,%v off the circle", tt.tolerance, tt.scale, x, y)
+			}
+			n++
+		}
+		// the segments of n points are r*(1-cos(pi/n)) from the circle
+		if d := r * (1 - math.Cos(math.Pi/float64(n-1))); d > tt.tolerance {
+			t.Errorf("tolerance %v, scale %v: %d points are %v from the circle", tt.tolerance, tt.scale, n, d)
+		} else if d < tt.tolerance/20 {
+			t.Errorf("tolerance %v, scale %v: %d points are %v from the circle, too many", tt.tolerance, tt.scale, n, d)
+		}
+	}
+}
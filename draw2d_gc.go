@@ -21,20 +21,58 @@ type GraphicContext2D struct {
 	img              *image.RGBA
 	fillRasterizer   *raster.Rasterizer
 	strokeRasterizer *raster.Rasterizer
-	painter          *RGBAPainter
+	painter          canvasPainter
 	DPI              int
+	fonts            *FontDB
+	deep             deepImage // the image of a context of more than 8 bits
+	workers          int
+	damage           []image.Rectangle
+	super            *superRasterizer // of AntialiasHigh
+}
+
+// canvasPainter paints the spans of a GraphicContext2D into its image.
+type canvasPainter interface {
+	raster.Painter
+	SetMask(mask *image.Alpha)
+	SetGlobalAlpha(alpha float64)
+	SetPattern(p Pattern, m Matrix)
+	SetCompositeOperation(op CompositeOperation)
+	SetShadow(offsetX, offsetY, blur float64, clr color.Color)
+	SetLinearLight(linear bool)
+	LinearLight() bool
+	Begin()
+	End()
+	damage() image.Rectangle
+	shadowCache() *shadowCache
+}
+
+// Image returns the image of the context, a context of more than 8 bits
+// per channel is converted down on every call.
+func (gc *GraphicContext2D) Image() image.Image {
+	return gc.rgba()
 }
 
-func (gc *GraphicContext2D) Image() image.Image {
+func (gc *GraphicContext2D) rgba() *image.RGBA {
+	if gc.deep != nil {
+		return toRGBA(gc.deep)
+	}
+	return gc.img
+}
+
+// target returns the image drawn into.
+func (gc *GraphicContext2D) target() draw.Image {
+	if gc.deep != nil {
+		return gc.deep
+	}
 	return gc.img
 }
 
 func (gc *GraphicContext2D) SubImage(r image.Rectangle) image.Image {
-	return gc.img.SubImage(r)
+	return gc.rgba().SubImage(r)
 }
 
 func (gc *GraphicContext2D) GetImageData(x, y, width, height int) image.Image {
-	return gc.img.SubImage(image.Rect(x, y, x+width, y+height))
+	return gc.rgba().SubImage(image.Rect(x, y, x+width, y+height))
 }
 
 // ImageFilter defines the type of filter to use
@@ -53,6 +91,14 @@ func NewGraphicContext2D(width, height int) *GraphicContext2D {
 	return NewGraphicContext2DForImage(image.NewRGBA(image.Rect(0, 0, width, height)))
 }
 
+// NewGraphicContext2DWithFonts creates a context that resolves fonts in db
+// instead of the default font database.
+func NewGraphicContext2DWithFonts(width, height int, db *FontDB) *GraphicContext2D {
+	gc := NewGraphicContext2D(width, height)
+	gc.fonts = db
+	return gc
+}
+
 // NewContextForImage copies the specified image into a new image.RGBA
 // and prepares a context for rendering onto that image.
 func NewGraphicContext2DForImage(im image.Image) *GraphicContext2D {
@@ -67,10 +113,68 @@ func NewGraphicContext2DForImage(im image.Image) *GraphicContext2D {
 		raster.NewRasterizer(width, height),
 		NewRGBAPainter(img),
 		72,
+		nil,
+		nil,
+		0,
+		nil,
+		nil,
 	}
 	return gc
 }
 
+// NewGraphicContext2DForRGBA64 returns a context drawing into img with 16
+// bits per channel.
+func NewGraphicContext2DForRGBA64(img *image.RGBA64) *GraphicContext2D {
+	return newDeepGraphicContext2D(rgba64Image{img})
+}
+
+// NewGraphicContext2DForFloat returns a context drawing into img with
+// float32 channels, translucent layers are composited without banding.
+func NewGraphicContext2DForFloat(img *FloatRGBA) *GraphicContext2D {
+	return newDeepGraphicContext2D(img)
+}
+
+func newDeepGraphicContext2D(img deepImage) *GraphicContext2D {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	return &GraphicContext2D{
+		StackGraphicContext: NewStackGraphicContext(),
+		width:               width,
+		height:              height,
+		fillRasterizer:      raster.NewRasterizer(width, height),
+		strokeRasterizer:    raster.NewRasterizer(width, height),
+		painter:             newDeepPainter(img),
+		DPI:                 72,
+		deep:                img,
+	}
+}
+
+// SetFontDatabase sets the font database used by text drawing, nil restores
+// the default font database.
+func (gc *GraphicContext2D) SetFontDatabase(db *FontDB) {
+	gc.fonts = db
+}
+
+// FontDatabase returns the font database used by text drawing.
+func (gc *GraphicContext2D) FontDatabase() *FontDB {
+	if gc.fonts == nil {
+		return FontDatabase()
+	}
+	return gc.fonts
+}
+
+// SetLinearLight sets whether the coverage of antialiased edges, the global
+// alpha and the composite operations are applied in linear light. It is
+// off by default, blending the sRGB values like browsers do. Images drawn
+// by DrawImage are blended in sRGB.
+func (gc *GraphicContext2D) SetLinearLight(linear bool) {
+	gc.painter.SetLinearLight(linear)
+}
+
+// LinearLight reports whether blending is in linear light.
+func (gc *GraphicContext2D) LinearLight() bool {
+	return gc.painter.LinearLight()
+}
+
 func (gc *GraphicContext2D) Width() float64 {
 	return float64(gc.width)
 }
@@ -90,7 +194,8 @@ func (gc *GraphicContext2D) Clear(clr color.Color) {
 		clr = color.Transparent
 	}
 	src := image.NewUniform(clr)
-	draw.Draw(gc.img, gc.img.Bounds(), src, image.ZP, draw.Src)
+	draw.Draw(gc.target(), gc.target().Bounds(), src, image.ZP, draw.Src)
+	gc.addDamage(gc.target().Bounds())
 	gc.Current.Path.Clear()
 }
 
@@ -119,50 +224,243 @@ func (gc *GraphicContext2D) StrokeRect(x, y, w, h float64) {
 	gc.stroke(p)
 }
 
-// TODO AlignTop and AlignBottom
 func (gc *GraphicContext2D) CreateTextPath(text string, x float64, y float64) *Path {
-	p := NewPath()
+	p, _, _, _ := gc.textPath(text, x, y, nil)
+	p.Transfrom(gc.Current.Tr)
+	return p
+}
+
+// textPath returns the outlines of text in user space, with the start of the
+// alphabetic baseline and the advance width after alignment.
+func (gc *GraphicContext2D) textPath(text string, x, y float64, m *FontMetrics) (p *Path, x0, y0, width float64) {
+	if gc.Current.WritingMode.IsVertical() {
+		return gc.verticalTextPath(text, x, y, m)
+	}
+	p = NewPath()
 	if gc.Current.TextBaseline != AlignAlphabetic {
-		m, err := p.MetricsFont(gc.Current.Font)
-		if m != nil && err == nil {
-			switch gc.Current.TextBaseline {
-			case AlignTop:
-				y += fUnitsToFloat64(m.Ascent)
-			case AlignHanging:
-				y += fUnitsToFloat64(m.Ascent)
-			case AlignMiddle:
-				y += fUnitsToFloat64(m.Ascent)/2 - fUnitsToFloat64(m.Descent)/2
-			case AlignIdeographic:
-				y -= fUnitsToFloat64(m.Descent)
-			case AlignBottom:
-				y -= fUnitsToFloat64(m.Descent)
-			}
+		if m == nil {
+			m = gc.FontMetrics()
+		}
+		if m != nil {
+			y += baselineOffset(gc.Current.TextBaseline, m)
 		}
 	}
-	size := p.AddText(text, x, y, gc.Current.Font)
+	width = p.AddTextByDB(text, x, y, gc.Current.Font, gc.fonts)
 	if gc.Current.TextAlign == AlignRight {
-		p.Translate(-size, 0)
+		p.Translate(-width, 0)
+		x -= width
 	} else if gc.Current.TextAlign == AlignCenter {
-		size = size / 2
-		p.Translate(-size, 0)
+		p.Translate(-width/2, 0)
+		x -= width / 2
 	}
-	p.Transfrom(gc.Current.Tr)
-	return p
+	return p, x, y, width
+}
+
+// verticalTextPath returns the outlines of text set vertically, with the
+// start of the alphabetic baseline of rotated text and the advance height
+// after alignment.
+func (gc *GraphicContext2D) verticalTextPath(text string, x, y float64, m *FontMetrics) (p *Path, x0, y0, height float64) {
+	p = NewPath()
+	if m == nil {
+		m = gc.FontMetrics()
+	}
+	if m == nil {
+		return p, x, y, 0
+	}
+	// center of the line
+	switch gc.Current.TextBaseline {
+	case AlignTop, AlignHanging:
+		x -= (m.Ascent + m.Descent) / 2
+	case AlignIdeographic, AlignBottom:
+		x += (m.Ascent + m.Descent) / 2
+	case AlignAlphabetic:
+		x += (m.Ascent - m.Descent) / 2
+	}
+	height = p.AddVerticalTextByDB(text, x, y, gc.Current.Font, gc.fonts)
+	if gc.Current.TextAlign == AlignRight {
+		p.Translate(0, -height)
+		y -= height
+	} else if gc.Current.TextAlign == AlignCenter {
+		p.Translate(0, -height/2)
+		y -= height / 2
+	}
+	return p, x - (m.Ascent-m.Descent)/2, y, height
 }
 
 func (gc *GraphicContext2D) FillText(text string, x float64, y float64) {
-	p := gc.CreateTextPath(text, x, y)
-	gc.fill(p)
+	if bf, k := gc.fonts.bitmapFont(gc.Current.Font); bf != nil {
+		gc.drawBitmapText(bf, k, text, x, y, gc.Current.FillPattern)
+		return
+	}
+	gc.drawText(text, x, y, gc.Current.FillPattern, gc.fill)
 }
 
+// StrokeText strokes the outlines of text, the text of a bitmap font is
+// filled with the stroke style.
 func (gc *GraphicContext2D) StrokeText(text string, x float64, y float64) {
-	p := gc.CreateTextPath(text, x, y)
-	gc.stroke(p)
+	if bf, k := gc.fonts.bitmapFont(gc.Current.Font); bf != nil {
+		gc.drawBitmapText(bf, k, text, x, y, gc.Current.StrokePattern)
+		return
+	}
+	gc.drawText(text, x, y, gc.Current.StrokePattern, gc.stroke)
+}
+
+// drawBitmapText blits text in a bitmap font scaled by k at the nearest
+// pixel, the transform only moves the text.
+func (gc *GraphicContext2D) drawBitmapText(bf *BitmapFont, k int, text string, x, y float64, pattern Pattern) {
+	m := bf.metrics(k)
+	width := float64(bf.Advance(text) * k)
+	y += baselineOffset(gc.Current.TextBaseline, m)
+	if gc.Current.TextAlign == AlignRight {
+		x -= width
+	} else if gc.Current.TextAlign == AlignCenter {
+		x -= width / 2
+	}
+	d := &gc.Current.TextDecoration
+	under, through := decorationPaths(d, m, nil, x, y, width)
+	decoration := pattern
+	if d.Color != nil {
+		decoration = NewSolidPattern(d.Color)
+	}
+	gc.fillDecoration(under, decoration)
+	dx, dy := gc.Current.Tr.TransformPoint(x, y)
+	gc.paintMask(bf.textMask(text, k), int(math.Round(dx)), int(math.Round(dy)), pattern)
+	gc.fillDecoration(through, decoration)
+}
+
+// paintMask paints pattern through the opaque pixels of mask moved by
+// (dx, dy), without anti-aliasing.
+func (gc *GraphicContext2D) paintMask(mask *image.Alpha, dx, dy int, pattern Pattern) {
+	var spans []raster.Span
+	b := mask.Rect
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row := mask.Pix[mask.PixOffset(b.Min.X, y):mask.PixOffset(b.Max.X, y)]
+		for x := 0; x < len(row); {
+			if row[x] == 0 {
+				x++
+				continue
+			}
+			x0 := x
+			for x < len(row) && row[x] != 0 {
+				x++
+			}
+			spans = append(spans, raster.Span{Y: y + dy, X0: b.Min.X + x0 + dx, X1: b.Min.X + x + dx, Alpha: 0xffff})
+		}
+	}
+	gc.painter.SetMask(gc.Current.mask)
+	gc.painter.SetGlobalAlpha(gc.Current.GlobalAlpha)
+	gc.painter.SetPattern(pattern, gc.Current.Tr)
+	gc.painter.SetCompositeOperation(gc.Current.GlobalCompositeOperation)
+	gc.painter.SetShadow(gc.Current.ShadowOffsetX, gc.Current.ShadowOffsetY, gc.Current.ShadowBlur, gc.Current.ShadowColor)
+	gc.painter.Begin()
+	gc.painter.Paint(spans, true)
+	gc.painter.End()
+	gc.addDamage(gc.painter.damage())
+}
+
+// FillTextOnPath fills text set along path, starting at offset from its
+// start for AlignLeft, centered on offset for AlignCenter or ending at it
+// for AlignRight. The text is not decorated.
+func (gc *GraphicContext2D) FillTextOnPath(text string, path *Path, offset float64, side TextPathSide) {
+	gc.fill(gc.textOnPath(text, path, offset, side))
+}
+
+// StrokeTextOnPath strokes text set along path like FillTextOnPath.
+func (gc *GraphicContext2D) StrokeTextOnPath(text string, path *Path, offset float64, side TextPathSide) {
+	gc.stroke(gc.textOnPath(text, path, offset, side))
+}
+
+func (gc *GraphicContext2D) textOnPath(text string, path *Path, offset float64, side TextPathSide) *Path {
+	p := textOnPath(text, path, offset, side, gc.Current.TextAlign, gc.Current.TextBaseline, gc.Current.Font, gc.fonts)
+	p.Transfrom(gc.Current.Tr)
+	return p
+}
+
+// FillGlyphs fills the glyphs of run with its alphabetic baseline starting
+// at (x, y), the text align and baseline do not apply.
+func (gc *GraphicContext2D) FillGlyphs(run *GlyphRun, x, y float64) {
+	gc.fill(gc.glyphsPath(run, x, y))
+}
+
+// StrokeGlyphs strokes the glyphs of run like FillGlyphs.
+func (gc *GraphicContext2D) StrokeGlyphs(run *GlyphRun, x, y float64) {
+	gc.stroke(gc.glyphsPath(run, x, y))
 }
 
+func (gc *GraphicContext2D) glyphsPath(run *GlyphRun, x, y float64) *Path {
+	p := NewPath()
+	p.AddGlyphs(run, x, y)
+	p.Transfrom(gc.Current.Tr)
+	return p
+}
+
+// drawText draws text with draw and its decoration filled with pattern.
+func (gc *GraphicContext2D) drawText(text string, x, y float64, pattern Pattern, draw func(paths ...*Path)) {
+	d := &gc.Current.TextDecoration
+	if d.Line == DecorationNone {
+		draw(gc.CreateTextPath(text, x, y))
+		return
+	}
+	m := gc.FontMetrics()
+	p, x0, y0, width := gc.textPath(text, x, y, m)
+	var under, through *Path
+	if gc.Current.WritingMode.IsVertical() {
+		// the lines of rotated text, ink is not skipped around upright glyphs
+		under, through = decorationPaths(d, m, nil, 0, 0, width)
+		rotate := Matrix{0, 1, -1, 0, x0, y0}
+		for _, l := range []*Path{under, through} {
+			if l != nil {
+				l.Transfrom(rotate)
+			}
+		}
+	} else {
+		under, through = decorationPaths(d, m, p, x0, y0, width)
+	}
+	if d.Color != nil {
+		pattern = NewSolidPattern(d.Color)
+	}
+	gc.fillDecoration(under, pattern)
+	p.Transfrom(gc.Current.Tr)
+	draw(p)
+	gc.fillDecoration(through, pattern)
+}
+
+func (gc *GraphicContext2D) fillDecoration(p *Path, pattern Pattern) {
+	if p == nil {
+		return
+	}
+	p.Transfrom(gc.Current.Tr)
+	fillPattern, fillRule := gc.Current.FillPattern, gc.Current.FillRule
+	gc.Current.FillPattern, gc.Current.FillRule = pattern, FillRuleWinding
+	gc.fill(p)
+	gc.Current.FillPattern, gc.Current.FillRule = fillPattern, fillRule
+}
+
+// MeasureText returns the advance of text drawn by FillText, kerning
+// included.
 func (gc *GraphicContext2D) MeasureText(text string) float64 {
+	if bf, k := gc.fonts.bitmapFont(gc.Current.Font); bf != nil {
+		return float64(bf.Advance(text) * k)
+	}
 	p := NewPath()
-	return p.MeasureText(text, gc.Current.Font)
+	if gc.Current.WritingMode.IsVertical() {
+		return p.MeasureVerticalTextByDB(text, gc.Current.Font, gc.fonts)
+	}
+	return p.MeasureTextByDB(text, gc.Current.Font, gc.fonts)
+}
+
+// FontMetrics returns the metrics of the current font, or nil if the font
+// is not found.
+func (gc *GraphicContext2D) FontMetrics() *FontMetrics {
+	if bf, k := gc.fonts.bitmapFont(gc.Current.Font); bf != nil {
+		return bf.metrics(k)
+	}
+	p := NewPath()
+	m, err := p.FontMetricsByDB(gc.Current.Font, gc.fonts)
+	if err != nil {
+		return nil
+	}
+	return m
 }
 
 // DrawImage draws an image into dest using an affine transformation matrix, an op and a filter
@@ -200,7 +498,8 @@ func (gc *GraphicContext2D) DrawImage(img image.Image, dx float64, dy float64) {
 			src.Pix[i+3] = uint8(float64(src.Pix[i+3]) * gc.Current.GlobalAlpha)
 		}
 	}
-	DrawImage(src, gc.Current.mask, gc.img, tr, draw.Over, BilinearFilter)
+	DrawImage(src, gc.Current.mask, gc.target(), tr, draw.Over, BilinearFilter)
+	gc.addDamage(imageDamage(tr, src.Rect.Dx(), src.Rect.Dy()))
 }
 
 func toRect(x, y, w, h float64) image.Rectangle {
@@ -222,7 +521,8 @@ func (gc *GraphicContext2D) DrawImageEx(img image.Image, sx, sy, sw, sh, dx, dy,
 			src.Pix[i+3] = uint8(float64(src.Pix[i+3]) * gc.Current.GlobalAlpha)
 		}
 	}
-	DrawImage(src, gc.Current.mask, gc.img, tr, draw.Over, BilinearFilter)
+	DrawImage(src, gc.Current.mask, gc.target(), tr, draw.Over, BilinearFilter)
+	gc.addDamage(imageDamage(tr, src.Rect.Dx(), src.Rect.Dy()))
 }
 
 func (gc *GraphicContext2D) DrawContext2D(cv Context2D, dx float64, dy float64) {
@@ -301,7 +601,13 @@ func (gc *GraphicContext2D) stroke(paths ...*Path) {
 	stroker := &LineStroker{}
 	stroker.Cap = gc.Current.Cap
 	stroker.Join = gc.Current.Join
-	stroker.Flattener = &FtLineBuilder{Adder: gc.strokeRasterizer}
+	var adder raster.Adder = gc.strokeRasterizer
+	var lines *lineRecorder
+	if gc.parallel() || gc.Current.Antialias != AntialiasDefault {
+		lines = &lineRecorder{}
+		adder = lines
+	}
+	stroker.Flattener = &FtLineBuilder{Adder: adder}
 	stroker.HalfLineWidth = gc.Current.LineWidth / 2
 	stroker.MiterLimitCheck = gc.Current.MiterLimit * gc.Current.LineWidth
 
@@ -334,7 +640,7 @@ func (gc *GraphicContext2D) stroke(paths ...*Path) {
 		if offsetx != 0 || offsety != 0 {
 			p = p.Translated(offsetx, offsety)
 		}
-		Flatten(p, liner, 1)
+		gc.flatten(p, liner)
 	}
 	gc.painter.SetMask(gc.Current.mask)
 	gc.painter.SetGlobalAlpha(gc.Current.GlobalAlpha)
@@ -342,9 +648,9 @@ func (gc *GraphicContext2D) stroke(paths ...*Path) {
 	gc.painter.SetCompositeOperation(gc.Current.GlobalCompositeOperation)
 	gc.painter.SetShadow(gc.Current.ShadowOffsetX, gc.Current.ShadowOffsetY, gc.Current.ShadowBlur, gc.Current.ShadowColor)
 	gc.painter.Begin()
-	gc.strokeRasterizer.Rasterize(gc.painter)
-	gc.strokeRasterizer.Clear()
+	gc.rasterize(gc.strokeRasterizer, lines, gc.painter)
 	gc.painter.End()
+	gc.addDamage(gc.painter.damage())
 }
 
 // Fill fills the paths with the color specified by SetFillColor
@@ -352,6 +658,31 @@ func (gc *GraphicContext2D) Fill() {
 	gc.fill(gc.Current.Path)
 }
 
+// SetFlatteningTolerance sets the distance in device pixels that curves
+// may be from the segments they are filled and stroked as, trading their
+// smoothness for speed. Arcs are flattened when they are added to the path,
+// at the tolerance set then. tolerance <= 0 restores
+// DefaultFlatteningTolerance.
+func (gc *GraphicContext2D) SetFlatteningTolerance(tolerance float64) {
+	if tolerance <= 0 {
+		tolerance = DefaultFlatteningTolerance
+	}
+	gc.tolerance = tolerance
+}
+
+// FlatteningTolerance returns the distance in device pixels that curves may
+// be from the segments they are filled and stroked as.
+func (gc *GraphicContext2D) FlatteningTolerance() float64 {
+	return gc.tolerance
+}
+
+// flatten flattens p within the tolerance of the context. The points of the
+// paths of the context are transformed as they are added, so the tolerance
+// applies as is whatever the current transform and antialiasing.
+func (gc *GraphicContext2D) flatten(p *Path, flattener Flattener) {
+	FlattenTolerance(p, flattener, 1, gc.tolerance)
+}
+
 func (gc *GraphicContext2D) HasShadow() bool {
 	_, _, _, a := gc.Current.ShadowColor.RGBA()
 	return a != 0 && (gc.Current.ShadowOffsetX != 0 || gc.Current.ShadowOffsetY != 0 || gc.Current.ShadowBlur != 0)
@@ -362,7 +693,13 @@ func (gc *GraphicContext2D) fill(paths ...*Path) {
 
 	/**** first method ****/
 	//flattener := draw2dbase.Transformer{Tr: gc.Current.Tr, Flattener: FtLineBuilder{Adder: gc.fillRasterizer}}
-	flattener := FtLineBuilder{Adder: gc.fillRasterizer}
+	var adder raster.Adder = gc.fillRasterizer
+	var lines *lineRecorder
+	if gc.parallel() || gc.Current.Antialias != AntialiasDefault {
+		lines = &lineRecorder{}
+		adder = lines
+	}
+	flattener := FtLineBuilder{Adder: adder}
 	hasShadow := gc.HasShadow()
 	var offsetx float64
 	var offsety float64
@@ -391,7 +728,7 @@ func (gc *GraphicContext2D) fill(paths ...*Path) {
 		if offsetx != 0 || offsety != 0 {
 			p = p.Translated(offsetx, offsety)
 		}
-		Flatten(p, flattener, gc.Current.Tr.GetScale())
+		gc.flatten(p, flattener)
 	}
 	gc.painter.SetMask(gc.Current.mask)
 	gc.painter.SetGlobalAlpha(gc.Current.GlobalAlpha)
@@ -399,9 +736,9 @@ func (gc *GraphicContext2D) fill(paths ...*Path) {
 	gc.painter.SetCompositeOperation(gc.Current.GlobalCompositeOperation)
 	gc.painter.SetShadow(gc.Current.ShadowOffsetX, gc.Current.ShadowOffsetY, gc.Current.ShadowBlur, gc.Current.ShadowColor)
 	gc.painter.Begin()
-	gc.fillRasterizer.Rasterize(gc.painter)
-	gc.fillRasterizer.Clear()
+	gc.rasterize(gc.fillRasterizer, lines, gc.painter)
 	gc.painter.End()
+	gc.addDamage(gc.painter.damage())
 }
 
 func (gc *GraphicContext2D) fillClip(painter raster.Painter, paths ...*Path) {
@@ -409,7 +746,13 @@ func (gc *GraphicContext2D) fillClip(painter raster.Painter, paths ...*Path) {
 
 	/**** first method ****/
 	//flattener := draw2dbase.Transformer{Tr: gc.Current.Tr, Flattener: FtLineBuilder{Adder: gc.fillRasterizer}}
-	flattener := FtLineBuilder{Adder: gc.fillRasterizer}
+	var adder raster.Adder = gc.fillRasterizer
+	var lines *lineRecorder
+	if gc.Current.Antialias != AntialiasDefault {
+		lines = &lineRecorder{}
+		adder = lines
+	}
+	flattener := FtLineBuilder{Adder: adder}
 	gc.fillRasterizer.Dx = 0
 	gc.fillRasterizer.Dy = 0
 	for _, p := range paths {
@@ -417,11 +760,9 @@ func (gc *GraphicContext2D) fillClip(painter raster.Painter, paths ...*Path) {
 			p = p.Copy()
 			p.Close()
 		}
-		Flatten(p, flattener, gc.Current.Tr.GetScale())
+		gc.flatten(p, flattener)
 	}
-
-	gc.fillRasterizer.Rasterize(painter)
-	gc.fillRasterizer.Clear()
+	gc.rasterize(gc.fillRasterizer, lines, painter)
 }
 
 // FillStroke first fills the paths and than strokes them
@@ -480,6 +821,9 @@ func (gc *GraphicContext2D) CreatePattern(img image.Image, op RepeatOp) Pattern
 	return newSurfacePattern(img, op)
 }
 
+// Clip intersects the clip with the current path. Drawing is mixed with the
+// canvas by the coverage of the clip, so operations that clear the canvas
+// around the source, like Copy, leave it as is outside of the clip.
 func (gc *GraphicContext2D) Clip() {
 	clip := image.NewAlpha(image.Rect(0, 0, gc.width, gc.height))
 	painter := NewAlphaOverPainter(clip)
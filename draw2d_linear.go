@@ -0,0 +1,105 @@
+package canvas
+
+import (
+	"image/color"
+	"math"
+)
+
+// Lookup tables between 8-bit sRGB and 16-bit linear light, the linear
+// values are indexed with 12 bits, which keeps the darks within one level
+// of sRGB.
+var (
+	srgbToLinear [256]uint16
+	linearToSRGB [1<<12 + 1]uint8
+)
+
+func init() {
+	for i := range srgbToLinear {
+		v := float64(i) / 0xff
+		if v <= 0.04045 {
+			v /= 12.92
+		} else {
+			v = math.Pow((v+0.055)/1.055, 2.4)
+		}
+		srgbToLinear[i] = uint16(v*0xffff + 0.5)
+	}
+	for i := range linearToSRGB {
+		v := float64(i) / (1 << 12)
+		if v <= 0.0031308 {
+			v *= 12.92
+		} else {
+			v = 1.055*math.Pow(v, 1/2.4) - 0.055
+		}
+		linearToSRGB[i] = uint8(math.Min(1, v)*0xff + 0.5)
+	}
+}
+
+// toLinear converts a premultiplied sRGB channel with alpha a to a
+// premultiplied linear one, both 16-bit.
+func toLinear(c, a uint32) uint32 {
+	const m = 1<<16 - 1
+	if a == 0 {
+		return 0
+	}
+	if a == m {
+		return uint32(srgbToLinear[c>>8])
+	}
+	c = c * m / a
+	if c > m {
+		c = m
+	}
+	return uint32(srgbToLinear[c>>8]) * a / m
+}
+
+// fromLinear converts a premultiplied linear channel with alpha a to a
+// premultiplied 8-bit sRGB one.
+func fromLinear(c, a uint32) uint8 {
+	const m = 1<<16 - 1
+	if a == 0 {
+		return 0
+	}
+	c = c * m / a
+	if c > m {
+		c = m
+	}
+	return uint8(uint32(linearToSRGB[(c+8)>>4]) * (a >> 8) / 0xff)
+}
+
+// blendLinear composites the premultiplied sRGB color (cr, cg, cb, ca)
+// with coverage ma over the pixel pix in linear light.
+func blendLinear(pix []uint8, cr, cg, cb, ca, ma uint32) {
+	const m = 1<<16 - 1
+	da := uint32(pix[3]) * 0x101
+	a := m - ca*ma/m
+	oa := (da*a + ca*ma) / m
+	pix[0] = fromLinear((toLinear(uint32(pix[0])*0x101, da)*a+toLinear(cr, ca)*ma)/m, oa)
+	pix[1] = fromLinear((toLinear(uint32(pix[1])*0x101, da)*a+toLinear(cg, ca)*ma)/m, oa)
+	pix[2] = fromLinear((toLinear(uint32(pix[2])*0x101, da)*a+toLinear(cb, ca)*ma)/m, oa)
+	pix[3] = uint8(oa >> 8)
+}
+
+// linearFRGBA returns the premultiplied linear color of c.
+func linearFRGBA(c color.RGBA) FRGBA {
+	a := uint32(c.A) * 0x101
+	return FRGBA{
+		float64(toLinear(uint32(c.R)*0x101, a)) / 0xffff,
+		float64(toLinear(uint32(c.G)*0x101, a)) / 0xffff,
+		float64(toLinear(uint32(c.B)*0x101, a)) / 0xffff,
+		float64(c.A) / 0xff,
+	}
+}
+
+// composeLinear composites a with b like op.ComposeRGBA in linear light.
+func composeLinear(op CompositeOperation, a, b color.RGBA) color.RGBA {
+	c := op.Compose(linearFRGBA(a), linearFRGBA(b))
+	clamp := func(v float64) uint32 {
+		return uint32(math.Max(0, math.Min(1, v))*0xffff + 0.5)
+	}
+	ca := clamp(c.A)
+	return color.RGBA{
+		fromLinear(clamp(c.R), ca),
+		fromLinear(clamp(c.G), ca),
+		fromLinear(clamp(c.B), ca),
+		uint8(ca >> 8),
+	}
+}
@@ -0,0 +1,94 @@
+package canvas
+
+import (
+	"image/color"
+	"testing"
+)
+
+// TestLinearTables converts every 8-bit sRGB value to linear light and
+// back.
+func TestLinearTables(t *testing.T) {
+	for v := 0; v < 256; v++ {
+		l := uint32(srgbToLinear[v])
+		if got := linearToSRGB[(l+8)>>4]; int(got) != v {
+			t.Errorf("sRGB %d is %d back from linear %#x", v, got, l)
+		}
+		if v > 0 && srgbToLinear[v] <= srgbToLinear[v-1] {
+			t.Errorf("linear %d is not above %d", v, v-1)
+		}
+	}
+	if srgbToLinear[0] != 0 || srgbToLinear[255] != 0xffff || srgbToLinear[188] < 0x7f00 || srgbToLinear[188] > 0x8100 {
+		t.Errorf("linear 0, 188, 255 = %#x, %#x, %#x", srgbToLinear[0], srgbToLinear[188], srgbToLinear[255])
+	}
+
+	// premultiplied channels come back within one level
+	for _, a := range []uint32{0xffff, 0x8080, 0x4040, 0x1010} {
+		for v := uint32(0); v < 256; v++ {
+			c := v * a / 0xff &^ 0xff
+			got := int(fromLinear(toLinear(c, a), a))
+			if d := got - int(c>>8); d < -1 || d > 1 {
+				t.Errorf("alpha %#x: %d is %d back from linear", a, c>>8, got)
+			}
+		}
+	}
+}
+
+func TestBlendLinear(t *testing.T) {
+	const m = 0xffff
+	tests := []struct {
+		name           string
+		dst            [4]uint8
+		cr, cg, cb, ca uint32 // premultiplied 16-bit sRGB
+		ma             uint32 // coverage
+		want           [4]uint8
+	}{
+		{"opaque", [4]uint8{10, 20, 30, 255}, m, 0, m / 2, m, m, [4]uint8{255, 0, 127, 255}},
+		{"no coverage", [4]uint8{10, 20, 30, 255}, m, m, m, m, 0, [4]uint8{10, 20, 30, 255}},
+		// half of white over black is half of the light, not mid gray
+		{"half coverage", [4]uint8{0, 0, 0, 255}, m, m, m, m, 0x8000, [4]uint8{188, 188, 188, 255}},
+		{"half alpha", [4]uint8{0, 0, 0, 255}, 0x8000, 0x8000, 0x8000, 0x8000, m, [4]uint8{188, 188, 188, 255}},
+		{"over transparent", [4]uint8{}, 0x8000, 0, 0, 0x8000, m, [4]uint8{128, 0, 0, 128}},
+		{"black over white", [4]uint8{255, 255, 255, 255}, 0, 0, 0, m, 0x8000, [4]uint8{188, 188, 188, 255}},
+	}
+	for _, tt := range tests {
+		pix := tt.dst
+		blendLinear(pix[:], tt.cr, tt.cg, tt.cb, tt.ca, tt.ma)
+		for i := range pix {
+			if d := int(pix[i]) - int(tt.want[i]); d < -1 || d > 1 {
+				t.Errorf("%s: %v, want %v", tt.name, pix, tt.want)
+				break
+			}
+		}
+	}
+}
+
+// TestLinearLight fills half transparent white over black with and without
+// linear light.
+func TestLinearLight(t *testing.T) {
+	tests := []struct {
+		linear bool
+		op     CompositeOperation
+		want   uint8
+	}{
+		{false, SourceOver, 128},
+		{true, SourceOver, 188},
+		{false, Lighter, 128},
+		{true, Lighter, 188},
+	}
+	for _, tt := range tests {
+		gc := NewGraphicContext2D(4, 4)
+		gc.SetFillColor(color.Black)
+		gc.FillRect(0, 0, 4, 4)
+		gc.SetLinearLight(tt.linear)
+		if gc.LinearLight() != tt.linear {
+			t.Errorf("LinearLight = %v, want %v", gc.LinearLight(), tt.linear)
+		}
+		gc.SetGlobalCompositeOperation(tt.op)
+		gc.SetFillColor(color.NRGBA{0xff, 0xff, 0xff, 0x80})
+		gc.FillRect(0, 0, 4, 4)
+		c := color.RGBAModel.Convert(gc.Image().At(1, 1)).(color.RGBA)
+		if d := int(c.R) - int(tt.want); d < -1 || d > 1 || c.A != 0xff {
+			t.Errorf("linear %v, %v: %v, want gray %d", tt.linear, tt.op, c, tt.want)
+		}
+	}
+}
@@ -1,12 +1,9 @@
 package canvas
 
 import (
-	"crypto/md5"
+	"github.com/golang/freetype/raster"
 	"image"
 	"image/color"
-
-	stackblur "github.com/esimov/stackblur-go"
-	"github.com/golang/freetype/raster"
 )
 
 type AlphaOverPainter struct {
@@ -65,10 +62,12 @@ type RGBAPainter struct {
 	Image         *image.RGBA
 	Mask          *image.Alpha
 	Op            CompositeOperation
-	empty         *image.RGBA
-	canvas        *image.RGBA
+	canvas        *image.RGBA // the image, or the layer
 	canvasOp      CompositeOperation
-	shadow        *image.RGBA
+	layer         *image.RGBA // the source, when it is not painted over directly
+	row           []uint8     // scratch rows
+	shadowRowBuf  []uint8
+	shadows       *shadowCache
 	spanRect      image.Rectangle
 	pattern       Pattern
 	solid         bool
@@ -79,12 +78,24 @@ type RGBAPainter struct {
 	shadowBlur    float64
 	shadowColor   color.Color
 	hasShadow     bool
+	linear        bool
 }
 
 func (r *RGBAPainter) SetGlobalAlpha(alpha float64) {
 	r.canvasAlpha = alpha
 }
 
+// SetLinearLight sets whether coverage and compositing are applied in
+// linear light instead of to the sRGB values like browsers do.
+func (r *RGBAPainter) SetLinearLight(linear bool) {
+	r.linear = linear
+}
+
+// LinearLight reports whether blending is in linear light.
+func (r *RGBAPainter) LinearLight() bool {
+	return r.linear
+}
+
 func (r *RGBAPainter) SetShadow(offsetX float64, offsetY float64, blur float64, clr color.Color) {
 	r.shadowOffsetX = offsetX
 	r.shadowOffsetY = offsetY
@@ -100,14 +111,16 @@ func (r *RGBAPainter) SetShadow(offsetX float64, offsetY float64, blur float64,
 
 // Paint satisfies the canvas interface.
 func (r *RGBAPainter) Paint(ss []raster.Span, done bool) {
+	// the mask scales the coverage of a source painted over directly, the
+	// layer is mixed with the image by it when it is composited
 	if r.solid {
-		if r.Mask != nil && !r.hasShadow {
+		if r.Mask != nil && r.canvas == r.Image {
 			r.paintSolidMask(ss, done)
 		} else {
 			r.paintSolid(ss, done)
 		}
 	} else {
-		if r.Mask != nil && !r.hasShadow {
+		if r.Mask != nil && r.canvas == r.Image {
 			r.paintPatternMask(ss, done)
 		} else {
 			r.paintPattern(ss, done)
@@ -115,6 +128,20 @@ func (r *RGBAPainter) Paint(ss []raster.Span, done bool) {
 	}
 }
 
+func (r *RGBAPainter) shadowCache() *shadowCache {
+	return r.shadows
+}
+
+func (r *RGBAPainter) fork() raster.Painter {
+	p := *r
+	p.row, p.shadowRowBuf = nil, nil
+	return &p
+}
+
+func (r *RGBAPainter) join(p raster.Painter) {
+	r.spanRect = unionSpanRect(r.spanRect, p.(*RGBAPainter).spanRect)
+}
+
 func (r *RGBAPainter) SetColor(c color.Color) {
 	r.solidColor = c
 	r.solid = true
@@ -158,6 +185,10 @@ func (r *RGBAPainter) paintSolid(ss []raster.Span, done bool) {
 		i1 := i0 + (s.X1-s.X0)*4
 		if r.canvasOp == SourceOver {
 			for i := i0; i < i1; i += 4 {
+				if r.linear {
+					blendLinear(r.canvas.Pix[i:i+4], cr, cg, cb, ca, ma)
+					continue
+				}
 				dr := uint32(r.canvas.Pix[i+0])
 				dg := uint32(r.canvas.Pix[i+1])
 				db := uint32(r.canvas.Pix[i+2])
@@ -169,12 +200,14 @@ func (r *RGBAPainter) paintSolid(ss []raster.Span, done bool) {
 				r.canvas.Pix[i+3] = uint8((da*a + ca*ma) / m >> 8)
 			}
 		} else {
-			for i := i0; i < i1; i += 4 {
-				r.canvas.Pix[i+0] = uint8(cr * ma / m >> 8)
-				r.canvas.Pix[i+1] = uint8(cg * ma / m >> 8)
-				r.canvas.Pix[i+2] = uint8(cb * ma / m >> 8)
-				r.canvas.Pix[i+3] = uint8(ca * ma / m >> 8)
+			row := r.spanRow(s.X1 - s.X0)
+			for i := 0; i < len(row); i += 4 {
+				row[i+0] = uint8(cr * ma / m >> 8)
+				row[i+1] = uint8(cg * ma / m >> 8)
+				row[i+2] = uint8(cb * ma / m >> 8)
+				row[i+3] = uint8(ca * ma / m >> 8)
 			}
+			r.composeSpan(r.canvasOp, r.canvas.Pix[i0:i1], row, nil)
 		}
 	}
 }
@@ -223,6 +256,10 @@ func (r *RGBAPainter) paintSolidMask(ss []raster.Span, done bool) {
 				if ma == 0 {
 					continue
 				}
+				if r.linear {
+					blendLinear(r.canvas.Pix[i:i+4], cr, cg, cb, ca, ma)
+					continue
+				}
 				dr := uint32(r.canvas.Pix[i+0])
 				dg := uint32(r.canvas.Pix[i+1])
 				db := uint32(r.canvas.Pix[i+2])
@@ -234,18 +271,17 @@ func (r *RGBAPainter) paintSolidMask(ss []raster.Span, done bool) {
 				r.canvas.Pix[i+3] = uint8((da*a + ca*ma) / m >> 8)
 			}
 		} else {
-			for i, x := i0, x0; i < i1; i, x = i+4, x+1 {
+			row := r.spanRow(s.X1 - s.X0)
+			for i, x := 0, x0; i < len(row); i, x = i+4, x+1 {
 				ma := s.Alpha
 				ma = uint32(float64(ma) * r.canvasAlpha)
 				ma = ma * uint32(r.Mask.AlphaAt(x, y).A) / 255
-				if ma == 0 {
-					continue
-				}
-				r.canvas.Pix[i+0] = uint8(cr * ma / m >> 8)
-				r.canvas.Pix[i+1] = uint8(cg * ma / m >> 8)
-				r.canvas.Pix[i+2] = uint8(cb * ma / m >> 8)
-				r.canvas.Pix[i+3] = uint8(ca * ma / m >> 8)
+				row[i+0] = uint8(cr * ma / m >> 8)
+				row[i+1] = uint8(cg * ma / m >> 8)
+				row[i+2] = uint8(cb * ma / m >> 8)
+				row[i+3] = uint8(ca * ma / m >> 8)
 			}
+			r.composeSpan(r.canvasOp, r.canvas.Pix[i0:i1], row, nil)
 		}
 	}
 }
@@ -292,6 +328,10 @@ func (r *RGBAPainter) paintPattern(ss []raster.Span, done bool) {
 			for i, x := i0, x0; i < i1; i, x = i+4, x+1 {
 				c := r.pattern.ColorAt(x, y)
 				cr, cg, cb, ca := c.RGBA()
+				if r.linear {
+					blendLinear(r.canvas.Pix[i:i+4], cr, cg, cb, ca, ma)
+					continue
+				}
 				dr := uint32(r.canvas.Pix[i+0])
 				dg := uint32(r.canvas.Pix[i+1])
 				db := uint32(r.canvas.Pix[i+2])
@@ -303,14 +343,16 @@ func (r *RGBAPainter) paintPattern(ss []raster.Span, done bool) {
 				r.canvas.Pix[i+3] = uint8((da*a + ca*ma) / m >> 8)
 			}
 		} else {
-			for i, x := i0, x0; i < i1; i, x = i+4, x+1 {
+			row := r.spanRow(s.X1 - s.X0)
+			for i, x := 0, x0; i < len(row); i, x = i+4, x+1 {
 				c := r.pattern.ColorAt(x, y)
 				cr, cg, cb, ca := c.RGBA()
-				r.canvas.Pix[i+0] = uint8(cr * ma / m >> 8)
-				r.canvas.Pix[i+1] = uint8(cg * ma / m >> 8)
-				r.canvas.Pix[i+2] = uint8(cb * ma / m >> 8)
-				r.canvas.Pix[i+3] = uint8(ca * ma / m >> 8)
+				row[i+0] = uint8(cr * ma / m >> 8)
+				row[i+1] = uint8(cg * ma / m >> 8)
+				row[i+2] = uint8(cb * ma / m >> 8)
+				row[i+3] = uint8(ca * ma / m >> 8)
 			}
+			r.composeSpan(r.canvasOp, r.canvas.Pix[i0:i1], row, nil)
 		}
 	}
 }
@@ -361,6 +403,10 @@ func (r *RGBAPainter) paintPatternMask(ss []raster.Span, done bool) {
 				}
 				c := r.pattern.ColorAt(x, y)
 				cr, cg, cb, ca := c.RGBA()
+				if r.linear {
+					blendLinear(r.canvas.Pix[i:i+4], cr, cg, cb, ca, ma)
+					continue
+				}
 				dr := uint32(r.canvas.Pix[i+0])
 				dg := uint32(r.canvas.Pix[i+1])
 				db := uint32(r.canvas.Pix[i+2])
@@ -372,29 +418,29 @@ func (r *RGBAPainter) paintPatternMask(ss []raster.Span, done bool) {
 				r.canvas.Pix[i+3] = uint8((da*a + ca*ma) / m >> 8)
 			}
 		} else {
-			for i, x := i0, x0; i < i1; i, x = i+4, x+1 {
+			row := r.spanRow(s.X1 - s.X0)
+			for i, x := 0, x0; i < len(row); i, x = i+4, x+1 {
 				ma := s.Alpha
 				ma = uint32(float64(ma) * r.canvasAlpha)
 				ma = ma * uint32(r.Mask.AlphaAt(x, y).A) / 255
 				if ma == 0 {
+					row[i+0], row[i+1], row[i+2], row[i+3] = 0, 0, 0, 0
 					continue
 				}
 				c := r.pattern.ColorAt(x, y)
 				cr, cg, cb, ca := c.RGBA()
-				r.canvas.Pix[i+0] = uint8((cr * ma) / m >> 8)
-				r.canvas.Pix[i+1] = uint8((cg * ma) / m >> 8)
-				r.canvas.Pix[i+2] = uint8((cb * ma) / m >> 8)
-				r.canvas.Pix[i+3] = uint8((ca * ma) / m >> 8)
+				row[i+0] = uint8((cr * ma) / m >> 8)
+				row[i+1] = uint8((cg * ma) / m >> 8)
+				row[i+2] = uint8((cb * ma) / m >> 8)
+				row[i+3] = uint8((ca * ma) / m >> 8)
 			}
+			r.composeSpan(r.canvasOp, r.canvas.Pix[i0:i1], row, nil)
 		}
 	}
 }
 
 func NewRGBAPainter(img *image.RGBA) *RGBAPainter {
-	r := &RGBAPainter{Image: img, canvasAlpha: 1.0, Op: SourceOver}
-	r.empty = image.NewRGBA(img.Rect)
-	r.canvas = image.NewRGBA(img.Rect)
-	return r
+	return &RGBAPainter{Image: img, canvas: img, canvasAlpha: 1.0, Op: SourceOver, shadows: newShadowCache(defaultShadowCacheSize)}
 }
 
 func (r *RGBAPainter) SetMask(mask *image.Alpha) {
@@ -425,13 +471,13 @@ func (r *RGBAPainter) Begin() {
 	r.spanRect.Min.Y = 1e9
 	r.spanRect.Max.X = -1e9
 	r.spanRect.Max.Y = -1e9
-	if !r.hasShadow {
-		switch r.Op {
-		case SourceOver:
-			r.canvas = r.Image
-			r.canvasOp = SourceOver
-			return
-		}
+	if !r.hasShadow && boundedOp(r.Op) && (r.Mask == nil || r.Op != Lighter) {
+		// the source is composited span by span, the destination is left
+		// as is around it. Lighter saturates, its clip can not scale the
+		// coverage.
+		r.canvas = r.Image
+		r.canvasOp = r.Op
+		return
 	}
 	rect := r.Image.Rect
 	if r.hasShadow {
@@ -446,178 +492,169 @@ func (r *RGBAPainter) Begin() {
 			rect.Max.Y -= int(r.shadowOffsetY)
 		}
 	}
-	r.canvas = image.NewRGBA(rect)
+	// the layer is transparent between draws, it is reused while the
+	// shadow offset is the same
+	if r.layer == nil || r.layer.Rect != rect {
+		r.layer = image.NewRGBA(rect)
+	}
+	r.canvas = r.layer
 	r.canvasOp = Copy
 }
 
-type blur_info struct {
-	offsetX int
-	offsetY int
-	blur    int
-	sum     [16]byte
-	rect    image.Rectangle
+// shadowMask returns the alpha of the layer around the source, blurred
+// and moved by the shadow offset, negative or not.
+func (r *RGBAPainter) shadowMask() *image.Alpha {
+	sigma := shadowSigma(r.shadowBlur)
+	rect := spanDamage(r.spanRect, false, 0, 0, 0).Inset(-blurExtent(sigma)).Intersect(r.layer.Rect)
+	a := image.NewAlpha(rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		src := r.layer.Pix[r.layer.PixOffset(rect.Min.X, y):]
+		dst := a.Pix[a.PixOffset(rect.Min.X, y):a.PixOffset(rect.Max.X, y)]
+		for x := range dst {
+			dst[x] = src[4*x+3]
+		}
+	}
+	return moveAlpha(r.shadows.blur(a, sigma), rect.Min.Add(image.Pt(int(r.shadowOffsetX), int(r.shadowOffsetY))))
 }
 
-var (
-	blurCache = make(map[blur_info]image.Image)
-)
+func (r *RGBAPainter) End() {
+	if r.canvas == r.Image {
+		return
+	}
+	r.composeLayer()
+	r.clearLayer()
+}
 
-func (r *RGBAPainter) blur(src *image.RGBA) image.Image {
-	sum := md5.Sum(src.Pix)
-	info := blur_info{
-		int(r.shadowOffsetX),
-		int(r.shadowOffsetY),
-		int(r.shadowBlur),
-		sum,
-		r.canvas.Rect,
+// composeLayer composites the shadow of the layer, if any, and the layer
+// over the image row by row, mixed with the image by the mask of the clip.
+// Bounded operations only touch the rectangle of the source and its shadow,
+// the others clear the rest of the image inside the clip and leave it as is
+// outside.
+func (r *RGBAPainter) composeLayer() {
+	b := r.Image.Rect
+	var shadow *image.Alpha
+	rect := spanDamage(r.spanRect, r.hasShadow, r.shadowOffsetX, r.shadowOffsetY, blurExtent(shadowSigma(r.shadowBlur)))
+	if r.hasShadow {
+		shadow = r.shadowMask()
 	}
-	if img, ok := blurCache[info]; ok {
-		return img
+	rect = rect.Intersect(b)
+	rows := b
+	if boundedOp(r.Op) {
+		rows = rect
+	}
+	x0, x1 := rect.Min.X-b.Min.X, rect.Max.X-b.Min.X
+	clearOut := func(dst, mask []uint8) {
+		if shadow != nil {
+			// the shadow and the source are each composited in the clip
+			clearRow(dst, mask)
+		}
+		clearRow(dst, mask)
 	}
-	rect := image.Rect(0, 0, r.canvas.Rect.Dx(), r.canvas.Rect.Dy())
-	if r.shadowOffsetX < 0 {
-		rect.Min.X += int(r.shadowOffsetX)
-		rect.Max.X += int(r.shadowOffsetX)
+	for y := rows.Min.Y; y < rows.Max.Y; y++ {
+		dst := r.Image.Pix[r.Image.PixOffset(b.Min.X, y):][:4*b.Dx()]
+		var mask []uint8
+		if r.Mask != nil {
+			mask = r.Mask.Pix[r.Mask.PixOffset(b.Min.X, y):][:b.Dx()]
+		}
+		if y < rect.Min.Y || y >= rect.Max.Y {
+			clearOut(dst, mask)
+			continue
+		}
+		if !boundedOp(r.Op) {
+			clearOut(dst[:4*x0], subMask(mask, 0, x0))
+			clearOut(dst[4*x1:], subMask(mask, x1, b.Dx()))
+		}
+		dst, mask = dst[4*x0:4*x1], subMask(mask, x0, x1)
+		if shadow != nil {
+			r.composeSpan(r.Op, dst, r.shadowRow(shadow, y, rect.Min.X, rect.Max.X), mask)
+		}
+		r.composeSpan(r.Op, dst, r.layer.Pix[r.layer.PixOffset(rect.Min.X, y):][:4*rect.Dx()], mask)
 	}
-	if r.shadowOffsetY < 0 {
-		rect.Min.Y += int(r.shadowOffsetY)
-		rect.Max.Y += int(r.shadowOffsetY)
+}
+
+// clearLayer makes the pixels painted into the layer transparent again.
+func (r *RGBAPainter) clearLayer() {
+	if r.spanRect.Min.X > r.spanRect.Max.X {
+		return
 	}
-	var img image.Image
-	img = image.NewRGBA(rect)
-	copy(img.(*image.RGBA).Pix, src.Pix)
-	if r.shadowBlur > 0 {
-		img = stackblur.Process(img, uint32(r.shadowBlur))
+	rect := image.Rect(r.spanRect.Min.X, r.spanRect.Min.Y, r.spanRect.Max.X+1, r.spanRect.Max.Y+1).Intersect(r.layer.Rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		clearRow(r.layer.Pix[r.layer.PixOffset(rect.Min.X, y):][:4*rect.Dx()], nil)
 	}
-	blurCache[info] = img
-	return img
 }
 
-func (r *RGBAPainter) endShadow() {
-	shadow := r.blur(r.canvas)
-	dx, dy := r.Image.Rect.Dx(), r.Image.Rect.Dy()
+// shadowRow returns the pixels [x0, x1) of row y of the shadow in the
+// shadow color.
+func (r *RGBAPainter) shadowRow(shadow *image.Alpha, y, x0, x1 int) []uint8 {
 	const m = 1<<16 - 1
 	cr, cg, cb, ca := r.shadowColor.RGBA()
-	var ma uint32
-	switch r.Op {
-	case SourceAtop, SourceOver, DestinationOver, DestinationOut, Lighter, Xor:
-		overRect := r.spanRect.Add(image.Point{int(r.shadowOffsetX), int(r.shadowOffsetY)})
-		overRect.Min.X -= int(r.shadowBlur)
-		overRect.Min.Y -= int(r.shadowBlur)
-		overRect.Max.X += int(r.shadowBlur)
-		overRect.Max.Y += int(r.shadowBlur)
-		overRect = overRect.Union(r.spanRect)
-		for y := 0; y < dy; y++ {
-			if y < overRect.Min.Y || y > overRect.Max.Y {
-				continue
-			}
-			for x := 0; x < dx; x++ {
-				if x < overRect.Min.X || x > overRect.Max.X {
-					continue
-				}
-				if r.Mask != nil && r.Mask.AlphaAt(x, y).A == 0 {
-					continue
-				}
-				if int(r.shadowBlur) == 0 {
-					i0 := shadow.(*image.RGBA).PixOffset(x, y)
-					ma = uint32(shadow.(*image.RGBA).Pix[i0+3]) << 8
-				} else {
-					i0 := shadow.(*image.NRGBA).PixOffset(x, y)
-					ma = uint32(shadow.(*image.NRGBA).Pix[i0+3]) << 8
-				}
-				r0 := uint8((cr * ma) / m >> 8)
-				g0 := uint8((cg * ma) / m >> 8)
-				b0 := uint8((cb * ma) / m >> 8)
-				a0 := uint8((ca * ma) / m >> 8)
-				shc := color.RGBA{r0, g0, b0, a0}
-				i := r.canvas.PixOffset(x, y)
-				src := color.RGBA{r.canvas.Pix[i+0], r.canvas.Pix[i+1], r.canvas.Pix[i+2], r.canvas.Pix[i+3]}
-				i = r.Image.PixOffset(x, y)
-				dst := color.RGBA{r.Image.Pix[i+0], r.Image.Pix[i+1], r.Image.Pix[i+2], r.Image.Pix[i+3]} //r.Image.At(x, y)
-				dst = r.Op.ComposeRGBA(shc, dst)
-				rgba := r.Op.ComposeRGBA(src, dst)
-				r.Image.Pix[i] = rgba.R
-				r.Image.Pix[i+1] = rgba.G
-				r.Image.Pix[i+2] = rgba.B
-				r.Image.Pix[i+3] = rgba.A
-			}
-		}
-	default:
-		for y := 0; y < dy; y++ {
-			for x := 0; x < dx; x++ {
-				if r.Mask != nil && r.Mask.AlphaAt(x, y).A == 0 {
-					continue
-				}
-				if int(r.shadowBlur) == 0 {
-					i0 := shadow.(*image.RGBA).PixOffset(x, y)
-					ma = uint32(shadow.(*image.RGBA).Pix[i0+3]) << 8
-				} else {
-					i0 := shadow.(*image.NRGBA).PixOffset(x, y)
-					ma = uint32(shadow.(*image.NRGBA).Pix[i0+3]) << 8
-				}
-				r0 := uint8((cr * ma) / m >> 8)
-				g0 := uint8((cg * ma) / m >> 8)
-				b0 := uint8((cb * ma) / m >> 8)
-				a0 := uint8((ca * ma) / m >> 8)
-				shc := color.RGBA{r0, g0, b0, a0}
-				i := r.canvas.PixOffset(x, y)
-				src := color.RGBA{r.canvas.Pix[i+0], r.canvas.Pix[i+1], r.canvas.Pix[i+2], r.canvas.Pix[i+3]}
-				i = r.Image.PixOffset(x, y)
-				dst := color.RGBA{r.Image.Pix[i+0], r.Image.Pix[i+1], r.Image.Pix[i+2], r.Image.Pix[i+3]} //r.Image.At(x, y)
-				dst = r.Op.ComposeRGBA(shc, dst)
-				rgba := r.Op.ComposeRGBA(src, dst)
-				r.Image.Pix[i] = rgba.R
-				r.Image.Pix[i+1] = rgba.G
-				r.Image.Pix[i+2] = rgba.B
-				r.Image.Pix[i+3] = rgba.A
-			}
-		}
+	row := r.shadowBuf(x1 - x0)
+	clearRow(row, nil)
+	if y < shadow.Rect.Min.Y || y >= shadow.Rect.Max.Y {
+		return row
+	}
+	sx0, sx1 := x0, x1
+	if sx0 < shadow.Rect.Min.X {
+		sx0 = shadow.Rect.Min.X
 	}
+	if sx1 > shadow.Rect.Max.X {
+		sx1 = shadow.Rect.Max.X
+	}
+	for x := sx0; x < sx1; x++ {
+		ma := uint32(shadow.Pix[shadow.PixOffset(x, y)]) << 8
+		i := 4 * (x - x0)
+		row[i+0] = uint8((cr * ma) / m >> 8)
+		row[i+1] = uint8((cg * ma) / m >> 8)
+		row[i+2] = uint8((cb * ma) / m >> 8)
+		row[i+3] = uint8((ca * ma) / m >> 8)
+	}
+	return row
 }
 
-func (r *RGBAPainter) End() {
-	if r.hasShadow {
-		r.endShadow()
+// composeSpan composites the source pixels src with the pixels dst of the
+// image with op, mixed with dst by the mask.
+func (r *RGBAPainter) composeSpan(op CompositeOperation, dst, src, mask []uint8) {
+	if !r.linear || op == Copy {
+		composeRow(op, dst, src, mask)
 		return
 	}
-	switch r.Op {
-	case SourceOver:
-		return
-	case SourceAtop, DestinationOver, DestinationOut, Lighter, Xor:
-		dx, dy := r.Image.Rect.Dx(), r.Image.Rect.Dy()
-		for y := 0; y < dy; y++ {
-			if y < r.spanRect.Min.Y || y > r.spanRect.Max.Y {
-				continue
-			}
-			for x := 0; x < dx; x++ {
-				if x < r.spanRect.Min.X || x > r.spanRect.Max.X {
-					continue
-				}
-				i := r.canvas.PixOffset(x, y)
-				src := color.RGBA{r.canvas.Pix[i+0], r.canvas.Pix[i+1], r.canvas.Pix[i+2], r.canvas.Pix[i+3]}
-				dst := color.RGBA{r.Image.Pix[i+0], r.Image.Pix[i+1], r.Image.Pix[i+2], r.Image.Pix[i+3]} //r.Image.At(x, y)
-				rgba := r.Op.ComposeRGBA(src, dst)
-				r.Image.Pix[i] = rgba.R
-				r.Image.Pix[i+1] = rgba.G
-				r.Image.Pix[i+2] = rgba.B
-				r.Image.Pix[i+3] = rgba.A
-			}
+	for i := 0; i+3 < len(src) && i+3 < len(dst); i += 4 {
+		m := uint8(0xff)
+		if mask != nil {
+			m = mask[i>>2]
 		}
-	default:
-		dx, dy := r.Image.Rect.Dx(), r.Image.Rect.Dy()
-		for y := 0; y < dy; y++ {
-			for x := 0; x < dx; x++ {
-				i := r.canvas.PixOffset(x, y)
-				src := color.RGBA{r.canvas.Pix[i+0], r.canvas.Pix[i+1], r.canvas.Pix[i+2], r.canvas.Pix[i+3]}
-				dst := color.RGBA{r.Image.Pix[i+0], r.Image.Pix[i+1], r.Image.Pix[i+2], r.Image.Pix[i+3]} //r.Image.At(x, y)
-				rgba := r.Op.ComposeRGBA(src, dst)
-				r.Image.Pix[i] = rgba.R
-				r.Image.Pix[i+1] = rgba.G
-				r.Image.Pix[i+2] = rgba.B
-				r.Image.Pix[i+3] = rgba.A
-			}
+		if m == 0 {
+			continue
 		}
+		old := [4]uint8{dst[i], dst[i+1], dst[i+2], dst[i+3]}
+		c := composeLinear(op, color.RGBA{src[i], src[i+1], src[i+2], src[i+3]}, color.RGBA{old[0], old[1], old[2], old[3]})
+		dst[i], dst[i+1], dst[i+2], dst[i+3] = c.R, c.G, c.B, c.A
+		if m != 0xff {
+			lerpPixel(dst[i:i+4], old, m)
+		}
+	}
+}
+
+// spanRow returns the scratch row of n source pixels of the painter.
+func (r *RGBAPainter) spanRow(n int) []uint8 {
+	if cap(r.row) < 4*n {
+		r.row = make([]uint8, 4*n)
+	}
+	return r.row[:4*n]
+}
+
+func (r *RGBAPainter) shadowBuf(n int) []uint8 {
+	if cap(r.shadowRowBuf) < 4*n {
+		r.shadowRowBuf = make([]uint8, 4*n)
+	}
+	return r.shadowRowBuf[:4*n]
+}
+
+func subMask(mask []uint8, i, j int) []uint8 {
+	if mask == nil {
+		return nil
 	}
+	return mask[i:j]
 }
 
 type tranPattern struct {
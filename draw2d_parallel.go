@@ -0,0 +1,215 @@
+package canvas
+
+import (
+	"image"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang/freetype/raster"
+	"golang.org/x/image/math/fixed"
+)
+
+// minBandHeight is the height in rows below which a band is not worth a
+// rasterizer of its own.
+const minBandHeight = 32
+
+// SetWorkers sets the number of goroutines that fill and stroke the
+// context, the canvas is split into bands of rows that are rasterized and
+// painted concurrently. n <= 1 draws on the calling goroutine, which is the
+// default, n < 0 uses runtime.NumCPU workers. The image is the same for
+// every worker count.
+func (gc *GraphicContext2D) SetWorkers(n int) {
+	if n < 0 {
+		n = runtime.NumCPU()
+	}
+	gc.workers = n
+	gc.painter.shadowCache().workers = n
+}
+
+// Workers returns the number of goroutines that fill and stroke the context.
+func (gc *GraphicContext2D) Workers() int {
+	if gc.workers < 1 {
+		return 1
+	}
+	return gc.workers
+}
+
+// parallel reports whether paths are rasterized in bands.
+func (gc *GraphicContext2D) parallel() bool {
+	return gc.workers > 1 && gc.height >= 2*minBandHeight
+}
+
+// bandPainter is a painter that can be split into painters of disjoint
+// bands of rows, which paint concurrently.
+type bandPainter interface {
+	// fork returns a painter of the same image and state as the painter.
+	fork() raster.Painter
+	// join merges the painted area of a fork back into the painter.
+	join(p raster.Painter)
+}
+
+// lineSegment is a segment added to a lineRecorder, n is 0 for the start
+// of a curve and the degree of the segment otherwise.
+type lineSegment struct {
+	n          int
+	a, b, c, d fixed.Point26_6
+	y0, y1     int // rows touched by the segment
+}
+
+// lineRecorder is a raster.Adder that records the segments of the paths,
+// so that each band replays only the segments that cross it.
+type lineRecorder struct {
+	segs []lineSegment
+	last fixed.Point26_6
+}
+
+func (l *lineRecorder) Start(a fixed.Point26_6) {
+	l.segs = append(l.segs, lineSegment{n: 0, a: a})
+	l.last = a
+}
+
+func (l *lineRecorder) Add1(b fixed.Point26_6) {
+	l.add(lineSegment{n: 1, a: l.last, b: b}, b)
+}
+
+func (l *lineRecorder) Add2(b, c fixed.Point26_6) {
+	l.add(lineSegment{n: 2, a: l.last, b: b, c: c}, c)
+}
+
+func (l *lineRecorder) Add3(b, c, d fixed.Point26_6) {
+	l.add(lineSegment{n: 3, a: l.last, b: b, c: c, d: d}, d)
+}
+
+func (l *lineRecorder) add(s lineSegment, end fixed.Point26_6) {
+	// rows as the rasterizer computes them, curves stay within the rows of
+	// their control points
+	row := func(p fixed.Point26_6) int { return int(p.Y) / 64 }
+	s.y0, s.y1 = row(s.a), row(s.a)
+	for _, p := range []fixed.Point26_6{s.b, s.c, s.d}[:s.n] {
+		if y := row(p); y < s.y0 {
+			s.y0 = y
+		} else if y > s.y1 {
+			s.y1 = y
+		}
+	}
+	l.segs = append(l.segs, s)
+	l.last = end
+}
+
+// replay adds to r the segments that touch the rows [y0, y1). The cells of
+// the rasterizer only add up, so the rows of the band get the same cells as
+// when every segment is added.
+func (l *lineRecorder) replay(r raster.Adder, y0, y1 int) {
+	started := false
+	for _, s := range l.segs {
+		switch {
+		case s.n == 0:
+			r.Start(s.a)
+			started = true
+			continue
+		case s.y1 < y0 || s.y0 >= y1:
+			started = false
+			continue
+		case !started:
+			r.Start(s.a)
+			started = true
+		}
+		switch s.n {
+		case 1:
+			r.Add1(s.b)
+		case 2:
+			r.Add2(s.b, s.c)
+		case 3:
+			r.Add3(s.b, s.c, s.d)
+		}
+	}
+}
+
+// rowFilter passes to a painter the spans of the rows [y0, y1).
+type rowFilter struct {
+	painter raster.Painter
+	y0, y1  int
+}
+
+func (f rowFilter) Paint(ss []raster.Span, done bool) {
+	i, j := 0, len(ss)
+	for i < j && ss[i].Y < f.y0 {
+		i++
+	}
+	for j > i && ss[j-1].Y >= f.y1 {
+		j--
+	}
+	if i < j {
+		f.painter.Paint(ss[i:j], done)
+	}
+}
+
+// rasterizeBands rasterizes the recorded segments with the settings of r
+// and paints them with painter, a bandPainter, band by band across the
+// workers of the context.
+func (gc *GraphicContext2D) rasterizeBands(r *raster.Rasterizer, lines *lineRecorder, painter raster.Painter) {
+	width, height := gc.rasterBounds()
+	workers := gc.Workers()
+	bandHeight := (height + 4*workers - 1) / (4 * workers)
+	if bandHeight < minBandHeight {
+		bandHeight = minBandHeight
+	}
+	bp := painter.(bandPainter)
+	var sampler *centerSampler
+	if gc.Current.Antialias == AntialiasNone {
+		sampler = newCenterSampler(lines, r.UseNonZeroWinding)
+	}
+	forks := make([]raster.Painter, workers)
+	var next int32
+	var wg sync.WaitGroup
+	for w := range forks {
+		forks[w] = bp.fork()
+		wg.Add(1)
+		go func(p raster.Painter) {
+			defer wg.Done()
+			br := raster.NewRasterizer(width, height)
+			br.UseNonZeroWinding = r.UseNonZeroWinding
+			br.Dx, br.Dy = r.Dx, r.Dy
+			for {
+				y0 := int(atomic.AddInt32(&next, 1)-1) * bandHeight
+				if y0 >= height {
+					return
+				}
+				y1 := y0 + bandHeight
+				if y1 > height {
+					y1 = height
+				}
+				if sampler != nil {
+					sampler.paint(p, y0, y1, width, r.Dx, r.Dy)
+					continue
+				}
+				lines.replay(br, y0, y1)
+				br.Rasterize(rowFilter{p, y0 + r.Dy, y1 + r.Dy})
+				br.Clear()
+			}
+		}(forks[w])
+	}
+	wg.Wait()
+	for _, p := range forks {
+		bp.join(p)
+	}
+}
+
+// unionSpanRect returns the smallest rectangle containing a and b, which
+// like the span rectangles of the painters include their maximum.
+func unionSpanRect(a, b image.Rectangle) image.Rectangle {
+	if b.Min.X < a.Min.X {
+		a.Min.X = b.Min.X
+	}
+	if b.Min.Y < a.Min.Y {
+		a.Min.Y = b.Min.Y
+	}
+	if b.Max.X > a.Max.X {
+		a.Max.X = b.Max.X
+	}
+	if b.Max.Y > a.Max.Y {
+		a.Max.Y = b.Max.Y
+	}
+	return a
+}
@@ -0,0 +1,97 @@
+package canvas
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// drawBands draws a scene with every setting that changes how paths are
+// rasterized and painted.
+func drawBands(gc *GraphicContext2D, op CompositeOperation, aa Antialias, shadow, clip bool) {
+	gc.SetFillColor(color.NRGBA{0x20, 0x60, 0xc0, 0xa0})
+	gc.FillRect(10, 10, 120, 150)
+
+	gc.Save()
+	gc.SetAntialias(aa)
+	if clip {
+		gc.BeginPath()
+		gc.Arc(100, 110, 80, 0, 2*math.Pi, false)
+		gc.Clip()
+	}
+	if shadow {
+		gc.SetShadowColor(color.NRGBA{0, 0, 0, 0xc0})
+		gc.SetShadowOffset(6, -4)
+		gc.SetShadowBlur(3)
+	}
+	gc.SetGlobalCompositeOperation(op)
+	gc.SetGlobalAlpha(0.8)
+
+	gc.SetFillColor(color.NRGBA{0xe0, 0x40, 0x10, 0xc0})
+	gc.BeginPath()
+	gc.MoveTo(40, 30)
+	gc.BezierCurveTo(190, 20, 180, 170, 60, 190)
+	gc.LineTo(25.3, 90.7)
+	gc.Fill()
+
+	gc.SetStrokeColor(color.NRGBA{0x10, 0xa0, 0x30, 0xff})
+	gc.SetLineWidth(7.5)
+	gc.BeginPath()
+	gc.Arc(120, 100, 55.5, 0.3, 5.5, false)
+	gc.Stroke()
+	gc.SetLineWidth(1)
+	gc.BeginPath()
+	gc.MoveTo(10, 195)
+	gc.LineTo(190, 5)
+	gc.Stroke()
+	gc.Restore()
+}
+
+// TestBandsMatchSerial checks that the bands of several workers paint the
+// same image as one, for every backing, composite operation, shadow, clip
+// and antialiasing.
+func TestBandsMatchSerial(t *testing.T) {
+	const size = 200
+	backings := []struct {
+		name string
+		new  func() (*GraphicContext2D, image.Image)
+	}{
+		{"RGBA", func() (*GraphicContext2D, image.Image) {
+			img := image.NewRGBA(image.Rect(0, 0, size, size))
+			return NewGraphicContext2DForImage(img), img
+		}},
+		{"RGBA64", func() (*GraphicContext2D, image.Image) {
+			img := image.NewRGBA64(image.Rect(0, 0, size, size))
+			return NewGraphicContext2DForRGBA64(img), img
+		}},
+		{"Float", func() (*GraphicContext2D, image.Image) {
+			img := NewFloatRGBA(image.Rect(0, 0, size, size))
+			return NewGraphicContext2DForFloat(img), img
+		}},
+	}
+	for _, b := range backings {
+		for _, aa := range []Antialias{AntialiasDefault, AntialiasNone, AntialiasHigh} {
+			for op := SourceAtop; op <= Xor; op++ {
+				for _, shadow := range []bool{false, true} {
+					for _, clip := range []bool{false, true} {
+						name := fmt.Sprintf("%s/%v/%v/shadow=%v/clip=%v", b.name, aa, op, shadow, clip)
+						serial, want := b.new()
+						drawBands(serial, op, aa, shadow, clip)
+						banded, got := b.new()
+						banded.SetWorkers(7)
+						if !banded.parallel() {
+							t.Fatal("7 workers do not rasterize in bands")
+						}
+						drawBands(banded, op, aa, shadow, clip)
+						if !reflect.DeepEqual(got, want) {
+							t.Errorf("%s: bands differ from serial", name)
+						}
+					}
+				}
+			}
+		}
+	}
+}
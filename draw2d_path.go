@@ -176,7 +176,7 @@ func (p *Path) ArcAngle(cx, cy, rx, ry, startAngle, sweepAngle float64) {
 	} else {
 		p.MoveTo(startX, startY)
 	}
-	p.appendToPath(ArcAngleCmp, cx, cy, rx, ry, startAngle, endAngle)
+	p.appendToPath(ArcAngleCmp, cx, cy, rx, ry, startAngle, endAngle-startAngle)
 	p.x = cx + math.Cos(endAngle)*rx
 	p.y = cy + math.Sin(endAngle)*ry
 }
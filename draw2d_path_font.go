@@ -80,21 +80,41 @@ func (p *Path) drawSegments(segments []sfnt.Segment, dx, dy float64) {
 	}
 }
 
+// AddText adds the outlines of text to the path. Every glyph is looked up
+// through the fallback chain of fnt.Family in the default font database.
+// Text is kerned with the kern table of its faces, so that a pair like "AV"
+// may be narrower than its glyphs set one by one.
 func (p *Path) AddText(text string, x, y float64, fnt *Font) float64 {
-	raw := defaultFontDatebase.LoadRawFont(fnt)
-	if raw == nil {
+	return p.AddTextByDB(text, x, y, fnt, nil)
+}
+
+// AddTextByDB is like AddText but resolves fnt in db, a nil db is the
+// default font database.
+func (p *Path) AddTextByDB(text string, x, y float64, fnt *Font, db *FontDB) float64 {
+	if db == nil {
+		db = defaultFontDatebase
+	}
+	fp := db.FontProvider(fnt)
+	if fp == nil {
 		return 0
 	}
-	return p.AddTextByRaw(text, x, y, raw)
+	return p.AddTextByFontProvider(text, x, y, fp)
 }
 
+// AddTextByRaw adds the outlines of text drawn with raw, including its
+// synthetic bold and oblique.
 func (p *Path) AddTextByRaw(text string, x, y float64, raw *RawFont) float64 {
-	return p.AddTextByFont(text, x, y, raw.Font, raw.PointSize)
+	return p.addTextByFont(text, x, y, raw.Font, raw.PointSize, raw.Synthetic)
 }
 
 func (p *Path) AddTextByFont(text string, x, y float64, f *sfnt.Font, pointSize int) float64 {
+	return p.addTextByFont(text, x, y, f, pointSize, SynthesisNone)
+}
+
+func (p *Path) addTextByFont(text string, x, y float64, f *sfnt.Font, pointSize int, synth FontSynthesis) float64 {
 	startx := x
 	var b sfnt.Buffer
+	_, fallbackRawFont := fontDefaults()
 	for _, r := range text {
 		fnt := f
 		i, err := fnt.GlyphIndex(&b, r)
@@ -113,9 +133,10 @@ func (p *Path) AddTextByFont(text string, x, y float64, f *sfnt.Font, pointSize
 			log.Printf("LoadGlyph: %v", err)
 			break
 		}
+		synthesizeGlyph(segments, synth, pointSize)
 		p.drawSegments(segments, x, y)
 		v, _ := fnt.GlyphAdvance(&b, i, fixed.I(pointSize), font.HintingFull)
-		offset := fUnitsToFloat64(v)
+		offset := synthesizeAdvance(fUnitsToFloat64(v), synth, pointSize)
 		//TODO fix 汉字计算不准确如 "试"
 		if fallback && unicode.Is(unicode.Han, r) {
 			if offset < float64(pointSize) {
@@ -127,21 +148,38 @@ func (p *Path) AddTextByFont(text string, x, y float64, f *sfnt.Font, pointSize
 	return x - startx
 }
 
+// MeasureText returns the advance width of text, looking up every glyph
+// through the fallback chain of fnt.Family in the default font database.
+// The width includes the kerning applied by AddText.
 func (p *Path) MeasureText(text string, fnt *Font) float64 {
-	raw := defaultFontDatebase.LoadRawFont(fnt)
-	if raw == nil {
+	return p.MeasureTextByDB(text, fnt, nil)
+}
+
+// MeasureTextByDB is like MeasureText but resolves fnt in db, a nil db is
+// the default font database.
+func (p *Path) MeasureTextByDB(text string, fnt *Font, db *FontDB) float64 {
+	if db == nil {
+		db = defaultFontDatebase
+	}
+	fp := db.FontProvider(fnt)
+	if fp == nil {
 		return 0
 	}
-	return p.MeasureTextByRawFont(text, raw)
+	return p.MeasureTextByFontProvider(text, fp)
 }
 
 func (p *Path) MeasureTextByRawFont(text string, raw *RawFont) float64 {
-	return p.MeasureTextByFont(text, raw.Font, raw.PointSize)
+	return p.measureTextByFont(text, raw.Font, raw.PointSize, raw.Synthetic)
 }
 
 func (p *Path) MeasureTextByFont(text string, f *sfnt.Font, pointSize int) float64 {
+	return p.measureTextByFont(text, f, pointSize, SynthesisNone)
+}
+
+func (p *Path) measureTextByFont(text string, f *sfnt.Font, pointSize int, synth FontSynthesis) float64 {
 	var x float64
 	var b sfnt.Buffer
+	_, fallbackRawFont := fontDefaults()
 	for _, r := range text {
 		ff := f
 		var fallback bool
@@ -156,7 +194,7 @@ func (p *Path) MeasureTextByFont(text string, f *sfnt.Font, pointSize int) float
 			break
 		}
 		v, _ := ff.GlyphAdvance(&b, i, fixed.I(pointSize), font.HintingNone)
-		offset := fUnitsToFloat64(v)
+		offset := synthesizeAdvance(fUnitsToFloat64(v), synth, pointSize)
 		//TODO fix 汉字计算不准确如 "试"
 		if fallback && unicode.Is(unicode.Han, r) {
 			if offset < float64(pointSize) {
@@ -168,27 +206,36 @@ func (p *Path) MeasureTextByFont(text string, f *sfnt.Font, pointSize int) float
 	return x
 }
 
+// AddTextByFontProvider adds the outlines of text shaped like ShapeText
+// with the glyphs of fp.
 func (p *Path) AddTextByFontProvider(text string, x, y float64, fp FontProvider) float64 {
-	startx := x
-	var b sfnt.Buffer
-	for _, r := range text {
-		i, raw, err := fp.GlyphIndex(&b, r)
-		if err != nil {
-			log.Printf("GlyphIndex: %v", err)
-			break
-		}
-		segments, err := raw.Font.LoadGlyph(&b, i, fixed.I(raw.PointSize), nil)
-		if err != nil {
-			log.Printf("LoadGlyph: %v", err)
-			break
-		}
-		p.drawSegments(segments, x, y)
-		v, _ := raw.Font.GlyphAdvance(&b, i, fixed.I(raw.PointSize), font.HintingNone)
-		x += fUnitsToFloat64(v)
-	}
-	return x - startx
+	return p.AddGlyphs(shapeText(text, fp), x, y)
+}
+
+// MeasureTextByFontProvider returns the advance of text shaped like
+// ShapeText with the glyphs of fp.
+func (p *Path) MeasureTextByFontProvider(text string, fp FontProvider) float64 {
+	return shapeText(text, fp).Advance()
 }
 
 func (p *Path) MetricsFont(f *Font) (*font.Metrics, error) {
-	return defaultFontDatebase.MetricsFont(f)
+	return p.MetricsFontByDB(f, nil)
+}
+
+func (p *Path) MetricsFontByDB(f *Font, db *FontDB) (*font.Metrics, error) {
+	if db == nil {
+		db = defaultFontDatebase
+	}
+	return db.MetricsFont(f)
+}
+
+func (p *Path) FontMetrics(f *Font) (*FontMetrics, error) {
+	return p.FontMetricsByDB(f, nil)
+}
+
+func (p *Path) FontMetricsByDB(f *Font, db *FontDB) (*FontMetrics, error) {
+	if db == nil {
+		db = defaultFontDatebase
+	}
+	return db.FontMetrics(f)
 }
@@ -0,0 +1,90 @@
+package canvas
+
+import (
+	"math"
+	"sort"
+)
+
+// PathMeasure parameterizes a path by arc length. The path is flattened
+// into line segments, subpaths are joined without counting the moves
+// between them.
+type PathMeasure struct {
+	segments []measureSegment
+	length   float64
+	x, y     float64 // current point of the flattener
+}
+
+type measureSegment struct {
+	p0, p1 Vec
+	start  float64 // arc length at p0
+}
+
+// NewPathMeasure returns the arc length parameterization of p.
+func NewPathMeasure(p *Path) *PathMeasure {
+	m := &PathMeasure{}
+	Flatten(p, m, 4)
+	return m
+}
+
+// Length returns the length of the path.
+func (m *PathMeasure) Length() float64 {
+	return m.length
+}
+
+// PointAt returns the point at distance d along the path and the angle of
+// its tangent. d is clamped to the path.
+func (m *PathMeasure) PointAt(d float64) (x, y, angle float64) {
+	if len(m.segments) == 0 {
+		return m.x, m.y, 0
+	}
+	i := sort.Search(len(m.segments), func(i int) bool {
+		s := &m.segments[i]
+		return s.start+s.p1.Sub(s.p0).Len() >= d
+	})
+	if i == len(m.segments) {
+		i--
+	}
+	s := &m.segments[i]
+	v := s.p1.Sub(s.p0)
+	l := v.Len()
+	t := 0.0
+	if l > 0 {
+		t = math.Max(0, math.Min(1, (d-s.start)/l))
+	}
+	p := s.p0.Add(v.Mulf(t))
+	return p.X, p.Y, math.Atan2(v.Y, v.X)
+}
+
+// reversed returns the measure of the path traversed backwards.
+func (m *PathMeasure) reversed() *PathMeasure {
+	r := &PathMeasure{length: m.length, x: m.x, y: m.y}
+	r.segments = make([]measureSegment, len(m.segments))
+	var d float64
+	for i := range m.segments {
+		s := &m.segments[len(m.segments)-1-i]
+		r.segments[i] = measureSegment{p0: s.p1, p1: s.p0, start: d}
+		d += s.p1.Sub(s.p0).Len()
+	}
+	return r
+}
+
+func (m *PathMeasure) MoveTo(x, y float64) {
+	m.x, m.y = x, y
+}
+
+func (m *PathMeasure) LineTo(x, y float64) {
+	p0, p1 := Vec{m.x, m.y}, Vec{x, y}
+	m.x, m.y = x, y
+	l := p1.Sub(p0).Len()
+	if l == 0 {
+		return
+	}
+	m.segments = append(m.segments, measureSegment{p0: p0, p1: p1, start: m.length})
+	m.length += l
+}
+
+func (m *PathMeasure) LineJoin() {}
+
+func (m *PathMeasure) Close() {}
+
+func (m *PathMeasure) End() {}
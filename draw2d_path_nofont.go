@@ -20,3 +20,47 @@ func (p *Path) MeasureText(text string, fnt *Font) float64 {
 func (p *Path) MetricsFont(f *Font) (*font.Metrics, error) {
 	return nil, fmt.Errorf("not support font")
 }
+
+func (p *Path) AddTextByDB(text string, x, y float64, fnt *Font, db *FontDB) float64 {
+	return 0
+}
+
+func (p *Path) MeasureTextByDB(text string, fnt *Font, db *FontDB) float64 {
+	return 0
+}
+
+func (p *Path) MetricsFontByDB(f *Font, db *FontDB) (*font.Metrics, error) {
+	return nil, fmt.Errorf("not support font")
+}
+
+func (p *Path) FontMetrics(f *Font) (*FontMetrics, error) {
+	return nil, fmt.Errorf("not support font")
+}
+
+func (p *Path) FontMetricsByDB(f *Font, db *FontDB) (*FontMetrics, error) {
+	return nil, fmt.Errorf("not support font")
+}
+
+func (p *Path) AddVerticalTextByDB(text string, x, y float64, fnt *Font, db *FontDB) float64 {
+	return 0
+}
+
+func (p *Path) MeasureVerticalTextByDB(text string, fnt *Font, db *FontDB) float64 {
+	return 0
+}
+
+func (p *Path) AddTextOnPath(text string, path *Path, offset float64, side TextPathSide, fnt *Font) float64 {
+	return 0
+}
+
+func (p *Path) AddTextOnPathByDB(text string, path *Path, offset float64, side TextPathSide, fnt *Font, db *FontDB) float64 {
+	return 0
+}
+
+func (p *Path) addTextOnPath(text string, path *Path, offset, dy float64, side TextPathSide, fnt *Font, db *FontDB) float64 {
+	return 0
+}
+
+func (p *Path) AddGlyphs(run *GlyphRun, x, y float64) float64 {
+	return 0
+}
@@ -0,0 +1,73 @@
+//go:build !nofont
+// +build !nofont
+
+package canvas
+
+import (
+	"log"
+	"math"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// AddTextOnPath adds the outlines of text set along path, starting offset
+// from its start on the given side. Every glyph is rotated to the tangent
+// at its middle, glyphs whose middle is off the path are dropped. It
+// returns the advance of the text.
+func (p *Path) AddTextOnPath(text string, path *Path, offset float64, side TextPathSide, fnt *Font) float64 {
+	return p.AddTextOnPathByDB(text, path, offset, side, fnt, nil)
+}
+
+// AddTextOnPathByDB is like AddTextOnPath but resolves fnt in db, a nil db
+// is the default font database.
+func (p *Path) AddTextOnPathByDB(text string, path *Path, offset float64, side TextPathSide, fnt *Font, db *FontDB) float64 {
+	return p.addTextOnPath(text, path, offset, 0, side, fnt, db)
+}
+
+// addTextOnPath sets text with its alphabetic baseline shifted by dy from
+// path.
+func (p *Path) addTextOnPath(text string, path *Path, offset, dy float64, side TextPathSide, fnt *Font, db *FontDB) float64 {
+	if db == nil {
+		db = defaultFontDatebase
+	}
+	fp := db.FontProvider(fnt)
+	if fp == nil {
+		return 0
+	}
+	m := NewPathMeasure(path)
+	if side == TextPathRight {
+		m = m.reversed()
+	}
+	length := m.Length()
+	d := offset
+	var b sfnt.Buffer
+	for _, r := range text {
+		i, raw, err := fp.GlyphIndex(&b, r)
+		if err != nil {
+			log.Printf("GlyphIndex: %v", err)
+			break
+		}
+		v, _ := raw.Font.GlyphAdvance(&b, i, fixed.I(raw.PointSize), font.HintingNone)
+		advance := synthesizeAdvance(fUnitsToFloat64(v), raw.Synthetic, raw.PointSize)
+		mid := d + advance/2
+		d += advance
+		if mid < 0 || mid > length {
+			continue
+		}
+		segments, err := raw.Font.LoadGlyph(&b, i, fixed.I(raw.PointSize), nil)
+		if err != nil {
+			log.Printf("LoadGlyph: %v", err)
+			break
+		}
+		synthesizeGlyph(segments, raw.Synthetic, raw.PointSize)
+		glyph := NewPath()
+		glyph.drawSegments(segments, -advance/2, dy)
+		x, y, angle := m.PointAt(mid)
+		sin, cos := math.Sincos(angle)
+		glyph.Transfrom(Matrix{cos, sin, -sin, cos, x, y})
+		p.AddPath(glyph)
+	}
+	return d - offset
+}
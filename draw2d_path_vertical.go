@@ -0,0 +1,178 @@
+//go:build !nofont
+// +build !nofont
+
+package canvas
+
+import (
+	"log"
+	"math"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// AddVerticalTextByDB adds the outlines of text set vertically, starting at
+// y and advancing downward, centered on the vertical line x. It returns the
+// advance of the text.
+func (p *Path) AddVerticalTextByDB(text string, x, y float64, fnt *Font, db *FontDB) float64 {
+	if db == nil {
+		db = defaultFontDatebase
+	}
+	fp := db.FontProvider(fnt)
+	if fp == nil {
+		return 0
+	}
+	return p.verticalText(text, x, y, fp, true)
+}
+
+func (p *Path) AddVerticalTextByFontProvider(text string, x, y float64, fp FontProvider) float64 {
+	return p.verticalText(text, x, y, fp, true)
+}
+
+// MeasureVerticalTextByDB returns the vertical advance of text.
+func (p *Path) MeasureVerticalTextByDB(text string, fnt *Font, db *FontDB) float64 {
+	if db == nil {
+		db = defaultFontDatebase
+	}
+	fp := db.FontProvider(fnt)
+	if fp == nil {
+		return 0
+	}
+	return p.verticalText(text, 0, 0, fp, false)
+}
+
+func (p *Path) MeasureVerticalTextByFontProvider(text string, fp FontProvider) float64 {
+	return p.verticalText(text, 0, 0, fp, false)
+}
+
+func (p *Path) verticalText(text string, x, y float64, fp FontProvider, draw bool) float64 {
+	starty := y
+	var b sfnt.Buffer
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		if n := tateChuYokoLen(runes, i); n > 0 {
+			adv, err := p.tateChuYoko(&b, runes[i:i+n], x, y, fp, draw)
+			if err != nil {
+				log.Printf("LoadGlyph: %v", err)
+				break
+			}
+			y += adv
+			i += n - 1
+			continue
+		}
+		gi, raw, err := fp.GlyphIndex(&b, runes[i])
+		if err != nil {
+			log.Printf("GlyphIndex: %v", err)
+			break
+		}
+		ppem := fixed.I(raw.PointSize)
+		vert, vmetrics := raw.verticalTables()
+		orient := verticalOrientation(runes[i])
+		if orient != orientRotated {
+			if v, ok := vert[uint16(gi)]; ok {
+				gi, orient = sfnt.GlyphIndex(v), orientUpright
+			} else if orient == orientTransformed {
+				orient = orientRotated
+			}
+		}
+		v, _ := raw.Font.GlyphAdvance(&b, gi, ppem, font.HintingNone)
+		advance := synthesizeAdvance(fUnitsToFloat64(v), raw.Synthetic, raw.PointSize)
+		m, err := raw.Font.Metrics(&b, ppem, font.HintingNone)
+		if err != nil {
+			log.Printf("Metrics: %v", err)
+			break
+		}
+		ascent, descent := fUnitsToFloat64(m.Ascent), fUnitsToFloat64(m.Descent)
+		var segments []sfnt.Segment
+		if draw {
+			if segments, err = raw.Font.LoadGlyph(&b, gi, ppem, nil); err != nil {
+				log.Printf("LoadGlyph: %v", err)
+				break
+			}
+			synthesizeGlyph(segments, raw.Synthetic, raw.PointSize)
+		}
+		if orient == orientRotated {
+			if draw {
+				// rotate clockwise around the origin, the em box is centered on x
+				for i := range segments {
+					for j := range segments[i].Args {
+						a := &segments[i].Args[j]
+						a.X, a.Y = -a.Y, a.X
+					}
+				}
+				p.drawSegments(segments, x-(ascent-descent)/2, y)
+			}
+			y += advance
+			continue
+		}
+		// upright glyph placed with the vertical metrics, or in an em box
+		// of ascent+descent without them
+		vadvance, baseline := ascent+descent, y+ascent
+		if vmetrics != nil {
+			scale := float64(raw.PointSize) / float64(raw.Font.UnitsPerEm())
+			va, tsb := vmetrics.metrics(uint16(gi))
+			vadvance = float64(va) * scale
+			bounds, _, err := raw.Font.GlyphBounds(&b, gi, ppem, font.HintingNone)
+			if err == nil && bounds.Min.Y < bounds.Max.Y {
+				baseline = y + float64(tsb)*scale - fUnitsToFloat64(bounds.Min.Y)
+			}
+		}
+		if draw {
+			p.drawSegments(segments, x-advance/2, baseline)
+		}
+		y += synthesizeAdvance(vadvance, raw.Synthetic, raw.PointSize)
+	}
+	return y - starty
+}
+
+// tateChuYoko sets runes horizontally in one em of vertical text, condensed
+// if they do not fit.
+func (p *Path) tateChuYoko(b *sfnt.Buffer, runes []rune, x, y float64, fp FontProvider, draw bool) (float64, error) {
+	type glyph struct {
+		index   sfnt.GlyphIndex
+		raw     *RawFont
+		advance float64
+	}
+	glyphs := make([]glyph, len(runes))
+	var width float64
+	for i, r := range runes {
+		gi, raw, err := fp.GlyphIndex(b, r)
+		if err != nil {
+			return 0, err
+		}
+		v, _ := raw.Font.GlyphAdvance(b, gi, fixed.I(raw.PointSize), font.HintingNone)
+		advance := synthesizeAdvance(fUnitsToFloat64(v), raw.Synthetic, raw.PointSize)
+		glyphs[i] = glyph{gi, raw, advance}
+		width += advance
+	}
+	raw := glyphs[0].raw
+	m, err := raw.Font.Metrics(b, fixed.I(raw.PointSize), font.HintingNone)
+	if err != nil {
+		return 0, err
+	}
+	ascent, descent := fUnitsToFloat64(m.Ascent), fUnitsToFloat64(m.Descent)
+	em := ascent + descent
+	if !draw {
+		return em, nil
+	}
+	scale := math.Min(1, em/width)
+	gx := x - width*scale/2
+	for _, g := range glyphs {
+		segments, err := g.raw.Font.LoadGlyph(b, g.index, fixed.I(g.raw.PointSize), nil)
+		if err != nil {
+			return 0, err
+		}
+		synthesizeGlyph(segments, g.raw.Synthetic, g.raw.PointSize)
+		if scale < 1 {
+			for i := range segments {
+				for j := range segments[i].Args {
+					segments[i].Args[j].X = fixed.Int26_6(float64(segments[i].Args[j].X) * scale)
+				}
+			}
+		}
+		p.drawSegments(segments, gx, y+ascent)
+		gx += g.advance * scale
+	}
+	return em, nil
+}
@@ -0,0 +1,147 @@
+package canvas
+
+import (
+	"container/list"
+	"crypto/md5"
+	"image"
+)
+
+const (
+	// defaultShadowCacheSize is the bytes of blurred shadows a context keeps.
+	defaultShadowCacheSize = 8 << 20
+	// minCachedShadow is the area below which blurring a shadow again is
+	// cheaper than hashing it.
+	minCachedShadow = 64 * 64
+)
+
+// ShadowCacheStats are the counters of the shadow cache of a context.
+type ShadowCacheStats struct {
+	Hits      int // blurs found in the cache
+	Misses    int // blurs computed and added to the cache
+	Skips     int // blurs too small or too large to be cached
+	Evictions int
+	Entries   int
+	Bytes     int // of the cached shadows
+	MaxBytes  int
+}
+
+// SetShadowCacheSize sets the bytes of blurred shadows the context keeps to
+// draw them again, 0 disables the cache.
+func (gc *GraphicContext2D) SetShadowCacheSize(bytes int) {
+	gc.painter.shadowCache().setSize(bytes)
+}
+
+// ShadowCacheStats returns the counters of the shadow cache of the context.
+func (gc *GraphicContext2D) ShadowCacheStats() ShadowCacheStats {
+	return gc.painter.shadowCache().counters()
+}
+
+// shadowKey identifies the alpha of a shadow wherever it is drawn.
+type shadowKey struct {
+	size  image.Point
+	sigma float64
+	deep  bool // of 16-bit alpha
+	sum   [16]byte
+}
+
+type shadowEntry struct {
+	key shadowKey
+	pix []uint8 // of the blurred mask
+}
+
+// shadowCache is a least recently used cache of blurred shadows, bounded by
+// the bytes of their masks.
+type shadowCache struct {
+	maxBytes int
+	lru      *list.List // of *shadowEntry, the most recent first
+	entries  map[shadowKey]*list.Element
+	stats    ShadowCacheStats
+	workers  int // of the blurs
+}
+
+func newShadowCache(maxBytes int) *shadowCache {
+	return &shadowCache{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[shadowKey]*list.Element),
+	}
+}
+
+// setSize sets the bytes kept by the cache, evicting shadows as needed.
+func (c *shadowCache) setSize(maxBytes int) {
+	if maxBytes < 0 {
+		maxBytes = 0
+	}
+	c.maxBytes = maxBytes
+	c.evict()
+}
+
+func (c *shadowCache) evict() {
+	for c.stats.Bytes > c.maxBytes {
+		e := c.lru.Back()
+		ent := c.lru.Remove(e).(*shadowEntry)
+		delete(c.entries, ent.key)
+		c.stats.Bytes -= len(ent.pix)
+		c.stats.Evictions++
+	}
+}
+
+// counters returns the statistics of the cache.
+func (c *shadowCache) counters() ShadowCacheStats {
+	s := c.stats
+	s.Entries = c.lru.Len()
+	s.MaxBytes = c.maxBytes
+	return s
+}
+
+// blur returns a blurred by a Gaussian of sigma, at the bounds of a. The
+// mask returned may share its pixels with the cache and must not be
+// modified.
+func (c *shadowCache) blur(a *image.Alpha, sigma float64) *image.Alpha {
+	if sigma <= 0 || a.Rect.Empty() {
+		return a
+	}
+	pix := c.blurPix(a.Pix, a.Rect.Size(), sigma, false, func() []uint8 {
+		return blurAlpha(a, sigma, c.workers).Pix
+	})
+	return &image.Alpha{Pix: pix, Stride: a.Rect.Dx(), Rect: a.Rect}
+}
+
+// blur16 is blur for the 16-bit alpha of deep images.
+func (c *shadowCache) blur16(a *image.Alpha16, sigma float64) *image.Alpha16 {
+	if sigma <= 0 || a.Rect.Empty() {
+		return a
+	}
+	pix := c.blurPix(a.Pix, a.Rect.Size(), sigma, true, func() []uint8 {
+		return blurAlpha16(a, sigma, c.workers).Pix
+	})
+	return &image.Alpha16{Pix: pix, Stride: 2 * a.Rect.Dx(), Rect: a.Rect}
+}
+
+// blurPix returns the pixels of the mask src of size blurred by sigma,
+// from the cache or from blur.
+func (c *shadowCache) blurPix(src []uint8, size image.Point, sigma float64, deep bool, blur func() []uint8) []uint8 {
+	if size.X*size.Y < minCachedShadow || len(src) > c.maxBytes {
+		c.stats.Skips++
+		return blur()
+	}
+	key := shadowKey{size, sigma, deep, md5.Sum(src)}
+	if e, ok := c.entries[key]; ok {
+		c.stats.Hits++
+		c.lru.MoveToFront(e)
+		return e.Value.(*shadowEntry).pix
+	}
+	c.stats.Misses++
+	pix := blur()
+	c.entries[key] = c.lru.PushFront(&shadowEntry{key, pix})
+	c.stats.Bytes += len(pix)
+	c.evict()
+	return pix
+}
+
+// moveAlpha returns m with its top left corner at p, sharing its pixels.
+func moveAlpha(m *image.Alpha, p image.Point) *image.Alpha {
+	moved := *m
+	moved.Rect = m.Rect.Sub(m.Rect.Min).Add(p)
+	return &moved
+}
@@ -0,0 +1,63 @@
+package canvas
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// TestShadowOffset draws the blurred shadow of a square at opposite offsets,
+// the shadows are the same at either side of it.
+func TestShadowOffset(t *testing.T) {
+	backings := []struct {
+		name string
+		new  func() *GraphicContext2D
+	}{
+		{"RGBA", func() *GraphicContext2D { return NewGraphicContext2D(200, 200) }},
+		{"Float", func() *GraphicContext2D {
+			return NewGraphicContext2DForFloat(NewFloatRGBA(image.Rect(0, 0, 200, 200)))
+		}},
+	}
+	draw := func(gc *GraphicContext2D, dx, dy float64) image.Image {
+		gc.SetShadowColor(color.Black)
+		gc.SetShadowOffset(dx, dy)
+		gc.SetShadowBlur(6)
+		gc.SetFillColor(color.RGBA{0xff, 0, 0, 0xff})
+		gc.FillRect(80, 80, 20, 20)
+		return gc.Image()
+	}
+	for _, b := range backings {
+		after, before := draw(b.new(), 40, 30), draw(b.new(), -40, -30)
+		if _, _, _, a := before.At(50, 60).RGBA(); a != 0xffff {
+			t.Errorf("%s: shadow before the square is %#x at its center", b.name, a)
+		}
+		for y := -15; y < 35; y++ {
+			for x := -15; x < 35; x++ {
+				if ca, cb := after.At(120+x, 110+y), before.At(40+x, 50+y); ca != cb {
+					t.Fatalf("%s: shadow at %d,%d is %v after the square, %v before", b.name, x, y, ca, cb)
+				}
+			}
+		}
+	}
+}
+
+// TestDeepShadowPrecision checks that the blurred shadow of a deep context
+// has levels between the ones of 8 bits.
+func TestDeepShadowPrecision(t *testing.T) {
+	img := image.NewRGBA64(image.Rect(0, 0, 100, 100))
+	gc := NewGraphicContext2DForRGBA64(img)
+	gc.SetShadowColor(color.Black)
+	gc.SetShadowOffset(40, 0)
+	gc.SetShadowBlur(16)
+	gc.SetFillColor(color.White)
+	gc.FillRect(10, 30, 20, 40)
+	fine := 0
+	for x := 40; x < 100; x++ {
+		if a := img.RGBA64At(x, 50).A; a%0x101 != 0 {
+			fine++
+		}
+	}
+	if fine == 0 {
+		t.Error("the shadow has 8-bit alpha")
+	}
+}
@@ -28,7 +28,8 @@ const (
 )
 
 type StackGraphicContext struct {
-	Current *ContextStack
+	Current   *ContextStack
+	tolerance float64 // of flattening, in device pixels
 }
 
 type ContextStack struct {
@@ -53,6 +54,9 @@ type ContextStack struct {
 	Font                     *Font
 	TextAlign                TextAlign
 	TextBaseline             TextBaseline
+	TextDecoration           TextDecoration
+	WritingMode              WritingMode
+	Antialias                Antialias
 	Previous                 *ContextStack
 }
 
@@ -60,7 +64,7 @@ type ContextStack struct {
  * Create a new Graphic context from an image
  */
 func NewStackGraphicContext() *StackGraphicContext {
-	gc := &StackGraphicContext{}
+	gc := &StackGraphicContext{tolerance: DefaultFlatteningTolerance}
 	gc.Current = new(ContextStack)
 	gc.Current.Tr = NewIdentityMatrix()
 	gc.Current.Path = NewPath()
@@ -73,7 +77,7 @@ func NewStackGraphicContext() *StackGraphicContext {
 	gc.Current.Join = LineJoinMiter
 	gc.Current.MiterLimit = 10
 	gc.Current.GlobalCompositeOperation = SourceOver
-	gc.Current.Font = defaultFont
+	gc.Current.Font = loadDefaultFont()
 	gc.Current.TextAlign = AlignLeft
 	gc.Current.TextBaseline = AlignAlphabetic
 	gc.Current.ShadowBlur = 0
@@ -247,6 +251,30 @@ func (gc *StackGraphicContext) TextBaseline() TextBaseline {
 	return gc.Current.TextBaseline
 }
 
+func (gc *StackGraphicContext) SetTextDecoration(d TextDecoration) {
+	gc.Current.TextDecoration = d
+}
+
+func (gc *StackGraphicContext) TextDecoration() TextDecoration {
+	return gc.Current.TextDecoration
+}
+
+func (gc *StackGraphicContext) SetWritingMode(mode WritingMode) {
+	gc.Current.WritingMode = mode
+}
+
+func (gc *StackGraphicContext) WritingMode() WritingMode {
+	return gc.Current.WritingMode
+}
+
+func (gc *StackGraphicContext) SetAntialias(a Antialias) {
+	gc.Current.Antialias = a
+}
+
+func (gc *StackGraphicContext) Antialias() Antialias {
+	return gc.Current.Antialias
+}
+
 func (gc *StackGraphicContext) BeginPath() {
 	gc.Current.Path.Clear()
 }
@@ -389,26 +417,17 @@ func (gc *StackGraphicContext) traceArc(x, y, rx, ry, start, angle, scale float6
 	}
 }
 
+// ArcAngle adds an arc of the ellipse at (x, y) to the path, flattened
+// within the flattening tolerance as the points are transformed as they are
+// added.
 func (gc *StackGraphicContext) ArcAngle(x, y, rx, ry, startAngle, sweepAngle float64) {
-	const n = 16
-	for i := 0; i < n; i++ {
-		p1 := float64(i+0) / n
-		p2 := float64(i+1) / n
-		a1 := startAngle + sweepAngle*p1
-		a2 := startAngle + sweepAngle*p2
-		x0 := x + rx*math.Cos(a1)
-		y0 := y + ry*math.Sin(a1)
-		x1 := x + rx*math.Cos(a1+(a2-a1)/2)
-		y1 := y + ry*math.Sin(a1+(a2-a1)/2)
-		x2 := x + rx*math.Cos(a2)
-		y2 := y + ry*math.Sin(a2)
-		cx := 2*x1 - x0/2 - x2/2
-		cy := 2*y1 - y0/2 - y2/2
-		if i == 0 {
-			gc.LineTo(x0, y0)
-		}
-		gc.QuadraticCurveTo(cx, cy, x2, y2)
+	tolerance := gc.tolerance
+	if tolerance <= 0 {
+		tolerance = DefaultFlatteningTolerance
 	}
+	gc.LineTo(x+rx*math.Cos(startAngle), y+ry*math.Sin(startAngle))
+	x, y = TraceArcTolerance(gc, x, y, rx, ry, startAngle, sweepAngle, arcTolerance(tolerance)/gc.Current.Tr.GetScale())
+	gc.LineTo(x, y)
 }
 
 func (gc *StackGraphicContext) ClosePath() {
@@ -433,6 +452,9 @@ func (gc *StackGraphicContext) Save() {
 	context.Font = gc.Current.Font
 	context.TextAlign = gc.Current.TextAlign
 	context.TextBaseline = gc.Current.TextBaseline
+	context.TextDecoration = gc.Current.TextDecoration
+	context.WritingMode = gc.Current.WritingMode
+	context.Antialias = gc.Current.Antialias
 	context.ShadowOffsetX = gc.Current.ShadowOffsetX
 	context.ShadowOffsetY = gc.Current.ShadowOffsetY
 	context.ShadowBlur = gc.Current.ShadowBlur
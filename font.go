@@ -4,15 +4,23 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"sync"
 
 	"golang.org/x/image/font"
 	"golang.org/x/image/math/fixed"
 )
 
 var (
-	defaultFont = &Font{Family: "Go", PointSize: 10}
+	defaultFontMu sync.RWMutex
+	defaultFont   = &Font{Family: "Go", PointSize: 10} // guarded by defaultFontMu
 )
 
+func loadDefaultFont() *Font {
+	defaultFontMu.RLock()
+	defer defaultFontMu.RUnlock()
+	return defaultFont
+}
+
 // font family example
 // font family: Helvetica, Verdana, sans-serif
 // If Helvetica is available it will be used when rendering.
@@ -20,11 +28,28 @@ var (
 // then the user-agent-defined sans serif font will be used.
 
 type Font struct {
-	Family    string       // font name list split by ,
-	PointSize int          // font point size
-	Style     font.Style   // default font.StyleNormal
-	Weight    font.Weight  // default font.WeightNormal
-	Stretch   font.Stretch // default font.StretchNormal
+	Family      string        // font name list split by ,
+	PointSize   int           // font point size
+	Style       font.Style    // default font.StyleNormal
+	Weight      font.Weight   // default font.WeightNormal
+	Stretch     font.Stretch  // default font.StretchNormal
+	NoSynthesis FontSynthesis // synthesis disabled for missing faces, default none
+}
+
+// FontSynthesis is a set of faces that may be synthesized when a family has
+// no face for the requested weight or style, like CSS font-synthesis.
+type FontSynthesis int
+
+const (
+	SynthesisWeight FontSynthesis = 1 << iota // bold by emboldening the outlines
+	SynthesisStyle                            // oblique by shearing the outlines
+	SynthesisNone   FontSynthesis = 0
+	SynthesisAll                  = SynthesisWeight | SynthesisStyle
+)
+
+// SetSynthesis sets the kinds of synthesis allowed for f.
+func (f *Font) SetSynthesis(s FontSynthesis) {
+	f.NoSynthesis = SynthesisAll &^ s
 }
 
 func (f Font) String() string {
@@ -83,6 +108,29 @@ func (f *Font) IsItalic() bool {
 	return f.Style != font.StyleNormal
 }
 
+// FontMetrics are the metrics of a Font in pixels. Ascent, Descent and the
+// heights are distances from the baseline, the underline and strikeout
+// positions are offsets of the line center from the baseline with y pointing
+// down, so the underline position is usually positive and the strikeout one
+// negative.
+type FontMetrics struct {
+	Ascent             float64
+	Descent            float64
+	LineGap            float64
+	UnitsPerEm         int // 0 if unknown
+	XHeight            float64
+	CapHeight          float64
+	UnderlinePosition  float64
+	UnderlineThickness float64
+	StrikeoutPosition  float64
+	StrikeoutThickness float64
+}
+
+// LineHeight returns the distance between two baselines.
+func (m *FontMetrics) LineHeight() float64 {
+	return m.Ascent + m.Descent + m.LineGap
+}
+
 func fUnitsToFloat64(x fixed.Int26_6) float64 {
 	scaled := x << 2
 	return float64(scaled/256) + float64(scaled%256)/256.0
@@ -0,0 +1,537 @@
+//go:build !nofont || !wx
+// +build !nofont !wx
+
+package canvas
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/font"
+)
+
+// BitmapFont is a font of pixel glyphs loaded from a BDF or PCF file. Its
+// text is drawn without anti-aliasing, scaled by integer factors.
+type BitmapFont struct {
+	Family      string
+	Weight      font.Weight
+	Style       font.Style
+	PixelSize   int // nominal size of the font
+	Ascent      int
+	Descent     int
+	DefaultChar rune // drawn for missing runes, -1 if none
+	Glyphs      map[rune]*BitmapGlyph
+}
+
+// BitmapGlyph is the image of a glyph, its bounds are relative to the
+// origin on the baseline with y pointing down.
+type BitmapGlyph struct {
+	Advance int
+	Mask    *image.Alpha
+}
+
+// Glyph returns the glyph of r or the default glyph, nil if none.
+func (f *BitmapFont) Glyph(r rune) *BitmapGlyph {
+	if g, ok := f.Glyphs[r]; ok {
+		return g
+	}
+	return f.Glyphs[f.DefaultChar]
+}
+
+// Advance returns the advance width of text in pixels, unscaled.
+func (f *BitmapFont) Advance(text string) int {
+	var x int
+	for _, r := range text {
+		if g := f.Glyph(r); g != nil {
+			x += g.Advance
+		}
+	}
+	return x
+}
+
+// metrics returns the metrics of the font scaled by k.
+func (f *BitmapFont) metrics(k int) *FontMetrics {
+	s := float64(k)
+	m := &FontMetrics{
+		Ascent:  float64(f.Ascent) * s,
+		Descent: float64(f.Descent) * s,
+	}
+	if g, ok := f.Glyphs['x']; ok {
+		m.XHeight = float64(-g.Mask.Rect.Min.Y) * s
+	} else {
+		m.XHeight = m.Ascent / 2
+	}
+	if g, ok := f.Glyphs['H']; ok {
+		m.CapHeight = float64(-g.Mask.Rect.Min.Y) * s
+	} else {
+		m.CapHeight = m.Ascent * 0.8
+	}
+	m.UnderlineThickness = s
+	m.UnderlinePosition = math.Max(s, float64(f.Descent)*s/2)
+	m.StrikeoutThickness = s
+	m.StrikeoutPosition = -math.Round(m.XHeight/2/s) * s
+	return m
+}
+
+// textMask returns the pixels of text scaled by k, relative to the start of
+// its baseline.
+func (f *BitmapFont) textMask(text string, k int) *image.Alpha {
+	var bounds image.Rectangle
+	x := 0
+	for _, r := range text {
+		g := f.Glyph(r)
+		if g == nil {
+			continue
+		}
+		bounds = bounds.Union(g.Mask.Rect.Add(image.Pt(x, 0)))
+		x += g.Advance
+	}
+	mask := image.NewAlpha(image.Rect(bounds.Min.X*k, bounds.Min.Y*k, bounds.Max.X*k, bounds.Max.Y*k))
+	x = 0
+	for _, r := range text {
+		g := f.Glyph(r)
+		if g == nil {
+			continue
+		}
+		b := g.Mask.Rect
+		for gy := b.Min.Y; gy < b.Max.Y; gy++ {
+			for gx := b.Min.X; gx < b.Max.X; gx++ {
+				if g.Mask.AlphaAt(gx, gy).A == 0 {
+					continue
+				}
+				for dy := 0; dy < k; dy++ {
+					i := mask.PixOffset((x+gx)*k, gy*k+dy)
+					for dx := 0; dx < k; dx++ {
+						mask.Pix[i+dx] = 0xff
+					}
+				}
+			}
+		}
+		x += g.Advance
+	}
+	return mask
+}
+
+// bitmapFont returns the bitmap font of the first family of f that has
+// one, with the integer scale closest to f.PointSize. It returns nil if a
+// family of outline fonts comes first. A nil db is the default database.
+func (db *FontDB) bitmapFont(f *Font) (*BitmapFont, int) {
+	if db == nil {
+		db = defaultFontDatebase
+	}
+	if f == nil {
+		return nil, 0
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if len(db.bitmaps) == 0 {
+		return nil, 0
+	}
+	for _, family := range strings.Split(f.Family, ",") {
+		family = strings.Trim(strings.TrimSpace(family), `"'`)
+		for _, name := range db.expandFamily(family) {
+			if bf, k := db.matchBitmapFont(name, f); bf != nil {
+				return bf, k
+			}
+			if db.lookupFamily(name) != nil {
+				return nil, 0
+			}
+		}
+	}
+	return nil, 0
+}
+
+func (db *FontDB) matchBitmapFont(family string, f *Font) (best *BitmapFont, scale int) {
+	score := math.Inf(1)
+	for _, bf := range db.bitmaps {
+		if !strings.EqualFold(bf.Family, family) || bf.PixelSize <= 0 {
+			continue
+		}
+		k := int(math.Max(1, math.Round(float64(f.PointSize)/float64(bf.PixelSize))))
+		s := math.Abs(float64(f.PointSize - k*bf.PixelSize))
+		if bf.Weight != f.Weight {
+			s += 1000
+		}
+		if bf.Style != f.Style {
+			s += 2000
+		}
+		if s < score {
+			best, scale, score = bf, k, s
+		}
+	}
+	return
+}
+
+// AddBitmapFont adds f to the database, it is selected by its family in
+// Font.Family.
+func (db *FontDB) AddBitmapFont(f *BitmapFont) {
+	db.mu.Lock()
+	db.bitmaps = append(db.bitmaps, f)
+	db.mu.Unlock()
+}
+
+// LoadBitmapFontFile loads a BDF or PCF font file, optionally gzipped.
+func (db *FontDB) LoadBitmapFontFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	f, err := ParseBitmapFont(data)
+	if err != nil {
+		return fmt.Errorf("ParseBitmapFont: %v, %v", path, err)
+	}
+	db.AddBitmapFont(f)
+	return nil
+}
+
+// LoadBitmapFontFile loads a bitmap font into the default font database.
+func LoadBitmapFontFile(path string) error {
+	return defaultFontDatebase.LoadBitmapFontFile(path)
+}
+
+// ParseBitmapFont parses a BDF or PCF font, optionally gzipped.
+func ParseBitmapFont(data []byte) (*BitmapFont, error) {
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if data, err = ioutil.ReadAll(zr); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case bytes.HasPrefix(data, []byte("\x01fcp")):
+		return ParsePCF(data)
+	case bytes.HasPrefix(data, []byte("STARTFONT")):
+		return ParseBDF(data)
+	}
+	return nil, errors.New("not a BDF or PCF font")
+}
+
+// setProperty sets the font fields described by a BDF or PCF property.
+func (f *BitmapFont) setProperty(name, value string, n int) {
+	switch name {
+	case "FAMILY_NAME":
+		f.Family = value
+	case "WEIGHT_NAME":
+		r := &rawFont{}
+		r.parserSubfamily(strings.Title(strings.ToLower(value)))
+		f.Weight = r.Weight
+	case "SLANT":
+		switch strings.ToUpper(value) {
+		case "I", "RI":
+			f.Style = font.StyleItalic
+		case "O", "RO":
+			f.Style = font.StyleOblique
+		}
+	case "PIXEL_SIZE":
+		f.PixelSize = n
+	case "FONT_ASCENT":
+		f.Ascent = n
+	case "FONT_DESCENT":
+		f.Descent = n
+	case "DEFAULT_CHAR":
+		f.DefaultChar = rune(n)
+	}
+}
+
+func newBitmapFont() *BitmapFont {
+	return &BitmapFont{DefaultChar: -1, Glyphs: make(map[rune]*BitmapGlyph)}
+}
+
+// ParseBDF parses a font in the Glyph Bitmap Distribution Format. The
+// encodings are taken as Unicode code points.
+func ParseBDF(data []byte) (*BitmapFont, error) {
+	f := newBitmapFont()
+	var (
+		encoding            = -1
+		advance, w, h, x, y int
+		bitmap              = -1 // row of the bitmap being read
+		mask                *image.Alpha
+		boundsH             int
+	)
+	s := bufio.NewScanner(bytes.NewReader(data))
+	s.Buffer(nil, 1<<20)
+	line := 0
+	for s.Scan() {
+		line++
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		ints := func(n int) ([]int, error) {
+			if len(fields) < n+1 {
+				return nil, fmt.Errorf("line %d: %s needs %d values", line, fields[0], n)
+			}
+			v := make([]int, n)
+			for i := range v {
+				var err error
+				if v[i], err = strconv.Atoi(fields[i+1]); err != nil {
+					return nil, fmt.Errorf("line %d: %v", line, err)
+				}
+			}
+			return v, nil
+		}
+		if bitmap >= 0 {
+			if fields[0] == "ENDCHAR" {
+				if encoding >= 0 {
+					f.Glyphs[rune(encoding)] = &BitmapGlyph{Advance: advance, Mask: mask}
+				}
+				bitmap = -1
+				continue
+			}
+			if bitmap < h {
+				row, err := hexBytes(fields[0])
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %v", line, err)
+				}
+				for i := 0; i < w && i/8 < len(row); i++ {
+					if row[i/8]&(0x80>>uint(i%8)) != 0 {
+						mask.SetAlpha(x+i, -y-h+bitmap, alphaOpaque)
+					}
+				}
+			}
+			bitmap++
+			continue
+		}
+		switch fields[0] {
+		case "SIZE":
+			if v, err := ints(1); err == nil && f.PixelSize == 0 {
+				f.PixelSize = v[0]
+			}
+		case "FONTBOUNDINGBOX":
+			v, err := ints(4)
+			if err != nil {
+				return nil, err
+			}
+			boundsH = v[1]
+			if f.Ascent == 0 && f.Descent == 0 {
+				f.Ascent, f.Descent = v[1]+v[3], -v[3]
+			}
+		case "FAMILY_NAME", "WEIGHT_NAME", "SLANT", "PIXEL_SIZE", "FONT_ASCENT", "FONT_DESCENT", "DEFAULT_CHAR":
+			value := strings.Trim(strings.TrimSpace(strings.TrimPrefix(s.Text(), fields[0])), `"`)
+			n, _ := strconv.Atoi(value)
+			f.setProperty(fields[0], value, n)
+		case "STARTCHAR":
+			encoding, advance, w, h, x, y = -1, 0, 0, 0, 0, 0
+		case "ENCODING":
+			v, err := ints(1)
+			if err != nil {
+				return nil, err
+			}
+			encoding = v[0]
+		case "DWIDTH":
+			v, err := ints(1)
+			if err != nil {
+				return nil, err
+			}
+			advance = v[0]
+		case "BBX":
+			v, err := ints(4)
+			if err != nil {
+				return nil, err
+			}
+			w, h, x, y = v[0], v[1], v[2], v[3]
+		case "BITMAP":
+			mask = image.NewAlpha(image.Rect(x, -y-h, x+w, -y))
+			bitmap = 0
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if f.PixelSize == 0 {
+		f.PixelSize = boundsH
+	}
+	return f, nil
+}
+
+var alphaOpaque = color.Alpha{A: 0xff}
+
+func hexBytes(s string) ([]byte, error) {
+	if len(s)%2 != 0 {
+		s += "0"
+	}
+	b := make([]byte, len(s)/2)
+	for i := range b {
+		v, err := strconv.ParseUint(s[2*i:2*i+2], 16, 8)
+		if err != nil {
+			return nil, err
+		}
+		b[i] = byte(v)
+	}
+	return b, nil
+}
+
+// PCF table types and format flags.
+const (
+	pcfProperties      = 1 << 0
+	pcfAccelerators    = 1 << 1
+	pcfMetrics         = 1 << 2
+	pcfBitmaps         = 1 << 3
+	pcfBDFEncodings    = 1 << 5
+	pcfBDFAccelerators = 1 << 8
+
+	pcfByteMSB           = 1 << 2
+	pcfBitMSB            = 1 << 3
+	pcfCompressedMetrics = 0x100
+)
+
+// pcfTable reads a table of a PCF font in the byte order of its format.
+type pcfTable struct {
+	data   []byte
+	format uint32
+	order  binary.ByteOrder
+}
+
+func (t *pcfTable) u16(off int) int { return int(t.order.Uint16(t.data[off:])) }
+func (t *pcfTable) i16(off int) int { return int(int16(t.order.Uint16(t.data[off:]))) }
+func (t *pcfTable) i32(off int) int { return int(int32(t.order.Uint32(t.data[off:]))) }
+
+// ParsePCF parses a font in the X11 Portable Compiled Format.
+func ParsePCF(data []byte) (f *BitmapFont, err error) {
+	defer func() {
+		// the tables are read without bounds checks
+		if e := recover(); e != nil {
+			f, err = nil, fmt.Errorf("malformed PCF font: %v", e)
+		}
+	}()
+	tables := make(map[uint32]*pcfTable)
+	n := int(binary.LittleEndian.Uint32(data[4:]))
+	for i := 0; i < n; i++ {
+		h := data[8+16*i:]
+		typ := binary.LittleEndian.Uint32(h)
+		size := binary.LittleEndian.Uint32(h[8:])
+		offset := binary.LittleEndian.Uint32(h[12:])
+		t := &pcfTable{data: data[offset : offset+size]}
+		t.format = binary.LittleEndian.Uint32(t.data)
+		t.order = binary.LittleEndian
+		if t.format&pcfByteMSB != 0 {
+			t.order = binary.BigEndian
+		}
+		tables[typ] = t
+	}
+	f = newBitmapFont()
+	if t := tables[pcfProperties]; t != nil {
+		n := t.i32(4)
+		strs := 8 + 9*n
+		if n&3 != 0 {
+			strs += 4 - n&3
+		}
+		strs += 4
+		str := func(off int) string {
+			b := t.data[strs+off:]
+			return string(b[:bytes.IndexByte(b, 0)])
+		}
+		for i := 0; i < n; i++ {
+			p := 8 + 9*i
+			name, value := str(t.i32(p)), t.i32(p+5)
+			if t.data[p+4] != 0 {
+				f.setProperty(name, str(value), 0)
+			} else {
+				f.setProperty(name, strconv.Itoa(value), value)
+			}
+		}
+	}
+	if t := tables[pcfBDFAccelerators]; t != nil {
+		f.Ascent, f.Descent = t.i32(12), t.i32(16)
+	} else if t := tables[pcfAccelerators]; t != nil {
+		f.Ascent, f.Descent = t.i32(12), t.i32(16)
+	}
+
+	type metric struct{ left, right, advance, ascent, descent int }
+	var metrics []metric
+	t := tables[pcfMetrics]
+	if t == nil {
+		return nil, errors.New("no metrics table")
+	}
+	if t.format&pcfCompressedMetrics != 0 {
+		metrics = make([]metric, t.i16(4))
+		for i := range metrics {
+			b := t.data[6+5*i:]
+			metrics[i] = metric{int(b[0]) - 0x80, int(b[1]) - 0x80, int(b[2]) - 0x80, int(b[3]) - 0x80, int(b[4]) - 0x80}
+		}
+	} else {
+		metrics = make([]metric, t.i32(4))
+		for i := range metrics {
+			p := 8 + 12*i
+			metrics[i] = metric{t.i16(p), t.i16(p + 2), t.i16(p + 4), t.i16(p + 6), t.i16(p + 8)}
+		}
+	}
+
+	t = tables[pcfBitmaps]
+	if t == nil {
+		return nil, errors.New("no bitmaps table")
+	}
+	pad := 1 << (t.format & 3)
+	unit := 1 << ((t.format >> 4) & 3)
+	bitMSB := t.format&pcfBitMSB != 0
+	byteMSB := t.format&pcfByteMSB != 0
+	count := t.i32(4)
+	bits := 8 + 4*count + 16
+	glyphs := make([]*BitmapGlyph, count)
+	for i := 0; i < count && i < len(metrics); i++ {
+		m := metrics[i]
+		w, h := m.right-m.left, m.ascent+m.descent
+		mask := image.NewAlpha(image.Rect(m.left, -m.ascent, m.right, m.descent))
+		stride := (w + 7) / 8
+		stride = (stride + pad - 1) / pad * pad
+		glyph := t.data[bits+t.i32(8+4*i):]
+		row := make([]byte, stride)
+		for y := 0; y < h; y++ {
+			copy(row, glyph[y*stride:])
+			if bitMSB != byteMSB && unit > 1 {
+				for u := 0; u+unit <= stride; u += unit {
+					for a, b := u, u+unit-1; a < b; a, b = a+1, b-1 {
+						row[a], row[b] = row[b], row[a]
+					}
+				}
+			}
+			for x := 0; x < w; x++ {
+				bit := row[x/8] & (0x80 >> uint(x%8))
+				if !bitMSB {
+					bit = row[x/8] & (1 << uint(x%8))
+				}
+				if bit != 0 {
+					mask.SetAlpha(m.left+x, y-m.ascent, alphaOpaque)
+				}
+			}
+		}
+		glyphs[i] = &BitmapGlyph{Advance: m.advance, Mask: mask}
+	}
+
+	t = tables[pcfBDFEncodings]
+	if t == nil {
+		return nil, errors.New("no encodings table")
+	}
+	min2, max2, min1, max1 := t.i16(4), t.i16(6), t.i16(8), t.i16(10)
+	def := t.i16(12)
+	if f.DefaultChar < 0 {
+		f.DefaultChar = rune(def)
+	}
+	i := 14
+	for b1 := min1; b1 <= max1; b1++ {
+		for b2 := min2; b2 <= max2; b2++ {
+			index := t.u16(i)
+			i += 2
+			if index != 0xffff && index < len(glyphs) && glyphs[index] != nil {
+				f.Glyphs[rune(b1<<8|b2)] = glyphs[index]
+			}
+		}
+	}
+	if f.PixelSize == 0 {
+		f.PixelSize = f.Ascent + f.Descent
+	}
+	return f, nil
+}
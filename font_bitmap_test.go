@@ -0,0 +1,184 @@
+//go:build !nofont || !wx
+// +build !nofont !wx
+
+package canvas
+
+import (
+	"bytes"
+	"compress/gzip"
+	"image"
+	"image/color"
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// tinyBDF is a bold italic font of 8 pixels with an A of 4x3 pixels and a
+// default glyph.
+const tinyBDF = `STARTFONT 2.1
+FONT -misc-tiny-bold-i-normal--8-80-75-75-c-60-iso10646-1
+SIZE 8 75 75
+FONTBOUNDINGBOX 6 8 0 -2
+STARTPROPERTIES 6
+FAMILY_NAME "Tiny"
+WEIGHT_NAME "Bold"
+SLANT "I"
+FONT_ASCENT 6
+FONT_DESCENT 2
+DEFAULT_CHAR 63
+ENDPROPERTIES
+CHARS 2
+STARTCHAR A
+ENCODING 65
+SWIDTH 750 0
+DWIDTH 6 0
+BBX 4 3 1 0
+BITMAP
+F0
+90
+F0
+ENDCHAR
+STARTCHAR question
+ENCODING 63
+SWIDTH 625 0
+DWIDTH 5 0
+BBX 2 2 0 4
+BITMAP
+C0
+40
+ENDCHAR
+ENDFONT
+`
+
+func TestParseBDF(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(tinyBDF))
+	zw.Close()
+	for _, data := range [][]byte{[]byte(tinyBDF), gz.Bytes()} {
+		f, err := ParseBitmapFont(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Family != "Tiny" || f.Weight != font.WeightBold || f.Style != font.StyleItalic || f.PixelSize != 8 ||
+			f.Ascent != 6 || f.Descent != 2 || f.DefaultChar != '?' || len(f.Glyphs) != 2 {
+			t.Errorf("font %+v", f)
+		}
+		a := f.Glyph('A')
+		if a == nil || a.Advance != 6 || a.Mask.Rect != image.Rect(1, -3, 5, 0) {
+			t.Fatalf("glyph A %+v", a)
+		}
+		tests := []struct {
+			x, y int
+			want uint8
+		}{
+			{1, -3, 0xff},
+			{4, -3, 0xff},
+			{1, -2, 0xff},
+			{2, -2, 0},
+			{3, -2, 0},
+			{4, -2, 0xff},
+			{2, -1, 0xff},
+		}
+		for _, tt := range tests {
+			if got := a.Mask.AlphaAt(tt.x, tt.y).A; got != tt.want {
+				t.Errorf("A at %d,%d is %#x, want %#x", tt.x, tt.y, got, tt.want)
+			}
+		}
+		if g := f.Glyph('B'); g != f.Glyphs['?'] {
+			t.Errorf("B is %+v, want the default glyph", g)
+		}
+		if adv := f.Advance("AB?"); adv != 16 {
+			t.Errorf("Advance = %d, want 16", adv)
+		}
+	}
+	if _, err := ParseBitmapFont([]byte("not a font")); err == nil {
+		t.Error("ParseBitmapFont parsed text")
+	}
+	if _, err := ParseBDF([]byte("STARTFONT 2.1\nSTARTCHAR A\nENCODING x\n")); err == nil {
+		t.Error("ParseBDF parsed a bad encoding")
+	}
+}
+
+func TestBitmapFontMatch(t *testing.T) {
+	tiny, err := ParseBDF([]byte(tinyBDF))
+	if err != nil {
+		t.Fatal(err)
+	}
+	regular := *tiny
+	regular.Weight, regular.Style = font.WeightNormal, font.StyleNormal
+	big := regular
+	big.PixelSize = 12
+	db := NewFontDB()
+	if err := db.LoadFontData(goregular.TTF); err != nil {
+		t.Fatal(err)
+	}
+	db.AddBitmapFont(tiny)
+	db.AddBitmapFont(&regular)
+	db.AddBitmapFont(&big)
+	tests := []struct {
+		name  string
+		f     Font
+		want  *BitmapFont
+		scale int
+	}{
+		{"style", Font{Family: "Tiny", PointSize: 16, Weight: font.WeightBold, Style: font.StyleItalic}, tiny, 2},
+		{"size", Font{Family: "Tiny", PointSize: 8}, &regular, 1},
+		{"other size", Font{Family: "Tiny", PointSize: 12}, &big, 1},
+		{"scaled", Font{Family: "Tiny", PointSize: 36}, &big, 3},
+		{"small", Font{Family: "tiny", PointSize: 3}, &regular, 1},
+		{"chain", Font{Family: "Missing, Tiny", PointSize: 8}, &regular, 1},
+		{"outline first", Font{Family: "Go, Tiny", PointSize: 8}, nil, 0},
+		{"outline", Font{Family: "Go", PointSize: 8}, nil, 0},
+	}
+	for _, tt := range tests {
+		bf, k := db.bitmapFont(&tt.f)
+		if bf != tt.want || k != tt.scale {
+			t.Errorf("%s: bitmapFont = %p, %d, want %p, %d", tt.name, bf, k, tt.want, tt.scale)
+		}
+	}
+}
+
+// TestBitmapFillText draws the A of the font scaled by 2.
+func TestBitmapFillText(t *testing.T) {
+	tiny, err := ParseBDF([]byte(tinyBDF))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := NewFontDB()
+	db.AddBitmapFont(tiny)
+	gc := NewGraphicContext2DWithFonts(40, 40, db)
+	gc.SetFont(&Font{Family: "Tiny", PointSize: 16, Weight: font.WeightBold, Style: font.StyleItalic})
+	gc.SetFillColor(color.Black)
+	if w := gc.MeasureText("A?"); w != 22 {
+		t.Errorf("MeasureText = %v, want 22", w)
+	}
+	if m := gc.FontMetrics(); m == nil || m.Ascent != 12 || m.Descent != 4 {
+		t.Errorf("FontMetrics = %+v", m)
+	}
+	gc.FillText("A", 10, 20)
+	want := map[image.Point]bool{}
+	for gy := -3; gy < 0; gy++ {
+		for gx := 1; gx < 5; gx++ {
+			if gy == -2 && (gx == 2 || gx == 3) {
+				continue
+			}
+			for d := 0; d < 4; d++ {
+				want[image.Pt(10+2*gx+d%2, 20+2*gy+d/2)] = true
+			}
+		}
+	}
+	ps := painted(gc.Image())
+	if len(ps) != len(want) {
+		t.Errorf("painted %d pixels, want %d", len(ps), len(want))
+	}
+	for _, p := range ps {
+		if !want[p] {
+			t.Errorf("painted %v", p)
+		}
+		if _, _, _, a := gc.Image().At(p.X, p.Y).RGBA(); a != 0xffff {
+			t.Errorf("alpha of %v is %#x, want opaque", p, a)
+		}
+	}
+}
@@ -4,12 +4,15 @@
 package canvas
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"unicode"
 
 	"golang.org/x/image/font"
@@ -26,17 +29,66 @@ type cacheInfo struct {
 	Style  font.Style
 }
 
-type fontDatabase struct {
+// FontDB is a set of font families used to resolve a Font to faces.
+// The package level functions (PreloadFont, SetDefaultFont, ...) work on the
+// default database returned by FontDatabase. A database created by NewFontDB
+// only resolves fonts that were loaded into it.
+//
+// FontDB is safe for concurrent use.
+type FontDB struct {
+	mu            sync.Mutex
 	fontMap       map[string]*FontFamily
-	fontCache     map[cacheInfo]*rawFont
+	fontCache     map[cacheInfo][]*rawFont
+	coverCache    map[coverKey]*rawFont
+	genericMap    map[string][]string
 	fontLookupDir []string
+	defaultFamily string
+	faceSeq       int
+	cacheGen      int // incremented by resetCache
+	bitmaps       []*BitmapFont
 }
 
-func (db *fontDatabase) SetLookupDirs(paths ...string) {
+func newFontDB() *FontDB {
+	return &FontDB{
+		fontMap:    make(map[string]*FontFamily),
+		fontCache:  make(map[cacheInfo][]*rawFont),
+		coverCache: make(map[coverKey]*rawFont),
+		genericMap: make(map[string][]string)}
+}
+
+// NewFontDB returns an empty font database, isolated from the default one.
+func NewFontDB() *FontDB {
+	return newFontDB()
+}
+
+// SetDefaultFamily sets the family used when a Font has no family or none of
+// its families exists in db. The default database uses SetDefaultFont instead.
+func (db *FontDB) SetDefaultFamily(family string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.defaultFamily = family
+	db.resetCache()
+}
+
+func (db *FontDB) SetLookupDirs(paths ...string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
 	db.fontLookupDir = append(db.fontLookupDir, paths...)
 }
 
-func (db *fontDatabase) FamilyNames() []string {
+func (db *FontDB) lookupDirs() []string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([]string(nil), db.fontLookupDir...)
+}
+
+func (db *FontDB) FamilyNames() []string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.familyNames()
+}
+
+func (db *FontDB) familyNames() []string {
 	var names []string
 	for k, _ := range db.fontMap {
 		names = append(names, k)
@@ -45,7 +97,9 @@ func (db *fontDatabase) FamilyNames() []string {
 	return names
 }
 
-func (db *fontDatabase) Family(name string) *FontFamily {
+func (db *FontDB) Family(name string) *FontFamily {
+	db.mu.Lock()
+	defer db.mu.Unlock()
 	if ff, ok := db.fontMap[name]; ok {
 		return ff
 	}
@@ -57,75 +111,389 @@ func (db *fontDatabase) Family(name string) *FontFamily {
 	return nil
 }
 
-func (db *fontDatabase) MetricsFont(f *Font) (*font.Metrics, error) {
+func (db *FontDB) MetricsFont(f *Font) (*font.Metrics, error) {
 	raw := db.LoadRawFont(f)
+	if raw == nil {
+		return nil, fmt.Errorf("not find font %v", f)
+	}
 	var b sfnt.Buffer
 	m, err := raw.Font.Metrics(&b, fixed.I(f.PointSize), font.HintingNone)
 	return &m, err
 }
 
-func (db *fontDatabase) LoadRawFont(f *Font) *RawFont {
+// FontMetrics returns the metrics of the first face of the fallback chain
+// of f.
+func (db *FontDB) FontMetrics(f *Font) (*FontMetrics, error) {
+	raw := db.LoadRawFont(f)
+	if raw == nil {
+		return nil, fmt.Errorf("not find font %v", f)
+	}
+	return raw.FontMetrics()
+}
+
+func (db *FontDB) LoadRawFont(f *Font) *RawFont {
 	if f == nil {
-		f = defaultFont
+		f = loadDefaultFont()
 	}
-	if f.Family == "" {
-		f.Family = defaultFontFamily.Family
+	fonts := db.loadRawFonts(f)
+	if len(fonts) == 0 {
+		return nil
 	}
-	cache := cacheInfo{Family: f.Family, Weight: f.Weight, Style: f.Style}
-	if raw, ok := db.fontCache[cache]; ok {
-		return &RawFont{raw, f.PointSize}
+	return newRawFont(fonts[0], f)
+}
+
+// LoadRawFonts returns the fallback chain for f: one face for every family
+// of the comma-separated f.Family list that exists (generic families are
+// expanded), followed by the default font and the global fallback font.
+func (db *FontDB) LoadRawFonts(f *Font) []*RawFont {
+	if f == nil {
+		f = loadDefaultFont()
 	}
-	var ff *FontFamily
-	for _, family := range strings.Split(f.Family, ",") {
-		family = strings.TrimSpace(family)
-		ff = db.fontMap[family]
-		if ff != nil {
-			break
+	fonts := db.loadRawFonts(f)
+	ar := make([]*RawFont, len(fonts))
+	for i, raw := range fonts {
+		ar[i] = newRawFont(raw, f)
+	}
+	return ar
+}
+
+// FontProvider returns a FontProvider that resolves every glyph through the
+// fallback chain of f.
+func (db *FontDB) FontProvider(f *Font) FontProvider {
+	fonts := db.LoadRawFonts(f)
+	if len(fonts) == 0 {
+		return nil
+	}
+	if f == nil {
+		f = loadDefaultFont()
+	}
+	return &fallbackFontProvider{fonts: fonts, db: db, font: f}
+}
+
+// loadRawFonts must be called without db.mu held. The families are looked
+// up under the lock and their faces parsed outside of it, so that text
+// drawn by other contexts does not wait for the files to be read.
+func (db *FontDB) loadRawFonts(f *Font) []*rawFont {
+	var defaultFamily *FontFamily
+	var fallback *RawFont
+	db.mu.Lock()
+	if db == defaultFontDatebase {
+		defaultFamily, fallback = fontDefaults()
+	} else if db.defaultFamily != "" {
+		defaultFamily = db.lookupFamily(db.defaultFamily)
+	}
+	families := f.Family
+	if families == "" && defaultFamily != nil {
+		families = defaultFamily.familyName()
+	}
+	cache := cacheInfo{Family: families, Weight: f.Weight, Style: f.Style}
+	if fonts, ok := db.fontCache[cache]; ok {
+		db.mu.Unlock()
+		return fonts
+	}
+	var chain []*FontFamily
+	for _, family := range strings.Split(families, ",") {
+		family = strings.Trim(strings.TrimSpace(family), `"'`)
+		for _, name := range db.expandFamily(family) {
+			if ff := db.lookupFamily(name); ff != nil {
+				chain = append(chain, ff)
+			}
 		}
-		for _, v := range db.fontMap {
-			if v.Family == family || v.FileName == family {
-				ff = v
+	}
+	var others []*FontFamily
+	if db != defaultFontDatebase {
+		for _, name := range db.familyNames() {
+			others = append(others, db.fontMap[name])
+		}
+	}
+	gen := db.cacheGen
+	db.mu.Unlock()
+
+	var fonts []*rawFont
+	add := func(raw *rawFont) {
+		if raw == nil {
+			return
+		}
+		for _, v := range fonts {
+			if v == raw {
+				return
+			}
+		}
+		fonts = append(fonts, raw)
+	}
+	for _, ff := range chain {
+		for _, raw := range ff.LoadRawFonts(f.Style, f.Weight) {
+			add(raw)
+		}
+	}
+	if defaultFamily != nil {
+		add(defaultFamily.LoadRawFont(f.Style, f.Weight))
+	}
+	if fallback != nil {
+		add(fallback.rawFont)
+	}
+	if len(fonts) == 0 {
+		// no default family set, any face of the database is better than none
+		for _, ff := range others {
+			if raw := ff.LoadRawFont(f.Style, f.Weight); raw != nil {
+				add(raw)
 				break
 			}
 		}
 	}
+	db.mu.Lock()
+	if db.cacheGen == gen {
+		// the faces are still those of the database
+		db.fontCache[cache] = fonts
+	}
+	db.mu.Unlock()
+	return fonts
+}
 
-	if ff == nil {
-		ff = defaultFontFamily
+func (db *FontDB) lookupFamily(family string) *FontFamily {
+	if ff, ok := db.fontMap[family]; ok {
+		return ff
 	}
-	if ff == nil {
-		return nil
+	for _, v := range db.fontMap {
+		if v.FileName == family || v.familyName() == family {
+			return v
+		}
 	}
-	raw := ff.LoadRawFont(f.Style, f.Weight)
-	db.fontCache[cache] = raw
+	return nil
+}
 
-	return &RawFont{raw, f.PointSize}
+// generic font families of CSS
+const (
+	FamilySerif     = "serif"
+	FamilySansSerif = "sans-serif"
+	FamilyMonospace = "monospace"
+	FamilyCursive   = "cursive"
+	FamilyFantasy   = "fantasy"
+	FamilySystemUI  = "system-ui"
+	FamilyEmoji     = "emoji"
+)
+
+// genericFamilies are the families tried for a generic family that
+// SetGenericFamily did not map, with the word of the names of the loaded
+// families that are tried next.
+var genericFamilies = map[string]struct {
+	names []string
+	word  string
+}{
+	FamilySerif:     {[]string{"Times New Roman", "Times", "Georgia", "Noto Serif", "DejaVu Serif", "Liberation Serif"}, "serif"},
+	FamilySansSerif: {[]string{"Helvetica", "Arial", "Noto Sans", "DejaVu Sans", "Liberation Sans", "Go"}, "sans"},
+	FamilyMonospace: {[]string{"Menlo", "Courier New", "Noto Sans Mono", "DejaVu Sans Mono", "Liberation Mono", "Go Mono"}, "mono"},
+	FamilySystemUI:  {[]string{"Segoe UI", "San Francisco", "Helvetica Neue", "Noto Sans", "DejaVu Sans", "Go"}, "sans"},
+	FamilyEmoji:     {[]string{"Apple Color Emoji", "Segoe UI Emoji", "Noto Color Emoji"}, "emoji"},
+}
+
+// expandFamily returns the families of a generic family, or family. db.mu
+// must be held.
+func (db *FontDB) expandFamily(family string) []string {
+	generic := strings.ToLower(family)
+	if names, ok := db.genericMap[generic]; ok {
+		return names
+	}
+	if _, ok := genericFamilies[generic]; ok {
+		return db.genericDefaults(generic)
+	}
+	return []string{family}
+}
+
+// genericDefaults returns the families of a generic family that was not
+// mapped by SetGenericFamily: the usual families of the generic family that
+// are loaded, then the loaded families named after it, then the default
+// family, so that a generic family always resolves when db has fonts.
+func (db *FontDB) genericDefaults(generic string) []string {
+	g := genericFamilies[generic]
+	var names []string
+	for _, name := range g.names {
+		if db.lookupFamily(name) != nil {
+			names = append(names, name)
+		}
+	}
+	for _, name := range db.familyNames() {
+		lower := strings.ToLower(name)
+		if !strings.Contains(lower, g.word) || contains(name, names) {
+			continue
+		}
+		if generic == FamilySerif && strings.Contains(lower, "sans") {
+			continue
+		}
+		names = append(names, name)
+	}
+	if db == defaultFontDatebase {
+		if ff, _ := fontDefaults(); ff != nil {
+			names = append(names, ff.familyName())
+		}
+	} else if db.defaultFamily != "" {
+		names = append(names, db.defaultFamily)
+	}
+	return names
+}
+
+// SetGenericFamily maps a generic family (serif, sans-serif, monospace, ...)
+// to the list of installed families used when it appears in Font.Family.
+// Generic families that are not mapped resolve to the usual families of
+// the platforms, the loaded families named after them and the default
+// family.
+func (db *FontDB) SetGenericFamily(generic string, families ...string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.genericMap[strings.ToLower(generic)] = families
+	db.resetCache()
+}
+
+func (db *FontDB) resetCache() {
+	db.cacheGen++
+	db.fontCache = make(map[cacheInfo][]*rawFont)
+	db.coverCache = make(map[coverKey]*rawFont)
+}
+
+type coverKey struct {
+	r      rune
+	weight font.Weight
+	style  font.Style
+}
+
+// faces returns all faces of the database ordered by family and name.
+// Collections that were registered without parsing are loaded.
+func (db *FontDB) faces() []*rawFont {
+	db.mu.Lock()
+	families := make([]*FontFamily, 0, len(db.fontMap))
+	for _, name := range db.familyNames() {
+		families = append(families, db.fontMap[name])
+	}
+	db.mu.Unlock()
+	var ar []*rawFont
+	seen := make(map[*rawFont]bool)
+	for _, ff := range families {
+		for _, raw := range ff.rawFonts() {
+			if !seen[raw] {
+				seen[raw] = true
+				ar = append(ar, raw)
+			}
+		}
+	}
+	return ar
+}
+
+// FacesCovering returns all faces of the database that have a glyph for r.
+func (db *FontDB) FacesCovering(r rune) []*RawFont {
+	var ar []*RawFont
+	for _, raw := range db.faces() {
+		if raw.covers(r) {
+			ar = append(ar, &RawFont{rawFont: raw})
+		}
+	}
+	return ar
+}
+
+// matchFaceCovering returns the face that has a glyph for r and is the
+// closest to the requested weight and style.
+func (db *FontDB) matchFaceCovering(r rune, weight font.Weight, style font.Style) *rawFont {
+	key := coverKey{r, weight, style}
+	db.mu.Lock()
+	raw, ok := db.coverCache[key]
+	gen := db.cacheGen
+	db.mu.Unlock()
+	if ok {
+		return raw
+	}
+	var best *rawFont
+	var bestDist int
+	for _, raw := range db.faces() {
+		if !raw.covers(r) {
+			continue
+		}
+		dist := faceDistance(raw, weight, style)
+		if best == nil || dist < bestDist {
+			best, bestDist = raw, dist
+		}
+	}
+	db.mu.Lock()
+	if db.cacheGen == gen {
+		db.coverCache[key] = best
+	}
+	db.mu.Unlock()
+	return best
+}
+
+func faceDistance(raw *rawFont, weight font.Weight, style font.Style) int {
+	dist := int(raw.Weight - weight)
+	if dist < 0 {
+		dist = -dist
+	}
+	if (raw.Style == font.StyleNormal) != (style == font.StyleNormal) {
+		dist += 10
+	} else if raw.Style != style {
+		dist++
+	}
+	return dist
 }
 
 var (
-	defaultFontDatebase = &fontDatabase{
-		fontMap:   make(map[string]*FontFamily),
-		fontCache: make(map[cacheInfo]*rawFont)}
+	defaultFontDatebase = newFontDB()
+	// guarded by defaultFontMu
 	defaultFontFamily *FontFamily
 	defaultRawFont    *RawFont
 	fallbackRawFont   *RawFont
 )
 
+func fontDefaults() (*FontFamily, *RawFont) {
+	defaultFontMu.RLock()
+	defer defaultFontMu.RUnlock()
+	return defaultFontFamily, fallbackRawFont
+}
+
+func loadDefaultRawFont() *RawFont {
+	defaultFontMu.RLock()
+	defer defaultFontMu.RUnlock()
+	return defaultRawFont
+}
+
 func SetDefaultFont(family string, pointSize int) {
-	defaultFont = &Font{Family: family, PointSize: pointSize}
-	defaultFontFamily = defaultFontDatebase.Family(family)
-	defaultRawFont = defaultFontDatebase.LoadRawFont(defaultFont)
+	f := &Font{Family: family, PointSize: pointSize}
+	ff := defaultFontDatebase.Family(family)
+	defaultFontMu.Lock()
+	defaultFont = f
+	defaultFontFamily = ff
+	defaultFontMu.Unlock()
+	raw := defaultFontDatebase.LoadRawFont(f)
+	defaultFontMu.Lock()
+	defaultRawFont = raw
+	defaultFontMu.Unlock()
+	defaultFontDatebase.mu.Lock()
+	defaultFontDatebase.resetCache()
+	defaultFontDatebase.mu.Unlock()
+}
+
+// SetFallbackFont sets the font used for glyphs missing from every family
+// of a Font.Family list.
+func SetFallbackFont(f *Font) {
+	raw := defaultFontDatebase.LoadRawFont(f)
+	defaultFontMu.Lock()
+	fallbackRawFont = raw
+	defaultFontMu.Unlock()
+	defaultFontDatebase.mu.Lock()
+	defaultFontDatebase.resetCache()
+	defaultFontDatebase.mu.Unlock()
 }
 
 func PreloadFont(family string, fpath ...string) (err error) {
 	return defaultFontDatebase.PreloadFont(family, fpath...)
 }
 
+func SetGenericFamily(generic string, families ...string) {
+	defaultFontDatebase.SetGenericFamily(generic, families...)
+}
+
 func SetFontPaths(paths ...string) {
 	defaultFontDatebase.SetLookupDirs(paths...)
 }
 
-func FontDatabase() *fontDatabase {
+// FontDatabase returns the default font database.
+func FontDatabase() *FontDB {
 	return defaultFontDatebase
 }
 
@@ -138,21 +506,100 @@ type rawFont struct {
 	Style     font.Style
 	Stretch   font.Stretch
 	Font      *sfnt.Font
+	Index     int // face index in a font collection
+	mu        sync.Mutex
+	source    sfntSource
+	coverage  RuneRanges
+	covered   bool
+	desc      *FontFaceDescriptors // set by AddFontFace
+	seq       int                  // order of AddFontFace calls
+	vert      map[uint16]uint16    // vertical alternates, see verticalTables
+	vmetrics  *verticalMetrics
+	vloaded   bool
+	names     map[string]sfnt.GlyphIndex // glyph names, see GlyphByName
 }
 
 type RawFont struct {
 	*rawFont
 	PointSize int
+	Synthetic FontSynthesis // synthesized bold or oblique
 }
 
 func NewRawFont(r *rawFont, pointSize int) *RawFont {
-	return &RawFont{r, pointSize}
+	return &RawFont{rawFont: r, PointSize: pointSize}
+}
+
+// newRawFont returns the face r used for f, synthesizing bold and oblique
+// if r is lighter or more upright than f asks for.
+func newRawFont(r *rawFont, f *Font) *RawFont {
+	var synth FontSynthesis
+	if f.Weight >= font.WeightSemiBold && r.Weight < font.WeightSemiBold && !r.hasWeight(f.Weight) {
+		synth |= SynthesisWeight
+	}
+	if f.Style != font.StyleNormal && r.Style == font.StyleNormal {
+		synth |= SynthesisStyle
+	}
+	return &RawFont{rawFont: r, PointSize: f.PointSize, Synthetic: synth &^ f.NoSynthesis}
+}
+
+// FontMetrics returns the metrics of the face at r.PointSize. The underline
+// comes from the post table and the strikeout from the OS/2 table, they are
+// estimated if missing.
+func (r *RawFont) FontMetrics() (*FontMetrics, error) {
+	var b sfnt.Buffer
+	m, err := r.Font.Metrics(&b, fixed.I(r.PointSize), font.HintingNone)
+	if err != nil {
+		return nil, err
+	}
+	upm := int(r.Font.UnitsPerEm())
+	scale := float64(r.PointSize) / float64(upm)
+	fm := &FontMetrics{
+		Ascent:     fUnitsToFloat64(m.Ascent),
+		Descent:    fUnitsToFloat64(m.Descent),
+		LineGap:    fUnitsToFloat64(m.Height - m.Ascent - m.Descent),
+		UnitsPerEm: upm,
+		XHeight:    fUnitsToFloat64(m.XHeight),
+		CapHeight:  fUnitsToFloat64(m.CapHeight),
+	}
+	if fm.LineGap < 0 {
+		fm.LineGap = 0
+	}
+	if post := r.Font.PostTable(); post != nil && post.UnderlineThickness > 0 {
+		// post stores the top of the underline, y up
+		fm.UnderlineThickness = float64(post.UnderlineThickness) * scale
+		fm.UnderlinePosition = -float64(post.UnderlinePosition)*scale + fm.UnderlineThickness/2
+	} else {
+		fm.UnderlineThickness = float64(r.PointSize) / 14
+		fm.UnderlinePosition = fm.Descent / 2
+	}
+	if os2, err := r.source.table("OS/2"); err == nil && tableReader(os2).i16(26) > 0 {
+		// the strikeout position is the top of the stroke, y up
+		t := tableReader(os2)
+		fm.StrikeoutThickness = float64(t.i16(26)) * scale
+		fm.StrikeoutPosition = -float64(t.i16(28))*scale + fm.StrikeoutThickness/2
+	} else {
+		fm.StrikeoutThickness = fm.UnderlineThickness
+		fm.StrikeoutPosition = -fm.XHeight / 2
+	}
+	return fm, nil
 }
 
 func (r *rawFont) TestSupportText(text string) bool {
+	if cov := r.Coverage(); cov != nil {
+		for _, t := range text {
+			if !cov.Contains(t) || (r.desc != nil && !r.desc.hasRune(t)) {
+				return false
+			}
+		}
+		return true
+	}
+	// a face of the font index is parsed on first use
+	if r.ParseFont() != nil {
+		return false
+	}
 	var b sfnt.Buffer
 	for _, t := range text {
-		index, err := r.Font.GlyphIndex(&b, t)
+		index, err := r.glyphIndex(&b, t)
 		if err != nil {
 			return false
 		}
@@ -163,6 +610,60 @@ func (r *rawFont) TestSupportText(text string) bool {
 	return true
 }
 
+// Coverage returns the runes mapped by the cmap table of the font. It returns
+// nil if the font has no readable cmap table.
+func (r *rawFont) Coverage() RuneRanges {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.covered {
+		return r.coverage
+	}
+	r.covered = true
+	if r.parseFont() != nil {
+		return nil
+	}
+	cmap, err := r.source.table("cmap")
+	if err != nil {
+		return nil
+	}
+	r.coverage, err = parseCmapCoverage(cmap)
+	if err != nil {
+		log.Printf("Coverage: %v, %v\n", r.FullName, err)
+	}
+	return r.coverage
+}
+
+func (r *rawFont) hasWeight(w font.Weight) bool {
+	if r.desc != nil {
+		return r.desc.hasWeight(w)
+	}
+	return r.Weight == w
+}
+
+// glyphIndex is like Font.GlyphIndex but honors the unicode-range of a face
+// registered by AddFontFace.
+func (r *rawFont) glyphIndex(b *sfnt.Buffer, c rune) (sfnt.GlyphIndex, error) {
+	if r.desc != nil && !r.desc.hasRune(c) {
+		return 0, nil
+	}
+	return r.Font.GlyphIndex(b, c)
+}
+
+func (r *rawFont) covers(c rune) bool {
+	if r.desc != nil && !r.desc.hasRune(c) {
+		return false
+	}
+	if cov := r.Coverage(); cov != nil {
+		return cov.Contains(c)
+	}
+	if r.ParseFont() != nil {
+		return false
+	}
+	var b sfnt.Buffer
+	i, err := r.Font.GlyphIndex(&b, c)
+	return err == nil && i != 0
+}
+
 func (r *rawFont) LoadFont(fnt *sfnt.Font) error {
 	r.Font = fnt
 	var b sfnt.Buffer
@@ -200,6 +701,22 @@ func (r *rawFont) LoadData(data []byte) error {
 	if err != nil {
 		return err
 	}
+	r.source = sfntSource{src: bytes.NewReader(data)}
+	return r.LoadFont(fnt)
+}
+
+// loadCollectFont loads the i-th font of the collection c parsed from src.
+func (r *rawFont) loadCollectFont(src io.ReaderAt, c *sfnt.Collection, i int) error {
+	fnt, err := c.Font(i)
+	if err != nil {
+		return err
+	}
+	r.Index = i
+	if offsets := collectionOffsets(src); i < len(offsets) {
+		r.source = sfntSource{src, offsets[i]}
+	} else if i == 0 {
+		r.source = sfntSource{src: src}
+	}
 	return r.LoadFont(fnt)
 }
 
@@ -213,6 +730,12 @@ func (r *rawFont) LoadPath(fpath string) error {
 }
 
 func (r *rawFont) ParseFont() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.parseFont()
+}
+
+func (r *rawFont) parseFont() error {
 	if r.Font != nil {
 		return nil
 	}
@@ -223,10 +746,18 @@ func (r *rawFont) ParseFont() error {
 	if err != nil {
 		return err
 	}
+	if collectionOffsets(read) != nil {
+		c, err := sfnt.ParseCollectionReaderAt(read)
+		if err != nil {
+			return err
+		}
+		return r.loadCollectFont(read, c, r.Index)
+	}
 	fnt, err := sfnt.ParseReaderAt(read)
 	if err != nil {
 		return err
 	}
+	r.source = sfntSource{src: read}
 	r.LoadFont(fnt)
 	return nil
 }
@@ -301,18 +832,40 @@ func (r *rawFont) parserSubfamily(sub string) {
 	}
 }
 
+// FontFamily is a family of faces of a FontDB. A family registered with the
+// path of a collection in Collect loads its faces when they are first used,
+// Family then changes to the family of the faces.
 type FontFamily struct {
+	mu         sync.Mutex // guards Family, RawFontMap and collected
 	FileName   string
 	Family     string
 	Collect    string
 	RawFontMap map[string]*rawFont
+	collected  bool // the faces of Collect were loaded
 }
 
 func NewFontFamily(filename string, family string) *FontFamily {
 	return &FontFamily{FileName: filename, Family: family, RawFontMap: make(map[string]*rawFont)}
 }
 
-func (ff *FontFamily) loadCollect(fpath string) error {
+// familyName returns Family, which changes when a collection is loaded.
+func (ff *FontFamily) familyName() string {
+	ff.mu.Lock()
+	defer ff.mu.Unlock()
+	return ff.Family
+}
+
+// loadCollect loads the faces of Collect if they are not yet. The file is
+// parsed without ff.mu held, so that the lookups of the family in its
+// database do not wait for it.
+func (ff *FontFamily) loadCollect() error {
+	ff.mu.Lock()
+	fpath := ff.Collect
+	loaded := fpath == "" || ff.collected
+	ff.mu.Unlock()
+	if loaded {
+		return nil
+	}
 	r, err := os.Open(fpath)
 	if err != nil {
 		return err
@@ -321,19 +874,29 @@ func (ff *FontFamily) loadCollect(fpath string) error {
 	if err != nil {
 		return err
 	}
-	ff.RawFontMap = make(map[string]*rawFont)
+	var faces []*rawFont
 	for i := 0; i < c.NumFonts(); i++ {
-		fnt, err := c.Font(i)
-		if err != nil {
-			continue
-		}
-		raw := &rawFont{}
-		err = raw.LoadFont(fnt)
+		raw := &rawFont{Path: fpath}
+		err = raw.loadCollectFont(r, c, i)
 		if err != nil {
 			log.Printf("LoadFont: %v\n", err)
 			continue
 		}
-		ff.RawFontMap[raw.FullName] = raw
+		faces = append(faces, raw)
+	}
+	ff.mu.Lock()
+	defer ff.mu.Unlock()
+	if ff.collected {
+		return nil // by another goroutine
+	}
+	ff.collected = true
+	if ff.RawFontMap == nil {
+		ff.RawFontMap = make(map[string]*rawFont)
+	}
+	for _, raw := range faces {
+		if _, ok := ff.RawFontMap[raw.FullName]; !ok {
+			ff.RawFontMap[raw.FullName] = raw
+		}
 		ff.Family = raw.Family
 	}
 	return nil
@@ -356,24 +919,91 @@ func (ff *FontFamily) checkRawFontList(chks ...*checkFont) *rawFont {
 
 func (ff *FontFamily) checkRawFont(chk *checkFont) *rawFont {
 	for _, raw := range ff.RawFontMap {
-		if raw.Weight == chk.weight && raw.Style == chk.style {
+		if raw.hasWeight(chk.weight) && raw.Style == chk.style {
 			return raw
 		}
 	}
 	return nil
 }
 
-func (ff *FontFamily) LoadRawFont(style font.Style, weight font.Weight) *rawFont {
+// addRawFont registers raw as name in the family. RawFontMap is only
+// changed with ff.mu held, the readers of a family do not hold db.mu. A
+// face added by AddFontFace does not replace a face of the same name, it
+// is registered under another.
+func (ff *FontFamily) addRawFont(name string, raw *rawFont) {
+	ff.mu.Lock()
+	defer ff.mu.Unlock()
 	if ff.RawFontMap == nil {
-		if ff.Collect == "" {
-			return nil
+		ff.RawFontMap = make(map[string]*rawFont)
+	}
+	if _, ok := ff.RawFontMap[name]; ok && raw.desc != nil {
+		name = fmt.Sprintf("%v #%v", name, len(ff.RawFontMap))
+	}
+	ff.RawFontMap[name] = raw
+}
+
+// rawFonts returns the faces of the family, loading a lazy collection.
+func (ff *FontFamily) rawFonts() []*rawFont {
+	if err := ff.loadCollect(); err != nil {
+		log.Printf("LoadCollect: %v\n", err)
+		return nil
+	}
+	ff.mu.Lock()
+	defer ff.mu.Unlock()
+	var names []string
+	for k := range ff.RawFontMap {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	ar := make([]*rawFont, len(names))
+	for i, k := range names {
+		ar[i] = ff.RawFontMap[k]
+	}
+	return ar
+}
+
+// LoadRawFonts returns the face of LoadRawFont together with the faces added
+// by AddFontFace with the same descriptors but another unicode-range. Like in
+// CSS, they make up one face and the last added is looked up first.
+func (ff *FontFamily) LoadRawFonts(style font.Style, weight font.Weight) []*rawFont {
+	raw := ff.LoadRawFont(style, weight)
+	if raw == nil {
+		return nil
+	}
+	if raw.desc == nil {
+		return []*rawFont{raw}
+	}
+	var fonts []*rawFont
+	min, max := raw.desc.weightRange()
+	for _, v := range ff.rawFonts() {
+		if v.desc == nil || v.Style != raw.Style || v.Stretch != raw.Stretch {
+			continue
 		}
-		err := ff.loadCollect(ff.Collect)
-		if err != nil {
-			log.Printf("LoadCollect: %v\n", err)
-			return nil
+		if vmin, vmax := v.desc.weightRange(); vmin == min && vmax == max && v.ParseFont() == nil {
+			fonts = append(fonts, v)
 		}
 	}
+	sort.Slice(fonts, func(i, j int) bool { return fonts[i].seq > fonts[j].seq })
+	return fonts
+}
+
+func (ff *FontFamily) LoadRawFont(style font.Style, weight font.Weight) *rawFont {
+	raw := ff.matchRawFont(style, weight)
+	if raw == nil || raw.ParseFont() != nil {
+		return nil
+	}
+	return raw
+}
+
+// matchRawFont returns the face of the family closest to style and weight,
+// which may not be parsed yet.
+func (ff *FontFamily) matchRawFont(style font.Style, weight font.Weight) *rawFont {
+	if err := ff.loadCollect(); err != nil {
+		log.Printf("LoadCollect: %v\n", err)
+		return nil
+	}
+	ff.mu.Lock()
+	defer ff.mu.Unlock()
 	var raw *rawFont
 	if style == font.StyleItalic {
 
@@ -424,10 +1054,6 @@ func (ff *FontFamily) LoadRawFont(style font.Style, weight font.Weight) *rawFont
 		sort.Strings(names)
 		raw = ff.RawFontMap[names[0]]
 	}
-	err := raw.ParseFont()
-	if err != nil {
-		return nil
-	}
 	return raw
 }
 
@@ -463,7 +1089,7 @@ func splitUpper(s string, skips []string) []string {
 	return ar
 }
 
-func (db *fontDatabase) LoadCollectFile(fpath string) error {
+func (db *FontDB) LoadCollectFile(fpath string) error {
 	r, err := os.Open(fpath)
 	if err != nil {
 		return err
@@ -472,17 +1098,15 @@ func (db *fontDatabase) LoadCollectFile(fpath string) error {
 	if err != nil {
 		return err
 	}
-	return db.loadCollect(c)
+	return db.loadCollect(fpath, r, c)
 }
 
-func (db *fontDatabase) loadCollect(c *sfnt.Collection) error {
+func (db *FontDB) loadCollect(fpath string, src io.ReaderAt, c *sfnt.Collection) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
 	for i := 0; i < c.NumFonts(); i++ {
-		fnt, err := c.Font(i)
-		if err != nil {
-			continue
-		}
-		raw := &rawFont{}
-		err = raw.LoadFont(fnt)
+		raw := &rawFont{Path: fpath}
+		err := raw.loadCollectFont(src, c, i)
 		if err != nil {
 			log.Printf("LoadFont: %v\n", err)
 			continue
@@ -492,39 +1116,85 @@ func (db *fontDatabase) loadCollect(c *sfnt.Collection) error {
 			f = NewFontFamily(raw.Family, raw.Family)
 			db.fontMap[raw.Family] = f
 		}
-		f.RawFontMap[raw.FullName] = raw
+		f.addRawFont(raw.FullName, raw)
 	}
+	db.resetCache()
 	return nil
 }
 
-func (db *fontDatabase) LoadCollectData(data []byte) error {
+func (db *FontDB) LoadCollectData(data []byte) error {
 	c, err := sfnt.ParseCollection(data)
 	if err != nil {
 		return err
 	}
-	return db.loadCollect(c)
+	return db.loadCollect("", bytes.NewReader(data), c)
 }
 
-func (db *fontDatabase) LoadFontData(data []byte) error {
-	fnt, err := sfnt.Parse(data)
-	if err != nil {
-		return err
-	}
+func (db *FontDB) LoadFontData(data []byte) error {
 	raw := &rawFont{}
-	err = raw.LoadFont(fnt)
+	err := raw.LoadData(data)
 	if err != nil {
 		return err
 	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
 	f, ok := db.fontMap[raw.Family]
 	if !ok {
 		f = NewFontFamily(raw.Family, raw.Family)
 		db.fontMap[raw.Family] = f
 	}
-	f.RawFontMap[raw.FullName] = raw
+	f.addRawFont(raw.FullName, raw)
+	db.resetCache()
+	return nil
+}
+
+// AddFontFace registers a face for family in db, like a CSS @font-face rule.
+// The descriptors replace the weight, style and stretch read from the font.
+func (db *FontDB) AddFontFace(family string, desc FontFaceDescriptors, src FontSource) error {
+	data, err := src.data()
+	if err != nil {
+		return err
+	}
+	desc.UnicodeRange = append(RuneRanges(nil), desc.UnicodeRange...).normalize()
+	return db.addFontFace(family, &desc, src, data)
+}
+
+func (db *FontDB) addFontFace(family string, desc *FontFaceDescriptors, src FontSource, data []byte) error {
+	c, err := sfnt.ParseCollection(data)
+	if err != nil {
+		return err
+	}
+	raw := &rawFont{}
+	if src.FS == nil {
+		raw.Path = src.Path
+	}
+	if err = raw.loadCollectFont(bytes.NewReader(data), c, 0); err != nil {
+		return err
+	}
+	raw.Family = family
+	raw.Weight, _ = desc.weightRange()
+	raw.Style = desc.Style
+	raw.Stretch = desc.Stretch
+	raw.desc = desc
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	f, ok := db.fontMap[family]
+	if !ok {
+		f = NewFontFamily(family, family)
+		db.fontMap[family] = f
+	}
+	db.faceSeq++
+	raw.seq = db.faceSeq
+	f.addRawFont(raw.FullName, raw)
+	db.resetCache()
 	return nil
 }
 
-func (db *fontDatabase) PreloadFont(family string, fpath ...string) (err error) {
+func addFontFace(family string, desc *FontFaceDescriptors, src FontSource, data []byte) error {
+	return defaultFontDatebase.addFontFace(family, desc, src, data)
+}
+
+func (db *FontDB) PreloadFont(family string, fpath ...string) (err error) {
 	for _, f := range fpath {
 		if filepath.IsAbs(f) {
 			err = db.loadFontFile(family, f, true)
@@ -532,7 +1202,7 @@ func (db *fontDatabase) PreloadFont(family string, fpath ...string) (err error)
 				return
 			}
 		} else {
-			for _, dir := range db.fontLookupDir {
+			for _, dir := range db.lookupDirs() {
 				err = db.loadFontFile(family, filepath.Join(dir, f), true)
 				if err == nil {
 					return
@@ -543,12 +1213,12 @@ func (db *fontDatabase) PreloadFont(family string, fpath ...string) (err error)
 	return fmt.Errorf("not find font %q", family)
 }
 
-func (db *fontDatabase) PreloadFonts(fpath ...string) {
+func (db *FontDB) PreloadFonts(fpath ...string) {
 	for _, f := range fpath {
 		if filepath.IsAbs(f) {
 			db.loadFontFile("", f, true)
 		} else {
-			for _, dir := range db.fontLookupDir {
+			for _, dir := range db.lookupDirs() {
 				if db.loadFontFile("", filepath.Join(dir, f), true) == nil {
 					break
 				}
@@ -557,11 +1227,11 @@ func (db *fontDatabase) PreloadFonts(fpath ...string) {
 	}
 }
 
-func (db *fontDatabase) LoadFontFile(path string) error {
+func (db *FontDB) LoadFontFile(path string) error {
 	return db.loadFontFile("", path, true)
 }
 
-func (db *fontDatabase) loadFontFile(fname string, path string, parse bool) error {
+func (db *FontDB) loadFontFile(fname string, path string, parse bool) error {
 	name := filepath.Base(path)
 	ext := filepath.Ext(name)
 	raw := &rawFont{}
@@ -572,19 +1242,22 @@ func (db *fontDatabase) loadFontFile(fname string, path string, parse bool) erro
 			return fmt.Errorf("ParseFont: %v, %v", name, err)
 		}
 	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
 	f, ok := db.fontMap[raw.Family]
 	if !ok {
 		f = NewFontFamily(name[:len(name)-len(ext)], raw.Family)
 		db.fontMap[raw.Family] = f
 	}
-	f.RawFontMap[raw.FullName] = raw
+	f.addRawFont(raw.FullName, raw)
 	if fname != "" {
 		db.fontMap[fname] = f
 	}
+	db.resetCache()
 	return nil
 }
 
-func (db *fontDatabase) LoadFontDir(root string, parse bool) error {
+func (db *FontDB) LoadFontDir(root string, parse bool) error {
 	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if info.IsDir() {
 			return nil
@@ -601,13 +1274,24 @@ func (db *fontDatabase) LoadFontDir(root string, parse bool) error {
 			} else {
 				name = name[:len(name)-4]
 				fi := &FontFamily{FileName: name, Family: name, Collect: path}
+				db.mu.Lock()
 				db.fontMap[fi.Family] = fi
+				db.resetCache()
+				db.mu.Unlock()
 			}
 		case ".ttf", ".otf":
 			err := db.loadFontFile("", path, parse)
 			if err != nil {
 				log.Println(err)
 			}
+		case ".bdf", ".pcf", ".gz":
+			if ext == ".gz" && !strings.HasSuffix(name, ".pcf.gz") && !strings.HasSuffix(name, ".bdf.gz") {
+				break
+			}
+			err := db.LoadBitmapFontFile(path)
+			if err != nil {
+				log.Println(err)
+			}
 		}
 		return nil
 	})
@@ -625,7 +1309,7 @@ type TableFontProvider struct {
 }
 
 func NewTableFontProvider(tabs ...*unicode.RangeTable) *TableFontProvider {
-	return &TableFontProvider{tabs, defaultRawFont, make(map[*unicode.RangeTable]*RawFont)}
+	return &TableFontProvider{tabs, loadDefaultRawFont(), make(map[*unicode.RangeTable]*RawFont)}
 }
 
 func (p *TableFontProvider) SetBackupRawFont(raw *RawFont) {
@@ -668,6 +1352,43 @@ func (p *TableFontProvider) GlyphIndex(b *sfnt.Buffer, r rune) (sfnt.GlyphIndex,
 	return i, p.Backup, err
 }
 
+// fallbackFontProvider resolves a rune to the first font of fonts that has a
+// glyph for it. If none has, the installed face covering the rune that best
+// matches the requested weight and style is used, and finally the .notdef
+// glyph of the first font.
+type fallbackFontProvider struct {
+	fonts []*RawFont
+	db    *FontDB
+	font  *Font
+	auto  map[*rawFont]*RawFont
+}
+
+func (p *fallbackFontProvider) GlyphIndex(b *sfnt.Buffer, r rune) (sfnt.GlyphIndex, *RawFont, error) {
+	for _, f := range p.fonts {
+		i, err := f.glyphIndex(b, r)
+		if i != 0 && err == nil {
+			return i, f, nil
+		}
+	}
+	if p.db != nil && !unicode.IsControl(r) {
+		if raw := p.db.matchFaceCovering(r, p.font.Weight, p.font.Style); raw != nil {
+			f, ok := p.auto[raw]
+			if !ok {
+				if p.auto == nil {
+					p.auto = make(map[*rawFont]*RawFont)
+				}
+				f = newRawFont(raw, p.font)
+				p.auto[raw] = f
+			}
+			i, err := f.glyphIndex(b, r)
+			if i != 0 && err == nil {
+				return i, f, nil
+			}
+		}
+	}
+	return 0, p.fonts[0], nil
+}
+
 type CJKFontProvider struct {
 	Latin  *RawFont
 	Han    *RawFont
@@ -3,6 +3,10 @@
 
 package canvas
 
+import (
+	"image"
+)
+
 func PreloadFont(family string, fpath ...string) (err error) {
 	return nil
 }
@@ -12,3 +16,48 @@ func SetDefaultFont(family string, pointSize int) {
 
 func SetFontPaths(paths ...string) {
 }
+
+type FontDB struct {
+}
+
+func NewFontDB() *FontDB {
+	return &FontDB{}
+}
+
+func FontDatabase() *FontDB {
+	return nil
+}
+
+func addFontFace(family string, desc *FontFaceDescriptors, src FontSource, data []byte) error {
+	return nil
+}
+
+type RawFont struct {
+}
+
+func ShapeText(text string, fnt *Font) *GlyphRun {
+	return &GlyphRun{Text: text}
+}
+
+func (db *FontDB) ShapeText(text string, fnt *Font) *GlyphRun {
+	return &GlyphRun{Text: text}
+}
+
+type BitmapFont struct {
+}
+
+func (db *FontDB) bitmapFont(f *Font) (*BitmapFont, int) {
+	return nil, 0
+}
+
+func (f *BitmapFont) Advance(text string) int {
+	return 0
+}
+
+func (f *BitmapFont) metrics(k int) *FontMetrics {
+	return nil
+}
+
+func (f *BitmapFont) textMask(text string, k int) *image.Alpha {
+	return nil
+}
@@ -0,0 +1,325 @@
+//go:build !nofont
+// +build !nofont
+
+package canvas
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sync"
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomedium"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/sfnt"
+)
+
+// TestFontDBConcurrentLoad draws text from several contexts while fonts are
+// loaded into their database, run it with -race.
+func TestFontDBConcurrentLoad(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "goitalic.ttf"), goitalic.TTF, 0644); err != nil {
+		t.Fatal(err)
+	}
+	db := NewFontDB()
+	for _, data := range [][]byte{goregular.TTF, gomono.TTF} {
+		if err := db.LoadFontData(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gc := NewGraphicContext2DWithFonts(64, 32, db)
+			gc.SetFont(&Font{Family: "Face, Go Mono, Go", PointSize: 12, Weight: font.WeightBold})
+			for j := 0; j < n; j++ {
+				gc.FillText("Hello", 2, 20)
+				gc.MeasureText("Hello")
+				db.FacesCovering('x')
+				db.matchFaceCovering('y', font.WeightNormal, font.StyleItalic)
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < n; j++ {
+			for k := 0; k < 50; k++ {
+				if err := db.LoadFontData(gobold.TTF); err != nil {
+					t.Error(err)
+				}
+			}
+			if err := db.AddFontFace("Face", FontFaceDescriptors{WeightMin: font.WeightMedium}, FontSourceData(gomedium.TTF)); err != nil {
+				t.Error(err)
+			}
+			if err := db.LoadFontDirIndexed(dir, filepath.Join(dir, "fonts.json")); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	wg.Add(1)
+	go func() {
+		// the loaders above against a reader of the faces alone
+		defer wg.Done()
+		for j := 0; j < 50*n; j++ {
+			db.FacesCovering('x')
+		}
+	}()
+	wg.Wait()
+	for _, family := range []string{"Go", "Go Mono", "Face"} {
+		if db.Family(family) == nil {
+			t.Errorf("family %q not loaded", family)
+		}
+	}
+	if faces := db.FacesCovering('x'); len(faces) < 4 {
+		t.Errorf("FacesCovering('x') = %d faces, want at least 4", len(faces))
+	}
+}
+
+// collection returns a font collection of the fonts.
+func collection(fonts ...[]byte) []byte {
+	be := binary.BigEndian
+	header := 12 + 4*len(fonts)
+	out := make([]byte, header)
+	copy(out, "ttcf")
+	be.PutUint32(out[4:], 0x00010000)
+	be.PutUint32(out[8:], uint32(len(fonts)))
+	for i, data := range fonts {
+		for len(out)%4 != 0 {
+			out = append(out, 0)
+		}
+		base := len(out)
+		be.PutUint32(out[12+4*i:], uint32(base))
+		out = append(out, data...)
+		// the offsets of the tables are from the start of the collection
+		n := int(be.Uint16(data[4:]))
+		for j := 0; j < n; j++ {
+			offset := out[base+12+16*j+8:]
+			be.PutUint32(offset, be.Uint32(offset)+uint32(base))
+		}
+	}
+	return out
+}
+
+// TestFontDBLazyCollection looks families up while a collection registered
+// without parsing is loaded, run it with -race.
+func TestFontDBLazyCollection(t *testing.T) {
+	// the loads and lookups interleave on a single CPU too
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "pair.ttc"), collection(goregular.TTF, gobold.TTF), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		db := NewFontDB()
+		if err := db.LoadFontDir(dir, false); err != nil {
+			t.Fatal(err)
+		}
+		var wg sync.WaitGroup
+		for j := 0; j < 4; j++ {
+			wg.Add(1)
+			go func(j int) {
+				defer wg.Done()
+				// families missing from the cache look up every family
+				for k := 0; k < 50; k++ {
+					db.LoadRawFont(&Font{Family: fmt.Sprintf("Missing %d %d, Go", j, k), PointSize: 12})
+				}
+			}(j)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			db.LoadRawFont(&Font{Family: "pair", PointSize: 12, Weight: font.WeightBold})
+		}()
+		wg.Wait()
+		if ff := db.Family("pair"); ff == nil || ff.familyName() != "Go" {
+			t.Fatalf("family of pair.ttc = %v, want Go", ff)
+		}
+		raw := db.LoadRawFont(&Font{Family: "Go", PointSize: 12, Weight: font.WeightBold})
+		if raw == nil || raw.FullName != "Go Bold" {
+			t.Fatalf("LoadRawFont(Go, bold) = %v, want Go Bold", raw)
+		}
+	}
+}
+
+// TestFontDBCacheReset checks that faces loaded after a lookup are found.
+func TestFontDBCacheReset(t *testing.T) {
+	db := NewFontDB()
+	if err := db.LoadFontData(goregular.TTF); err != nil {
+		t.Fatal(err)
+	}
+	f := &Font{Family: "Go Mono", PointSize: 12}
+	if raw := db.LoadRawFont(f); raw == nil || raw.Family != "Go" {
+		t.Fatalf("LoadRawFont(%v) = %v, want the Go family", f.Family, raw)
+	}
+	if err := db.LoadFontData(gomono.TTF); err != nil {
+		t.Fatal(err)
+	}
+	if raw := db.LoadRawFont(f); raw == nil || raw.Family != "Go Mono" {
+		t.Fatalf("LoadRawFont(%v) after loading it = %v", f.Family, raw)
+	}
+}
+
+// TestGenericFamilies checks the families generic families resolve to when
+// SetGenericFamily did not map them.
+func TestGenericFamilies(t *testing.T) {
+	db := NewFontDB()
+	for _, data := range [][]byte{goregular.TTF, gomono.TTF} {
+		if err := db.LoadFontData(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.SetDefaultFamily("Go")
+	tests := []struct {
+		family string
+		want   []string // families of the fallback chain
+	}{
+		{"monospace", []string{"Go Mono", "Go"}},
+		{"sans-serif", []string{"Go"}},
+		{"system-ui", []string{"Go"}},
+		{"serif", []string{"Go"}},
+		{"Missing, monospace", []string{"Go Mono", "Go"}},
+		{"Go, MONOSPACE", []string{"Go", "Go Mono"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, raw := range db.LoadRawFonts(&Font{Family: tt.family, PointSize: 12}) {
+			got = append(got, raw.Family)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("LoadRawFonts(%q) = %q, want %q", tt.family, got, tt.want)
+		}
+	}
+
+	db.SetGenericFamily("monospace", "Go")
+	if raw := db.LoadRawFont(&Font{Family: "monospace", PointSize: 12}); raw == nil || raw.Family != "Go" {
+		t.Errorf("LoadRawFont(monospace) after SetGenericFamily = %v, want Go", raw)
+	}
+}
+
+// TestCoverageFallback checks that runes missing from the fallback chain of
+// a font are drawn with the face covering them that is closest in weight.
+func TestCoverageFallback(t *testing.T) {
+	db := NewFontDB()
+	latin := FontFaceDescriptors{UnicodeRange: RuneRanges{{0, 0x7f}}}
+	if err := db.AddFontFace("Latin", latin, FontSourceData(goregular.TTF)); err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range [][]byte{gobold.TTF, gomono.TTF} {
+		if err := db.LoadFontData(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		r      rune
+		weight font.Weight
+		want   string // family of the face of r
+	}{
+		{'a', font.WeightNormal, "Latin"},
+		{'a', font.WeightBold, "Latin"},
+		{'é', font.WeightNormal, "Go Mono"},
+		{'é', font.WeightBold, "Go"},
+		{'Ж', font.WeightExtraBold, "Go"},
+	}
+	for _, tt := range tests {
+		fp := db.FontProvider(&Font{Family: "Latin", PointSize: 12, Weight: tt.weight})
+		var b sfnt.Buffer
+		gi, raw, err := fp.GlyphIndex(&b, tt.r)
+		if err != nil || gi == 0 {
+			t.Errorf("GlyphIndex(%q, %v) = %v, %v", tt.r, tt.weight, gi, err)
+			continue
+		}
+		if raw.Family != tt.want {
+			t.Errorf("GlyphIndex(%q, %v) is of %q, want %q", tt.r, tt.weight, raw.Family, tt.want)
+		}
+	}
+}
+
+// TestContextFontDatabase checks that contexts resolve fonts in their own
+// database only.
+func TestContextFontDatabase(t *testing.T) {
+	mono, regular := NewFontDB(), NewFontDB()
+	if err := mono.LoadFontData(gomono.TTF); err != nil {
+		t.Fatal(err)
+	}
+	if err := regular.LoadFontData(goregular.TTF); err != nil {
+		t.Fatal(err)
+	}
+	fnt := &Font{Family: "Go Mono", PointSize: 20}
+	tests := []struct {
+		db     *FontDB
+		family string // of the face fnt resolves to
+	}{
+		{mono, "Go Mono"},
+		{regular, "Go"},
+	}
+	widths := map[float64]bool{}
+	for _, tt := range tests {
+		gc := NewGraphicContext2DWithFonts(100, 40, tt.db)
+		if gc.FontDatabase() != tt.db {
+			t.Fatal("FontDatabase is not the database of the context")
+		}
+		gc.SetFont(fnt)
+		w := gc.MeasureText("iiii")
+		if want := NewPath().MeasureTextByDB("iiii", fnt, tt.db); w != want {
+			t.Errorf("MeasureText = %v, want %v of MeasureTextByDB", w, want)
+		}
+		widths[w] = true
+		if raw := tt.db.LoadRawFont(fnt); raw == nil || raw.Family != tt.family {
+			t.Errorf("LoadRawFont(%v) = %v, want %v", fnt.Family, raw, tt.family)
+		}
+		gc.SetFontDatabase(nil)
+		if gc.FontDatabase() != FontDatabase() {
+			t.Error("SetFontDatabase(nil) does not restore the default database")
+		}
+	}
+	if len(widths) != 2 {
+		t.Errorf("contexts of both databases measure the same width %v", widths)
+	}
+	if FontDatabase().Family("Go Mono") == mono.Family("Go Mono") {
+		t.Error("the fonts of a database are in the default database")
+	}
+}
+
+// TestFontMetricsStrikeout checks the strikeout read from the OS/2 table,
+// whose position is the top of the stroke.
+func TestFontMetricsStrikeout(t *testing.T) {
+	tests := []struct {
+		size, position uint16 // yStrikeoutSize and yStrikeoutPosition
+		thickness      float64
+		center         float64 // y down
+	}{
+		{100, 600, 100, -550},
+		{50, 1000, 50, -975},
+		{200, 0, 200, 100},
+	}
+	for _, tt := range tests {
+		data := withOS2(t, goregular.TTF, 26, tt.size)
+		data = withOS2(t, data, 28, tt.position)
+		db := NewFontDB()
+		if err := db.LoadFontData(data); err != nil {
+			t.Fatal(err)
+		}
+		raw := db.LoadRawFont(&Font{Family: "Go", PointSize: 12})
+		// at a size of one pixel per unit
+		m, err := NewRawFont(raw.rawFont, int(raw.Font.UnitsPerEm())).FontMetrics()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.StrikeoutThickness != tt.thickness || m.StrikeoutPosition != tt.center {
+			t.Errorf("strikeout of %d at %d = %v at %v, want %v at %v", tt.size, tt.position,
+				m.StrikeoutThickness, m.StrikeoutPosition, tt.thickness, tt.center)
+		}
+	}
+}
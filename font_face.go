@@ -0,0 +1,168 @@
+package canvas
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/font"
+)
+
+// FontFaceDescriptors describes a face registered by AddFontFace, like the
+// descriptors of a CSS @font-face rule.
+type FontFaceDescriptors struct {
+	WeightMin    font.Weight  // the face is used for weights in [WeightMin, WeightMax]
+	WeightMax    font.Weight  // WeightMax < WeightMin means WeightMin only
+	Style        font.Style   // default font.StyleNormal
+	Stretch      font.Stretch // default font.StretchNormal
+	UnicodeRange RuneRanges   // runes the face is used for, nil means all
+}
+
+func (d *FontFaceDescriptors) weightRange() (min, max font.Weight) {
+	if d.WeightMax < d.WeightMin {
+		return d.WeightMin, d.WeightMin
+	}
+	return d.WeightMin, d.WeightMax
+}
+
+func (d *FontFaceDescriptors) hasWeight(w font.Weight) bool {
+	min, max := d.weightRange()
+	return w >= min && w <= max
+}
+
+func (d *FontFaceDescriptors) hasRune(r rune) bool {
+	return d.UnicodeRange == nil || d.UnicodeRange.Contains(r)
+}
+
+// FontSource is the font data of AddFontFace: bytes, a file path, or a file
+// of a fs.FS such as an embed.FS.
+type FontSource struct {
+	Data []byte
+	Path string
+	FS   fs.FS // if not nil, Path is a name in FS
+}
+
+func FontSourceData(data []byte) FontSource {
+	return FontSource{Data: data}
+}
+
+func FontSourceFile(path string) FontSource {
+	return FontSource{Path: path}
+}
+
+func FontSourceFS(fsys fs.FS, name string) FontSource {
+	return FontSource{Path: name, FS: fsys}
+}
+
+func (s FontSource) data() ([]byte, error) {
+	switch {
+	case s.Data != nil:
+		return s.Data, nil
+	case s.FS != nil:
+		return fs.ReadFile(s.FS, s.Path)
+	case s.Path != "":
+		return os.ReadFile(s.Path)
+	}
+	return nil, fmt.Errorf("empty font source")
+}
+
+// AddFontFace registers a face for family in the default font database and,
+// on the web backend, adds it to document.fonts as a FontFace.
+func AddFontFace(family string, desc FontFaceDescriptors, src FontSource) error {
+	data, err := src.data()
+	if err != nil {
+		return err
+	}
+	desc.UnicodeRange = append(RuneRanges(nil), desc.UnicodeRange...).normalize()
+	if err := addFontFace(family, &desc, src, data); err != nil {
+		return err
+	}
+	return addWebFontFace(family, &desc, data)
+}
+
+// RuneRange is an inclusive range of runes
+type RuneRange struct {
+	Lo, Hi rune
+}
+
+// RuneRanges is a sorted list of non overlapping rune ranges
+type RuneRanges []RuneRange
+
+func (rs RuneRanges) Contains(r rune) bool {
+	i := sort.Search(len(rs), func(i int) bool { return rs[i].Hi >= r })
+	return i < len(rs) && rs[i].Lo <= r
+}
+
+// Len returns the number of runes in the ranges.
+func (rs RuneRanges) Len() int {
+	var n int
+	for _, v := range rs {
+		n += int(v.Hi-v.Lo) + 1
+	}
+	return n
+}
+
+func (rs RuneRanges) normalize() RuneRanges {
+	if len(rs) == 0 {
+		return rs
+	}
+	sort.Slice(rs, func(i, j int) bool { return rs[i].Lo < rs[j].Lo })
+	out := rs[:1]
+	for _, v := range rs[1:] {
+		last := &out[len(out)-1]
+		if v.Lo <= last.Hi+1 {
+			if v.Hi > last.Hi {
+				last.Hi = v.Hi
+			}
+			continue
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// ParseUnicodeRange parses a CSS unicode-range value like "U+0-7F, U+4??".
+func ParseUnicodeRange(s string) (RuneRanges, error) {
+	var rs RuneRanges
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if len(v) < 3 || (v[0] != 'U' && v[0] != 'u') || v[1] != '+' {
+			return nil, fmt.Errorf("invalid unicode range %q", v)
+		}
+		v = v[2:]
+		var lo, hi string
+		if pos := strings.Index(v, "-"); pos != -1 {
+			lo, hi = v[:pos], v[pos+1:]
+		} else if strings.HasSuffix(v, "?") {
+			lo, hi = strings.ReplaceAll(v, "?", "0"), strings.ReplaceAll(v, "?", "F")
+		} else {
+			lo, hi = v, v
+		}
+		l, err := strconv.ParseUint(lo, 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid unicode range %q", v)
+		}
+		h, err := strconv.ParseUint(hi, 16, 32)
+		if err != nil || h < l {
+			return nil, fmt.Errorf("invalid unicode range %q", v)
+		}
+		rs = append(rs, RuneRange{rune(l), rune(h)})
+	}
+	return rs.normalize(), nil
+}
+
+// String returns rs in the CSS unicode-range syntax.
+func (rs RuneRanges) String() string {
+	ar := make([]string, len(rs))
+	for i, v := range rs {
+		if v.Lo == v.Hi {
+			ar[i] = fmt.Sprintf("U+%X", v.Lo)
+		} else {
+			ar[i] = fmt.Sprintf("U+%X-%X", v.Lo, v.Hi)
+		}
+	}
+	return strings.Join(ar, ", ")
+}
@@ -0,0 +1,52 @@
+//go:build js && !wegame && !weapp
+// +build js,!wegame,!weapp
+
+package canvas
+
+import (
+	"fmt"
+	"syscall/js"
+
+	"golang.org/x/image/font"
+)
+
+var cssStretch = map[font.Stretch]string{
+	font.StretchUltraCondensed: "ultra-condensed",
+	font.StretchExtraCondensed: "extra-condensed",
+	font.StretchCondensed:      "condensed",
+	font.StretchSemiCondensed:  "semi-condensed",
+	font.StretchNormal:         "normal",
+	font.StretchSemiExpanded:   "semi-expanded",
+	font.StretchExpanded:       "expanded",
+	font.StretchExtraExpanded:  "extra-expanded",
+	font.StretchUltraExpanded:  "ultra-expanded",
+}
+
+// addWebFontFace creates a FontFace from data and adds it to document.fonts.
+func addWebFontFace(family string, desc *FontFaceDescriptors, data []byte) error {
+	fontFace := js.Global().Get("FontFace")
+	if fontFace.IsUndefined() {
+		return nil
+	}
+	buf := js.Global().Get("Uint8Array").New(len(data))
+	js.CopyBytesToJS(buf, data)
+	min, max := desc.weightRange()
+	obj := js.Global().Get("Object").New()
+	obj.Set("weight", fmt.Sprintf("%v %v", int(min)*100+400, int(max)*100+400))
+	switch desc.Style {
+	case font.StyleItalic:
+		obj.Set("style", "italic")
+	case font.StyleOblique:
+		obj.Set("style", "oblique")
+	}
+	if s, ok := cssStretch[desc.Stretch]; ok {
+		obj.Set("stretch", s)
+	}
+	if desc.UnicodeRange != nil {
+		obj.Set("unicodeRange", desc.UnicodeRange.String())
+	}
+	face := fontFace.New(family, buf, obj)
+	document.Get("fonts").Call("add", face)
+	face.Call("load")
+	return nil
+}
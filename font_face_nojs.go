@@ -0,0 +1,8 @@
+//go:build !js || wegame || weapp
+// +build !js wegame weapp
+
+package canvas
+
+func addWebFontFace(family string, desc *FontFaceDescriptors, data []byte) error {
+	return nil
+}
@@ -0,0 +1,57 @@
+//go:build !nofont
+// +build !nofont
+
+package canvas
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gomedium"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// TestAddFontFaceLazyFamily adds faces to the family of a collection that
+// was registered without parsing it.
+func TestAddFontFaceLazyFamily(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "pair.ttc"), collection(goregular.TTF, gobold.TTF), 0644); err != nil {
+		t.Fatal(err)
+	}
+	db := NewFontDB()
+	if err := db.LoadFontDir(dir, false); err != nil {
+		t.Fatal(err)
+	}
+	medium := FontFaceDescriptors{WeightMin: font.WeightMedium}
+	if err := db.AddFontFace("pair", medium, FontSourceData(gomedium.TTF)); err != nil {
+		t.Fatal(err)
+	}
+	latin := FontFaceDescriptors{WeightMin: font.WeightMedium, UnicodeRange: RuneRanges{{0, 0x7f}}}
+	if err := db.AddFontFace("pair", latin, FontSourceData(gomedium.TTF)); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		weight font.Weight
+		want   []string // full names of the faces
+	}{
+		{font.WeightNormal, []string{"Go Regular"}},
+		{font.WeightBold, []string{"Go Bold"}},
+		{font.WeightMedium, []string{"Go Medium", "Go Medium"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, raw := range db.Family("pair").LoadRawFonts(font.StyleNormal, tt.weight) {
+			got = append(got, raw.FullName)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("faces of weight %v = %q, want %q", tt.weight, got, tt.want)
+		}
+	}
+	if n := len(db.Family("pair").rawFonts()); n != 4 {
+		t.Errorf("family has %d faces, want 4", n)
+	}
+}
@@ -0,0 +1,147 @@
+//go:build !nofont
+// +build !nofont
+
+package canvas
+
+import (
+	"fmt"
+	"log"
+	"unicode"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// ShapeText maps text to the glyphs of fnt in the default font database.
+func ShapeText(text string, fnt *Font) *GlyphRun {
+	return defaultFontDatebase.ShapeText(text, fnt)
+}
+
+// ShapeText maps every rune of text to a glyph through the fallback chain
+// of fnt, with the kerning of the kern table applied to the advances.
+func (db *FontDB) ShapeText(text string, fnt *Font) *GlyphRun {
+	fp := db.FontProvider(fnt)
+	if fp == nil {
+		return &GlyphRun{Text: text}
+	}
+	return shapeText(text, fp)
+}
+
+// shapeText maps every rune of text to a glyph of fp, with the kerning of
+// the kern table applied to the advances of glyphs followed by a glyph of
+// the same face. Like the original FillText, Han characters found in a
+// fallback face are set at least one em wide. Text is drawn and measured with the run it returns, so
+// that ShapeText, FillText and MeasureText agree.
+func shapeText(text string, fp FontProvider) *GlyphRun {
+	run := &GlyphRun{Text: text}
+	var b sfnt.Buffer
+	for i, r := range text {
+		gi, raw, err := fp.GlyphIndex(&b, r)
+		if err != nil {
+			log.Printf("GlyphIndex: %v", err)
+			break
+		}
+		ppem := fixed.I(raw.PointSize)
+		v, _ := raw.Font.GlyphAdvance(&b, gi, ppem, font.HintingNone)
+		advance := synthesizeAdvance(fUnitsToFloat64(v), raw.Synthetic, raw.PointSize)
+		//TODO fix 汉字计算不准确如 "试"
+		if isFallback(fp, raw) && unicode.Is(unicode.Han, r) {
+			if advance < float64(raw.PointSize) {
+				advance = float64(raw.PointSize)
+			}
+		}
+		if n := len(run.Glyphs); n > 0 && run.Glyphs[n-1].Font.rawFont == raw.rawFont {
+			prev := &run.Glyphs[n-1]
+			if k, err := raw.Font.Kern(&b, prev.ID, gi, ppem, font.HintingNone); err == nil {
+				prev.Advance += fUnitsToFloat64(k)
+			}
+		}
+		run.Glyphs = append(run.Glyphs, Glyph{
+			ID:      gi,
+			Font:    raw,
+			Cluster: i,
+			Advance: advance,
+		})
+	}
+	return run
+}
+
+// isFallback reports whether raw is a face fp fell back to because the
+// faces it asks for first have no glyph for a rune. The Han characters of
+// a fallback face are at least one em wide.
+func isFallback(fp FontProvider, raw *RawFont) bool {
+	switch p := fp.(type) {
+	case *fallbackFontProvider:
+		return raw.rawFont != p.fonts[0].rawFont
+	case *TableFontProvider:
+		return raw == p.Backup
+	}
+	return false
+}
+
+// NewGlyphRun returns a run of the glyphs of raw without text, set with
+// their advances.
+func NewGlyphRun(raw *RawFont, ids ...sfnt.GlyphIndex) *GlyphRun {
+	run := &GlyphRun{Glyphs: make([]Glyph, len(ids))}
+	var b sfnt.Buffer
+	for i, gi := range ids {
+		v, _ := raw.Font.GlyphAdvance(&b, gi, fixed.I(raw.PointSize), font.HintingNone)
+		run.Glyphs[i] = Glyph{
+			ID:      gi,
+			Font:    raw,
+			Advance: synthesizeAdvance(fUnitsToFloat64(v), raw.Synthetic, raw.PointSize),
+		}
+	}
+	return run
+}
+
+// GlyphName returns the name of a glyph from the post table.
+func (r *RawFont) GlyphName(gi sfnt.GlyphIndex) (string, error) {
+	var b sfnt.Buffer
+	return r.Font.GlyphName(&b, gi)
+}
+
+// GlyphByName returns the glyph with the given name in the post table,
+// like the icons of an icon font.
+func (r *RawFont) GlyphByName(name string) (sfnt.GlyphIndex, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names == nil {
+		var b sfnt.Buffer
+		n := r.Font.NumGlyphs()
+		r.names = make(map[string]sfnt.GlyphIndex, n)
+		for i := 0; i < n; i++ {
+			s, err := r.Font.GlyphName(&b, sfnt.GlyphIndex(i))
+			if err != nil {
+				break
+			}
+			if _, ok := r.names[s]; !ok && s != "" {
+				r.names[s] = sfnt.GlyphIndex(i)
+			}
+		}
+	}
+	gi, ok := r.names[name]
+	if !ok {
+		return 0, fmt.Errorf("glyph %q not found in %s", name, r.FullName)
+	}
+	return gi, nil
+}
+
+// AddGlyphs adds the outlines of run with its alphabetic baseline starting
+// at (x, y). It returns the advance of the run.
+func (p *Path) AddGlyphs(run *GlyphRun, x, y float64) float64 {
+	startx := x
+	var b sfnt.Buffer
+	for _, g := range run.Glyphs {
+		segments, err := g.Font.Font.LoadGlyph(&b, g.ID, fixed.I(g.Font.PointSize), nil)
+		if err != nil {
+			log.Printf("LoadGlyph: %v", err)
+			break
+		}
+		synthesizeGlyph(segments, g.Font.Synthetic, g.Font.PointSize)
+		p.drawSegments(segments, x+g.XOffset, y+g.YOffset)
+		x += g.Advance
+	}
+	return x - startx
+}
@@ -0,0 +1,231 @@
+//go:build !nofont
+// +build !nofont
+
+package canvas
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/sfnt"
+)
+
+// withKern returns the font data with a kern table of format 0 kerning the
+// glyphs of each pair of runes by kern font units.
+func withKern(t *testing.T, data []byte, kern int16, pairs ...[2]rune) []byte {
+	f, err := sfnt.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b sfnt.Buffer
+	glyph := func(r rune) uint16 {
+		gi, err := f.GlyphIndex(&b, r)
+		if err != nil || gi == 0 {
+			t.Fatalf("GlyphIndex(%q): %v", r, err)
+		}
+		return uint16(gi)
+	}
+	type pair struct{ left, right uint16 }
+	var ps []pair
+	for _, p := range pairs {
+		ps = append(ps, pair{glyph(p[0]), glyph(p[1])})
+	}
+	sort.Slice(ps, func(i, j int) bool { // pairs are sorted by their glyphs
+		return ps[i].left < ps[j].left || ps[i].left == ps[j].left && ps[i].right < ps[j].right
+	})
+	be := binary.BigEndian
+	table := make([]byte, 4+14+6*len(ps))
+	be.PutUint16(table[2:], 1)                    // nTables
+	be.PutUint16(table[6:], uint16(14+6*len(ps))) // length
+	be.PutUint16(table[8:], 1)                    // horizontal, format 0
+	be.PutUint16(table[10:], uint16(len(ps)))     // nPairs
+	for i, p := range ps {
+		e := table[18+6*i:]
+		be.PutUint16(e, p.left)
+		be.PutUint16(e[2:], p.right)
+		be.PutUint16(e[4:], uint16(kern))
+	}
+
+	return withTable(data, "kern", table)
+}
+
+// withTable returns the font data with the table of the given tag, added
+// to the directory or replacing the table there.
+func withTable(data []byte, tag string, table []byte) []byte {
+	be := binary.BigEndian
+	n := int(be.Uint16(data[4:]))
+	for i := 0; i < n; i++ {
+		if r := data[12+16*i:]; string(r[:4]) == tag {
+			// point the record to a copy of the table at the end
+			out := append([]byte(nil), data...)
+			for len(out)%4 != 0 {
+				out = append(out, 0)
+			}
+			be.PutUint32(out[12+16*i+8:], uint32(len(out)))
+			be.PutUint32(out[12+16*i+12:], uint32(len(table)))
+			return append(out, table...)
+		}
+	}
+
+	// Add the table to the directory, sorted by tag, moving the others.
+	out := make([]byte, 12, len(data)+16+len(table)+4)
+	copy(out, data[:12])
+	be.PutUint16(out[4:], uint16(n+1))
+	end := len(data) + 16
+	for end%4 != 0 {
+		end++
+	}
+	record := make([]byte, 16)
+	copy(record, tag)
+	be.PutUint32(record[8:], uint32(end))
+	be.PutUint32(record[12:], uint32(len(table)))
+	added := false
+	for i := 0; i < n; i++ {
+		r := append([]byte(nil), data[12+16*i:28+16*i]...)
+		if !added && string(r[:4]) > tag {
+			out = append(out, record...)
+			added = true
+		}
+		be.PutUint32(r[8:], be.Uint32(r[8:])+16)
+		out = append(out, r...)
+	}
+	if !added {
+		out = append(out, record...)
+	}
+	out = append(out, data[12+16*n:]...)
+	out = append(out, make([]byte, end-len(out))...)
+	return append(out, table...)
+}
+
+// withCmap returns the font data with a cmap of format 12 mapping each rune
+// of runes to the glyph of the original font for the rune it maps to.
+func withCmap(t *testing.T, data []byte, runes map[rune]rune) []byte {
+	f, err := sfnt.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b sfnt.Buffer
+	var rs []rune
+	for r := range runes {
+		rs = append(rs, r)
+	}
+	sort.Slice(rs, func(i, j int) bool { return rs[i] < rs[j] })
+	be := binary.BigEndian
+	table := make([]byte, 12+16+12*len(rs))
+	be.PutUint16(table[2:], 1)  // numTables
+	be.PutUint16(table[4:], 3)  // Windows
+	be.PutUint16(table[6:], 10) // full Unicode
+	be.PutUint32(table[8:], 12) // offset
+	sub := table[12:]
+	be.PutUint16(sub, 12)
+	be.PutUint32(sub[4:], uint32(len(sub)))
+	be.PutUint32(sub[12:], uint32(len(rs)))
+	for i, r := range rs {
+		gi, err := f.GlyphIndex(&b, runes[r])
+		if err != nil || gi == 0 {
+			t.Fatalf("GlyphIndex(%q): %v", runes[r], err)
+		}
+		g := sub[16+12*i:]
+		be.PutUint32(g, uint32(r))
+		be.PutUint32(g[4:], uint32(r))
+		be.PutUint32(g[8:], uint32(gi))
+	}
+	return withTable(data, "cmap", table)
+}
+
+// TestShapeTextKerning checks that text is shaped, drawn and measured with
+// the kerning of its font alike.
+func TestShapeTextKerning(t *testing.T) {
+	db := NewFontDB()
+	if err := db.LoadFontData(withKern(t, goregular.TTF, -400, [2]rune{'A', 'V'})); err != nil {
+		t.Fatal(err)
+	}
+	fnt := &Font{Family: "Go", PointSize: 20}
+	const text = "AVA"
+	run := db.ShapeText(text, fnt)
+	if len(run.Glyphs) != 3 {
+		t.Fatalf("ShapeText(%q) has %d glyphs", text, len(run.Glyphs))
+	}
+	a := db.ShapeText("A", fnt).Advance()
+	kern := run.Glyphs[0].Advance - a
+	if kern >= 0 {
+		t.Fatalf("kerning of AV is %v, want < 0", kern)
+	}
+	if k := run.Glyphs[1].Advance - db.ShapeText("V", fnt).Advance(); k != 0 {
+		t.Errorf("kerning of VA is %v, want 0", k)
+	}
+
+	if w := NewPath().MeasureTextByDB(text, fnt, db); w != run.Advance() {
+		t.Errorf("MeasureTextByDB = %v, want %v", w, run.Advance())
+	}
+	gc := NewGraphicContext2DWithFonts(100, 40, db)
+	gc.SetFont(fnt)
+	if w := gc.MeasureText(text); w != run.Advance() {
+		t.Errorf("MeasureText = %v, want %v", w, run.Advance())
+	}
+	// the text is narrower than its glyphs measured one by one
+	var unkerned float64
+	for _, r := range text {
+		unkerned += gc.MeasureText(string(r))
+	}
+	if w := gc.MeasureText(text); w != unkerned+kern {
+		t.Errorf("MeasureText = %v, want %v less the kerning %v", w, unkerned, -kern)
+	}
+
+	p, q := NewPath(), NewPath()
+	w := p.AddTextByDB(text, 5, 30, fnt, db)
+	q.AddGlyphs(run, 5, 30)
+	if w != run.Advance() {
+		t.Errorf("AddTextByDB = %v, want %v", w, run.Advance())
+	}
+	if !reflect.DeepEqual(p.Points, q.Points) {
+		t.Error("AddTextByDB draws other outlines than AddGlyphs")
+	}
+}
+
+// TestShapeTextHanFallback checks that Han characters found in a fallback
+// face are at least one em wide.
+func TestShapeTextHanFallback(t *testing.T) {
+	db := NewFontDB()
+	if err := db.LoadFontData(goregular.TTF); err != nil {
+		t.Fatal(err)
+	}
+	// a face with narrow glyphs for a few CJK characters
+	han := withCmap(t, goregular.TTF, map[rune]rune{'中': 'i', '试': 'W', '가': 'i', 'x': 'x'})
+	if err := db.AddFontFace("Han", FontFaceDescriptors{}, FontSourceData(han)); err != nil {
+		t.Fatal(err)
+	}
+	goFont := &Font{Family: "Go", PointSize: 20}
+	i := db.ShapeText("i", goFont).Advance()
+	if i >= 20 {
+		t.Fatalf("advance of i is %v", i)
+	}
+	tests := []struct {
+		text   string
+		family string
+		want   float64
+	}{
+		{"中", "Go", 20},      // fallback
+		{"试", "Go", 20},      // fallback, W is narrower than an em
+		{"가", "Go", i},       // Hangul is not Han
+		{"中", "Han", i},      // the first face
+		{"中", "Go, Han", 20}, // the second face of the chain
+		{"x中x", "Go", 20 + 2*db.ShapeText("x", goFont).Advance()},
+	}
+	for _, tt := range tests {
+		fnt := &Font{Family: tt.family, PointSize: 20}
+		if w := db.ShapeText(tt.text, fnt).Advance(); math.Abs(w-tt.want) > 1e-9 {
+			t.Errorf("ShapeText(%q) in %s = %v, want %v", tt.text, tt.family, w, tt.want)
+		}
+		if w := NewPath().MeasureTextByDB(tt.text, fnt, db); math.Abs(w-tt.want) > 1e-9 {
+			t.Errorf("MeasureTextByDB(%q) in %s = %v, want %v", tt.text, tt.family, w, tt.want)
+		}
+		if w := NewPath().AddTextByDB(tt.text, 0, 0, fnt, db); math.Abs(w-tt.want) > 1e-9 {
+			t.Errorf("AddTextByDB(%q) in %s = %v, want %v", tt.text, tt.family, w, tt.want)
+		}
+	}
+}
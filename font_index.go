@@ -0,0 +1,205 @@
+//go:build !nofont || !wx
+// +build !nofont !wx
+
+package canvas
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+)
+
+// The font index caches the descriptors and the cmap coverage of every face
+// found by LoadFontDirIndexed, so that a database can be filled without
+// parsing the font files. Faces are parsed on first use.
+
+const fontIndexVersion = 1
+
+type fontIndex struct {
+	Version int               `json:"version"`
+	Faces   []*fontIndexEntry `json:"faces"`
+}
+
+type fontIndexEntry struct {
+	Path      string       `json:"path"`
+	ModTime   int64        `json:"mtime"`
+	Size      int64        `json:"size"`
+	Index     int          `json:"index"`
+	FullName  string       `json:"fullName"`
+	Family    string       `json:"family"`
+	SubFamily string       `json:"subfamily"`
+	Weight    font.Weight  `json:"weight"`
+	Style     font.Style   `json:"style"`
+	Stretch   font.Stretch `json:"stretch"`
+	Coverage  [][2]rune    `json:"coverage"`
+}
+
+func (e *fontIndexEntry) rawFont() *rawFont {
+	cov := make(RuneRanges, len(e.Coverage))
+	for i, v := range e.Coverage {
+		cov[i] = RuneRange{v[0], v[1]}
+	}
+	return &rawFont{
+		Path:      e.Path,
+		FullName:  e.FullName,
+		Family:    e.Family,
+		SubFamily: e.SubFamily,
+		Weight:    e.Weight,
+		Style:     e.Style,
+		Stretch:   e.Stretch,
+		Index:     e.Index,
+		coverage:  cov,
+		covered:   true,
+	}
+}
+
+func readFontIndex(fpath string) map[string][]*fontIndexEntry {
+	files := make(map[string][]*fontIndexEntry)
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return files
+	}
+	var index fontIndex
+	if err = json.Unmarshal(data, &index); err != nil || index.Version != fontIndexVersion {
+		return files
+	}
+	for _, e := range index.Faces {
+		files[e.Path] = append(files[e.Path], e)
+	}
+	return files
+}
+
+func writeFontIndex(fpath string, faces []*fontIndexEntry) error {
+	data, err := json.Marshal(&fontIndex{fontIndexVersion, faces})
+	if err != nil {
+		return err
+	}
+	tmp := fpath + ".tmp"
+	if err = os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fpath)
+}
+
+// indexFontFile parses all faces of a font file. The descriptors are read
+// from the OS/2 table, or guessed from the names of a face without one.
+func indexFontFile(fpath string, info os.FileInfo) ([]*fontIndexEntry, error) {
+	r, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	c, err := sfnt.ParseCollectionReaderAt(r)
+	if err != nil {
+		return nil, err
+	}
+	var faces []*fontIndexEntry
+	for i := 0; i < c.NumFonts(); i++ {
+		raw := &rawFont{Path: fpath}
+		if err := raw.loadCollectFont(r, c, i); err != nil {
+			log.Printf("LoadFont: %v\n", err)
+			continue
+		}
+		e := &fontIndexEntry{
+			Path:      fpath,
+			ModTime:   info.ModTime().UnixNano(),
+			Size:      info.Size(),
+			Index:     i,
+			FullName:  raw.FullName,
+			Family:    raw.Family,
+			SubFamily: raw.SubFamily,
+			Weight:    raw.Weight,
+			Style:     raw.Style,
+			Stretch:   raw.Stretch,
+		}
+		if weight, style, stretch, ok := raw.os2Descriptors(); ok {
+			e.Weight, e.Style, e.Stretch = weight, style, stretch
+		}
+		for _, v := range raw.Coverage() {
+			e.Coverage = append(e.Coverage, [2]rune{v.Lo, v.Hi})
+		}
+		faces = append(faces, e)
+	}
+	return faces, nil
+}
+
+// LoadFontDirIndexed loads the fonts of root like LoadFontDir with accurate
+// descriptors, reading them from the index file indexPath instead of parsing
+// the fonts. Files that are new or changed since the index was written are
+// parsed and the index is updated. The faces of other directories in the
+// index are kept, so that several roots can share one index file.
+func (db *FontDB) LoadFontDirIndexed(root string, indexPath string) error {
+	cached := readFontIndex(indexPath)
+	var faces []*fontIndexEntry
+	var changed bool
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".ttf", ".otf", ".ttc":
+		default:
+			return nil
+		}
+		entries, ok := cached[path]
+		if ok && (len(entries) == 0 || entries[0].ModTime != info.ModTime().UnixNano() || entries[0].Size != info.Size()) {
+			ok = false
+		}
+		delete(cached, path)
+		if !ok {
+			changed = true
+			entries, err = indexFontFile(path, info)
+			if err != nil {
+				log.Printf("ParseFont: %v, %v\n", path, err)
+				return nil
+			}
+		}
+		faces = append(faces, entries...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	db.mu.Lock()
+	for _, e := range faces {
+		raw := e.rawFont()
+		f, ok := db.fontMap[raw.Family]
+		if !ok {
+			name := filepath.Base(raw.Path)
+			f = NewFontFamily(name[:len(name)-len(filepath.Ext(name))], raw.Family)
+			db.fontMap[raw.Family] = f
+		}
+		f.addRawFont(raw.FullName, raw)
+	}
+	db.resetCache()
+	db.mu.Unlock()
+	// the files of other roots stay in the index, the others were removed
+	var paths []string
+	for path := range cached {
+		if inDir(root, path) {
+			changed = true
+		} else {
+			paths = append(paths, path)
+		}
+	}
+	if !changed {
+		return nil
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		faces = append(faces, cached[path]...)
+	}
+	return writeFontIndex(indexPath, faces)
+}
+
+// inDir reports whether path is in the directory root or below.
+func inDir(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,251 @@
+//go:build !nofont
+// +build !nofont
+
+package canvas
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomedium"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func indexedFaces(t *testing.T, dir, index string) map[string]*rawFont {
+	db := NewFontDB()
+	if err := db.LoadFontDirIndexed(dir, index); err != nil {
+		t.Fatal(err)
+	}
+	faces := make(map[string]*rawFont)
+	for _, raw := range db.faces() {
+		faces[filepath.Base(raw.Path)] = raw
+	}
+	return faces
+}
+
+func TestLoadFontDirIndexed(t *testing.T) {
+	dir := t.TempDir()
+	index := filepath.Join(t.TempDir(), "fonts.json")
+	write := func(name string, data []byte) {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.ttf", goregular.TTF)
+	write("b.ttf", gomono.TTF)
+	write("d.ttf", goitalic.TTF)
+	faces := indexedFaces(t, dir, index)
+	if len(faces) != 3 || faces["a.ttf"].FullName != "Go Regular" || faces["b.ttf"].FullName != "Go Mono" {
+		t.Fatalf("faces of the first index = %v", faces)
+	}
+	if faces["a.ttf"].Font != nil {
+		t.Error("indexed face parsed before use")
+	}
+
+	// rename a face in the index, to tell a cached entry from a parsed one
+	data, err := os.ReadFile(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fi fontIndex
+	if err = json.Unmarshal(data, &fi); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range fi.Faces {
+		if filepath.Base(e.Path) == "a.ttf" {
+			e.FullName = "Cached"
+		}
+	}
+	if err = writeFontIndex(index, fi.Faces); err != nil {
+		t.Fatal(err)
+	}
+
+	// change b, add c and remove d
+	write("b.ttf", gobold.TTF)
+	write("c.ttf", goitalic.TTF)
+	if err = os.Remove(filepath.Join(dir, "d.ttf")); err != nil {
+		t.Fatal(err)
+	}
+	faces = indexedFaces(t, dir, index)
+	if len(faces) != 3 || faces["d.ttf"] != nil {
+		t.Errorf("faces after the changes = %v", faces)
+	}
+	if raw := faces["a.ttf"]; raw == nil || raw.FullName != "Cached" {
+		t.Errorf("unchanged a.ttf = %v, want the entry of the index", raw)
+	}
+	if raw := faces["b.ttf"]; raw == nil || raw.FullName != "Go Bold" {
+		t.Errorf("changed b.ttf = %v, want Go Bold", raw)
+	}
+	if raw := faces["c.ttf"]; raw == nil || raw.FullName != "Go Italic" || len(raw.Coverage()) == 0 {
+		t.Errorf("added c.ttf = %v, want Go Italic", raw)
+	}
+	if err := faces["c.ttf"].ParseFont(); err != nil {
+		t.Error(err)
+	}
+
+	data, err = os.ReadFile(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi = fontIndex{}
+	if err = json.Unmarshal(data, &fi); err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, e := range fi.Faces {
+		paths = append(paths, filepath.Base(e.Path))
+	}
+	if len(paths) != 3 || paths[0] != "a.ttf" || paths[1] != "b.ttf" || paths[2] != "c.ttf" {
+		t.Errorf("files of the index = %v, want [a.ttf b.ttf c.ttf]", paths)
+	}
+}
+
+// withOS2 returns the font data with the u16 at offset of its OS/2 table
+// set to v.
+func withOS2(t *testing.T, data []byte, offset int, v uint16) []byte {
+	be := binary.BigEndian
+	out := append([]byte(nil), data...)
+	n := int(be.Uint16(data[4:]))
+	for i := 0; i < n; i++ {
+		rec := data[12+16*i:]
+		if string(rec[:4]) == "OS/2" {
+			be.PutUint16(out[int(be.Uint32(rec[8:]))+offset:], v)
+			return out
+		}
+	}
+	t.Fatal("no OS/2 table")
+	return nil
+}
+
+// TestFontIndexDescriptors checks that the descriptors of the index are
+// those of the OS/2 table, not of the names.
+func TestFontIndexDescriptors(t *testing.T) {
+	extrabold := withOS2(t, gobold.TTF, 4, 800) // usWeightClass
+	condensed := withOS2(t, gomono.TTF, 6, 3)   // usWidthClass
+	tests := []struct {
+		name    string
+		data    []byte
+		weight  font.Weight
+		style   font.Style
+		stretch font.Stretch
+	}{
+		{"regular.ttf", goregular.TTF, font.WeightNormal, font.StyleNormal, font.StretchNormal},
+		{"medium.ttf", gomedium.TTF, font.WeightMedium, font.StyleNormal, font.StretchNormal},
+		{"italic.ttf", goitalic.TTF, font.WeightNormal, font.StyleItalic, font.StretchNormal},
+		{"extrabold.ttf", extrabold, font.WeightExtraBold, font.StyleNormal, font.StretchNormal},
+		{"condensed.ttf", condensed, font.WeightNormal, font.StyleNormal, font.StretchCondensed},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		if err := os.WriteFile(filepath.Join(dir, tt.name), tt.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	faces := indexedFaces(t, dir, filepath.Join(t.TempDir(), "fonts.json"))
+	for _, tt := range tests {
+		raw := faces[tt.name]
+		if raw == nil {
+			t.Errorf("%s not indexed", tt.name)
+			continue
+		}
+		if raw.Weight != tt.weight || raw.Style != tt.style || raw.Stretch != tt.stretch {
+			t.Errorf("%s: %v %v %v, want %v %v %v", tt.name, raw.Weight, raw.Style, raw.Stretch, tt.weight, tt.style, tt.stretch)
+		}
+	}
+}
+
+// TestFontIndexRoots loads two directories with one index file.
+func TestFontIndexRoots(t *testing.T) {
+	index := filepath.Join(t.TempDir(), "fonts.json")
+	root1, root2 := t.TempDir(), t.TempDir()
+	for _, f := range []struct {
+		dir, name string
+		data      []byte
+	}{
+		{root1, "a.ttf", goregular.TTF},
+		{root1, "b.ttf", gobold.TTF},
+		{root2, "c.ttf", gomono.TTF},
+	} {
+		if err := os.WriteFile(filepath.Join(f.dir, f.name), f.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	indexed := func() []string {
+		var paths []string
+		for path := range readFontIndex(index) {
+			paths = append(paths, filepath.Base(path))
+		}
+		sort.Strings(paths)
+		return paths
+	}
+	steps := []struct {
+		load   string
+		remove string
+		want   []string
+	}{
+		{root1, "", []string{"a.ttf", "b.ttf"}},
+		{root2, "", []string{"a.ttf", "b.ttf", "c.ttf"}},
+		{root1, "", []string{"a.ttf", "b.ttf", "c.ttf"}},
+		{root1, filepath.Join(root1, "b.ttf"), []string{"a.ttf", "c.ttf"}},
+		{root2, filepath.Join(root2, "c.ttf"), []string{"a.ttf"}},
+	}
+	for i, step := range steps {
+		if step.remove != "" {
+			if err := os.Remove(step.remove); err != nil {
+				t.Fatal(err)
+			}
+		}
+		indexedFaces(t, step.load, index)
+		if got := indexed(); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("step %d: files of the index = %v, want %v", i, got, step.want)
+		}
+	}
+}
+
+// TestFontIndexNoCoverage checks that an indexed face without coverage
+// supports no text, without parsing it.
+func TestFontIndexNoCoverage(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.ttf")
+	if err := os.WriteFile(path, goregular.TTF, 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := filepath.Join(t.TempDir(), "fonts.json")
+	err = writeFontIndex(index, []*fontIndexEntry{{
+		Path:     path,
+		ModTime:  info.ModTime().UnixNano(),
+		Size:     info.Size(),
+		FullName: "Go Regular",
+		Family:   "Go",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := NewFontDB()
+	if err := db.LoadFontDirIndexed(dir, index); err != nil {
+		t.Fatal(err)
+	}
+	raw := db.LoadRawFont(&Font{Family: "Go", PointSize: 12})
+	if raw == nil {
+		t.Fatal("indexed face not found")
+	}
+	if raw.TestSupportText("a") {
+		t.Error("face without coverage supports text")
+	}
+	if faces := db.FacesCovering('a'); len(faces) != 0 {
+		t.Errorf("FacesCovering('a') = %v, want none", faces)
+	}
+}
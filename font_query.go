@@ -0,0 +1,233 @@
+//go:build !nofont || !wx
+// +build !nofont !wx
+
+package canvas
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+)
+
+// FontEmbedding is the fsType field of the OS/2 table, the embedding
+// licensing rights of a font.
+type FontEmbedding uint16
+
+const (
+	EmbedInstallable  FontEmbedding = 0x0000
+	EmbedRestricted   FontEmbedding = 0x0002
+	EmbedPreviewPrint FontEmbedding = 0x0004
+	EmbedEditable     FontEmbedding = 0x0008
+	EmbedNoSubsetting FontEmbedding = 0x0100
+	EmbedBitmapOnly   FontEmbedding = 0x0200
+)
+
+// Level returns the usage permission of e, one of EmbedInstallable,
+// EmbedRestricted, EmbedPreviewPrint or EmbedEditable.
+func (e FontEmbedding) Level() FontEmbedding {
+	// bits 0-3 are exclusive, the least restrictive set bit wins
+	switch {
+	case e&EmbedEditable != 0:
+		return EmbedEditable
+	case e&EmbedPreviewPrint != 0:
+		return EmbedPreviewPrint
+	case e&EmbedRestricted != 0:
+		return EmbedRestricted
+	}
+	return EmbedInstallable
+}
+
+func (e FontEmbedding) String() string {
+	var ar []string
+	switch e.Level() {
+	case EmbedInstallable:
+		ar = append(ar, "installable")
+	case EmbedRestricted:
+		ar = append(ar, "restricted")
+	case EmbedPreviewPrint:
+		ar = append(ar, "preview-print")
+	case EmbedEditable:
+		ar = append(ar, "editable")
+	}
+	if e&EmbedNoSubsetting != 0 {
+		ar = append(ar, "no-subsetting")
+	}
+	if e&EmbedBitmapOnly != 0 {
+		ar = append(ar, "bitmap-only")
+	}
+	return strings.Join(ar, " ")
+}
+
+// FaceInfo describes a face of a FontDB. The descriptors are the ones used
+// to match a Font, reading the other metadata may parse the font file.
+type FaceInfo struct {
+	Family       string
+	SubFamily    string
+	FullName     string
+	Path         string // empty if loaded from memory
+	Index        int    // face index in a font collection
+	Weight       font.Weight
+	Style        font.Style
+	Stretch      font.Stretch
+	UnicodeRange RuneRanges // set by AddFontFace
+	raw          *rawFont
+}
+
+// FaceMetadata is read from the name and OS/2 tables of a face.
+type FaceMetadata struct {
+	PostScriptName string
+	Version        string
+	Copyright      string
+	Trademark      string
+	Manufacturer   string
+	License        string
+	LicenseURL     string
+	Embedding      FontEmbedding
+	WeightClass    int // usWeightClass, 100 to 900
+	Monospace      bool
+}
+
+func newFaceInfo(raw *rawFont) *FaceInfo {
+	raw.mu.Lock()
+	defer raw.mu.Unlock()
+	fi := &FaceInfo{
+		Family:    raw.Family,
+		SubFamily: raw.SubFamily,
+		FullName:  raw.FullName,
+		Path:      raw.Path,
+		Index:     raw.Index,
+		Weight:    raw.Weight,
+		Style:     raw.Style,
+		Stretch:   raw.Stretch,
+		raw:       raw,
+	}
+	if raw.desc != nil {
+		fi.UnicodeRange = raw.desc.UnicodeRange
+	}
+	return fi
+}
+
+// RawFont returns the face to draw text with.
+func (fi *FaceInfo) RawFont(pointSize int) (*RawFont, error) {
+	if err := fi.raw.ParseFont(); err != nil {
+		return nil, err
+	}
+	return &RawFont{rawFont: fi.raw, PointSize: pointSize}, nil
+}
+
+// Covers reports whether the face has a glyph for every rune of text.
+func (fi *FaceInfo) Covers(text string) bool {
+	for _, r := range text {
+		if !fi.raw.covers(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Monospace reports whether the post table marks the face as fixed pitch.
+func (fi *FaceInfo) Monospace() bool {
+	if err := fi.raw.ParseFont(); err != nil {
+		return false
+	}
+	post := fi.raw.Font.PostTable()
+	return post != nil && post.IsFixedPitch
+}
+
+// Metadata returns the naming and licensing information of the face.
+func (fi *FaceInfo) Metadata() (*FaceMetadata, error) {
+	raw := fi.raw
+	if err := raw.ParseFont(); err != nil {
+		return nil, err
+	}
+	var b sfnt.Buffer
+	name := func(id sfnt.NameID) string {
+		s, _ := raw.Font.Name(&b, id)
+		return s
+	}
+	m := &FaceMetadata{
+		PostScriptName: name(sfnt.NameIDPostScript),
+		Version:        name(sfnt.NameIDVersion),
+		Copyright:      name(sfnt.NameIDCopyright),
+		Trademark:      name(sfnt.NameIDTrademark),
+		Manufacturer:   name(sfnt.NameIDManufacturer),
+		License:        name(sfnt.NameIDLicense),
+		LicenseURL:     name(sfnt.NameIDLicenseURL),
+	}
+	if post := raw.Font.PostTable(); post != nil {
+		m.Monospace = post.IsFixedPitch
+	}
+	os2, err := raw.source.table("OS/2")
+	if err != nil {
+		return m, fmt.Errorf("%v: OS/2: %v", raw.FullName, err)
+	}
+	t := tableReader(os2)
+	m.WeightClass = int(t.u16(4))
+	m.Embedding = FontEmbedding(t.u16(8))
+	return m, nil
+}
+
+// FaceFilter selects faces in FontDB.QueryFaces.
+type FaceFilter func(fi *FaceInfo) bool
+
+// FilterFamily selects the faces of a family.
+func FilterFamily(family string) FaceFilter {
+	return func(fi *FaceInfo) bool {
+		return strings.EqualFold(fi.Family, family)
+	}
+}
+
+// FilterWeight selects the faces with a weight in [min, max]. A face added
+// by AddFontFace is selected if its weight range overlaps [min, max].
+func FilterWeight(min, max font.Weight) FaceFilter {
+	return func(fi *FaceInfo) bool {
+		lo, hi := fi.Weight, fi.Weight
+		if fi.raw.desc != nil {
+			lo, hi = fi.raw.desc.weightRange()
+		}
+		return hi >= min && lo <= max
+	}
+}
+
+// FilterStyle selects the faces of a style.
+func FilterStyle(style font.Style) FaceFilter {
+	return func(fi *FaceInfo) bool {
+		return fi.Style == style
+	}
+}
+
+// FilterMonospace selects the fixed pitch faces.
+func FilterMonospace() FaceFilter {
+	return (*FaceInfo).Monospace
+}
+
+// FilterCovers selects the faces that have a glyph for every rune of text.
+func FilterCovers(text string) FaceFilter {
+	return func(fi *FaceInfo) bool {
+		return fi.Covers(text)
+	}
+}
+
+// QueryFaces returns the faces of db that pass all filters, ordered by
+// family and name.
+func (db *FontDB) QueryFaces(filters ...FaceFilter) []*FaceInfo {
+	var ar []*FaceInfo
+next:
+	for _, raw := range db.faces() {
+		fi := newFaceInfo(raw)
+		for _, filter := range filters {
+			if !filter(fi) {
+				continue next
+			}
+		}
+		ar = append(ar, fi)
+	}
+	return ar
+}
+
+// Faces returns all faces of db ordered by family and name.
+func (db *FontDB) Faces() []*FaceInfo {
+	return db.QueryFaces()
+}
@@ -0,0 +1,91 @@
+//go:build !nofont
+// +build !nofont
+
+package canvas
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestQueryFaces(t *testing.T) {
+	db := NewFontDB()
+	for _, data := range [][]byte{goregular.TTF, gobold.TTF, goitalic.TTF, gomono.TTF} {
+		if err := db.LoadFontData(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name    string
+		filters []FaceFilter
+		want    []string // full names of the faces
+	}{
+		{"all", nil, []string{"Go Bold", "Go Italic", "Go Regular", "Go Mono"}},
+		{"family", []FaceFilter{FilterFamily("go mono")}, []string{"Go Mono"}},
+		{"weight", []FaceFilter{FilterWeight(font.WeightSemiBold, font.WeightBlack)}, []string{"Go Bold"}},
+		{"style", []FaceFilter{FilterStyle(font.StyleItalic)}, []string{"Go Italic"}},
+		{"monospace", []FaceFilter{FilterMonospace()}, []string{"Go Mono"}},
+		{"covers", []FaceFilter{FilterCovers("Жé")}, []string{"Go Bold", "Go Italic", "Go Regular", "Go Mono"}},
+		{"covers none", []FaceFilter{FilterCovers("中")}, nil},
+		{"all filters", []FaceFilter{FilterFamily("Go"), FilterStyle(font.StyleNormal), FilterWeight(font.WeightNormal, font.WeightNormal)}, []string{"Go Regular"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, fi := range db.QueryFaces(tt.filters...) {
+			got = append(got, fi.FullName)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: QueryFaces = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFaceMetadata(t *testing.T) {
+	db := NewFontDB()
+	for _, data := range [][]byte{goregular.TTF, gobold.TTF, gomono.TTF} {
+		if err := db.LoadFontData(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		fullName    string
+		postScript  string
+		weightClass int
+		monospace   bool
+	}{
+		{"Go Regular", "GoRegular", 400, false},
+		{"Go Bold", "Go-Bold", 600, false}, // the weight class of Go Bold is 600
+		{"Go Mono", "GoMono", 400, true},
+	}
+	faces := map[string]*FaceInfo{}
+	for _, fi := range db.Faces() {
+		faces[fi.FullName] = fi
+	}
+	for _, tt := range tests {
+		fi := faces[tt.fullName]
+		if fi == nil {
+			t.Errorf("no face %q", tt.fullName)
+			continue
+		}
+		m, err := fi.Metadata()
+		if err != nil {
+			t.Errorf("%s: %v", tt.fullName, err)
+			continue
+		}
+		if m.PostScriptName != tt.postScript || m.WeightClass != tt.weightClass || m.Monospace != tt.monospace {
+			t.Errorf("%s: %s, weight class %d, monospace %v, want %s, %d, %v", tt.fullName, m.PostScriptName, m.WeightClass, m.Monospace, tt.postScript, tt.weightClass, tt.monospace)
+		}
+		if m.Copyright == "" || m.Embedding.Level() != EmbedInstallable {
+			t.Errorf("%s: copyright %q, embedding %v", tt.fullName, m.Copyright, m.Embedding)
+		}
+		if raw, err := fi.RawFont(12); err != nil || raw.FullName != tt.fullName {
+			t.Errorf("%s: RawFont = %v, %v", tt.fullName, raw, err)
+		}
+	}
+}
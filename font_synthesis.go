@@ -0,0 +1,153 @@
+//go:build !nofont
+// +build !nofont
+
+package canvas
+
+import (
+	"math"
+
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// obliqueShear is the slant of a synthesized oblique face, about 12 degrees
+// like FreeType and browsers.
+const obliqueShear = 0.2126
+
+// emboldenStrength returns how much a synthesized bold glyph grows at the
+// given size, the advance is increased by the same amount.
+func emboldenStrength(pointSize int) float64 {
+	return float64(pointSize) / 24
+}
+
+// synthesizeGlyph applies a synthetic bold and oblique to the outline of a
+// glyph, in place.
+func synthesizeGlyph(segments []sfnt.Segment, synth FontSynthesis, pointSize int) {
+	if synth&SynthesisWeight != 0 {
+		emboldenSegments(segments, emboldenStrength(pointSize))
+	}
+	if synth&SynthesisStyle != 0 {
+		for i := range segments {
+			for j := range segments[i].Args {
+				p := &segments[i].Args[j]
+				// y points down, shear the glyph to the right above the baseline
+				p.X -= fixed.Int26_6(obliqueShear * float64(p.Y))
+			}
+		}
+	}
+}
+
+// synthesizeAdvance returns the advance of a glyph with a synthetic bold.
+func synthesizeAdvance(advance float64, synth FontSynthesis, pointSize int) float64 {
+	if synth&SynthesisWeight != 0 {
+		advance += emboldenStrength(pointSize)
+	}
+	return advance
+}
+
+// emboldenSegments offsets the contours of a glyph outwards by strength/2,
+// moving every point, control points included, along the bisector of its
+// edges like FT_Outline_Embolden. The glyph is then moved right and up by
+// strength/2 so that it still starts at the origin and sits on the baseline.
+func emboldenSegments(segments []sfnt.Segment, strength float64) {
+	type point struct {
+		v   Vec
+		ref *fixed.Point26_6
+	}
+	var contours [][]point
+	var area float64
+	flush := func(c []point) {
+		if len(c) > 1 && c[0].v == c[len(c)-1].v {
+			// the closing point is moved with the first one
+			c[len(c)-1].v.X = math.NaN()
+		}
+		for i := range c {
+			a, b := c[i].v, c[(i+1)%len(c)].v
+			if !math.IsNaN(a.X) && !math.IsNaN(b.X) {
+				area += a.Cross(b)
+			}
+		}
+		contours = append(contours, c)
+	}
+	var cur []point
+	for i := range segments {
+		seg := &segments[i]
+		n := 1
+		switch seg.Op {
+		case sfnt.SegmentOpMoveTo:
+			if len(cur) > 0 {
+				flush(cur)
+			}
+			cur = nil
+		case sfnt.SegmentOpQuadTo:
+			n = 2
+		case sfnt.SegmentOpCubeTo:
+			n = 3
+		}
+		for j := 0; j < n; j++ {
+			p := &seg.Args[j]
+			cur = append(cur, point{Vec{float64(p.X) / 64, float64(p.Y) / 64}, p})
+		}
+	}
+	if len(cur) > 0 {
+		flush(cur)
+	}
+	s := strength / 2
+	// the outward normal of an edge is on its right for a positive area
+	sign := 1.0
+	if area < 0 {
+		sign = -1
+	}
+	for _, c := range contours {
+		var pts []point
+		for _, p := range c {
+			if !math.IsNaN(p.v.X) {
+				pts = append(pts, p)
+			}
+		}
+		n := len(pts)
+		shifts := make([]Vec, n)
+		for i := range pts {
+			// the nearest distinct neighbours
+			prev, next := -1, -1
+			for k := 1; k < n; k++ {
+				if j := (i - k + n) % n; pts[j].v != pts[i].v {
+					prev = j
+					break
+				}
+			}
+			for k := 1; k < n; k++ {
+				if j := (i + k) % n; pts[j].v != pts[i].v {
+					next = j
+					break
+				}
+			}
+			if prev < 0 || next < 0 {
+				continue
+			}
+			in := pts[i].v.Sub(pts[prev].v).Unit()
+			out := pts[next].v.Sub(pts[i].v).Unit()
+			d := 1 + in.Dot(out)
+			if d < 0.06 {
+				// the contour turns back, a miter would be too long
+				continue
+			}
+			nin := Vec{in.Y, -in.X}.Mulf(sign)
+			nout := Vec{out.Y, -out.X}.Mulf(sign)
+			shift := nin.Add(nout).Mulf(s / d)
+			if l := shift.Len(); l > 3*s {
+				shift = shift.Mulf(3 * s / l)
+			}
+			shifts[i] = shift
+		}
+		for i, p := range pts {
+			p.ref.X = fixed.Int26_6(math.Round((p.v.X + shifts[i].X + s) * 64))
+			p.ref.Y = fixed.Int26_6(math.Round((p.v.Y + shifts[i].Y - s) * 64))
+		}
+		for _, p := range c {
+			if math.IsNaN(p.v.X) {
+				*p.ref = *c[0].ref
+			}
+		}
+	}
+}
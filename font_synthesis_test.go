@@ -0,0 +1,107 @@
+//go:build !nofont
+// +build !nofont
+
+package canvas
+
+import (
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+func TestSynthesizedFaces(t *testing.T) {
+	regular := NewFontDB()
+	if err := regular.LoadFontData(goregular.TTF); err != nil {
+		t.Fatal(err)
+	}
+	both := NewFontDB()
+	for _, data := range [][]byte{goregular.TTF, gobold.TTF} {
+		if err := both.LoadFontData(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name string
+		db   *FontDB
+		f    Font
+		want FontSynthesis
+	}{
+		{"regular", regular, Font{Family: "Go", PointSize: 24}, SynthesisNone},
+		{"bold", regular, Font{Family: "Go", PointSize: 24, Weight: font.WeightBold}, SynthesisWeight},
+		{"medium", regular, Font{Family: "Go", PointSize: 24, Weight: font.WeightMedium}, SynthesisNone},
+		{"italic", regular, Font{Family: "Go", PointSize: 24, Style: font.StyleItalic}, SynthesisStyle},
+		{"bold italic", regular, Font{Family: "Go", PointSize: 24, Weight: font.WeightBold, Style: font.StyleItalic}, SynthesisAll},
+		{"disabled", regular, Font{Family: "Go", PointSize: 24, Weight: font.WeightBold, NoSynthesis: SynthesisWeight}, SynthesisNone},
+		{"bold face", both, Font{Family: "Go", PointSize: 24, Weight: font.WeightBold}, SynthesisNone},
+	}
+	for _, tt := range tests {
+		raw := tt.db.LoadRawFont(&tt.f)
+		if raw == nil {
+			t.Errorf("%s: no face", tt.name)
+			continue
+		}
+		if raw.Synthetic != tt.want {
+			t.Errorf("%s: synthesis %v, want %v", tt.name, raw.Synthetic, tt.want)
+		}
+		if tt.db != regular {
+			continue
+		}
+		// every glyph of a synthesized bold is wider by the strength
+		want := NewPath().MeasureTextByDB("ab", &Font{Family: "Go", PointSize: 24}, regular)
+		if tt.want&SynthesisWeight != 0 {
+			want += 2 * emboldenStrength(24)
+		}
+		if w := NewPath().MeasureTextByDB("ab", &tt.f, regular); w != want {
+			t.Errorf("%s: width %v, want %v", tt.name, w, want)
+		}
+	}
+}
+
+// TestSynthesizeGlyph synthesizes a square of 10 pixels standing on the
+// baseline.
+func TestSynthesizeGlyph(t *testing.T) {
+	pt := func(x, y float64) fixed.Point26_6 {
+		return fixed.Point26_6{X: fixed.Int26_6(x * 64), Y: fixed.Int26_6(y * 64)}
+	}
+	square := func() []sfnt.Segment {
+		return []sfnt.Segment{
+			{Op: sfnt.SegmentOpMoveTo, Args: [3]fixed.Point26_6{pt(0, 0)}},
+			{Op: sfnt.SegmentOpLineTo, Args: [3]fixed.Point26_6{pt(0, -10)}},
+			{Op: sfnt.SegmentOpLineTo, Args: [3]fixed.Point26_6{pt(10, -10)}},
+			{Op: sfnt.SegmentOpLineTo, Args: [3]fixed.Point26_6{pt(10, 0)}},
+			{Op: sfnt.SegmentOpLineTo, Args: [3]fixed.Point26_6{pt(0, 0)}},
+		}
+	}
+	tests := []struct {
+		name    string
+		synth   FontSynthesis
+		advance float64
+		want    [4]fixed.Point26_6 // the corners, from the first one
+	}{
+		{"none", SynthesisNone, 12, [4]fixed.Point26_6{pt(0, 0), pt(0, -10), pt(10, -10), pt(10, 0)}},
+		// the square grows by the strength of 1 pixel at 24 points and
+		// stays on the baseline at the origin
+		{"bold", SynthesisWeight, 13, [4]fixed.Point26_6{pt(0, 0), pt(0, -11), pt(11, -11), pt(11, 0)}},
+		// the top moves right by 10 times the shear
+		{"oblique", SynthesisStyle, 12, [4]fixed.Point26_6{pt(0, 0), {X: 136, Y: -640}, {X: 776, Y: -640}, pt(10, 0)}},
+	}
+	for _, tt := range tests {
+		segments := square()
+		synthesizeGlyph(segments, tt.synth, 24)
+		for i, want := range tt.want {
+			if got := segments[i].Args[0]; got != want {
+				t.Errorf("%s: corner %d at %v, want %v", tt.name, i, got, want)
+			}
+		}
+		if got := segments[4].Args[0]; got != segments[0].Args[0] {
+			t.Errorf("%s: contour closes at %v, want %v", tt.name, got, segments[0].Args[0])
+		}
+		if a := synthesizeAdvance(12, tt.synth, 24); a != tt.advance {
+			t.Errorf("%s: advance %v, want %v", tt.name, a, tt.advance)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+//go:build !nofont || !wx
+// +build !nofont !wx
+
+package canvas
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"golang.org/x/image/font"
+)
+
+// sfnt tables not exposed by golang.org/x/image/font/sfnt are read directly
+// from the font source.
+//
+// https://docs.microsoft.com/en-us/typography/opentype/spec/otff
+
+var errTableNotFound = errors.New("sfnt table not found")
+
+type sfntSource struct {
+	src    io.ReaderAt
+	offset int64 // offset of the table directory, non-zero inside a collection
+}
+
+// collectionOffsets returns the table directory offsets of a TrueType
+// collection, or nil if src is not a collection.
+func collectionOffsets(src io.ReaderAt) []int64 {
+	var hdr [12]byte
+	if _, err := src.ReadAt(hdr[:], 0); err != nil {
+		return nil
+	}
+	if string(hdr[:4]) != "ttcf" {
+		return nil
+	}
+	n := binary.BigEndian.Uint32(hdr[8:])
+	if n > 0xffff {
+		return nil
+	}
+	buf := make([]byte, 4*n)
+	if _, err := src.ReadAt(buf, 12); err != nil {
+		return nil
+	}
+	offsets := make([]int64, n)
+	for i := range offsets {
+		offsets[i] = int64(binary.BigEndian.Uint32(buf[4*i:]))
+	}
+	return offsets
+}
+
+// table returns the content of the table with the given tag.
+func (s *sfntSource) table(tag string) ([]byte, error) {
+	if s == nil || s.src == nil {
+		return nil, errTableNotFound
+	}
+	var hdr [12]byte
+	if _, err := s.src.ReadAt(hdr[:], s.offset); err != nil {
+		return nil, err
+	}
+	n := int(binary.BigEndian.Uint16(hdr[4:]))
+	dir := make([]byte, 16*n)
+	if _, err := s.src.ReadAt(dir, s.offset+12); err != nil {
+		return nil, err
+	}
+	for i := 0; i < n; i++ {
+		rec := dir[16*i:]
+		if string(rec[:4]) != tag {
+			continue
+		}
+		offset := int64(binary.BigEndian.Uint32(rec[8:]))
+		length := binary.BigEndian.Uint32(rec[12:])
+		if length > 1<<28 {
+			return nil, errors.New("sfnt table too large")
+		}
+		buf := make([]byte, length)
+		if _, err := s.src.ReadAt(buf, offset); err != nil && err != io.EOF {
+			return nil, err
+		}
+		return buf, nil
+	}
+	return nil, errTableNotFound
+}
+
+type tableReader []byte
+
+func (b tableReader) u16(i int) uint16 {
+	if i < 0 || i+2 > len(b) {
+		return 0
+	}
+	return binary.BigEndian.Uint16(b[i:])
+}
+
+func (b tableReader) i16(i int) int16 {
+	return int16(b.u16(i))
+}
+
+func (b tableReader) u32(i int) uint32 {
+	if i < 0 || i+4 > len(b) {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b[i:])
+}
+
+// parseCmapCoverage returns the runes mapped to a glyph by the best unicode
+// subtable of a cmap table.
+func parseCmapCoverage(cmap []byte) (RuneRanges, error) {
+	b := tableReader(cmap)
+	n := int(b.u16(2))
+	var best, bestOffset int = -1, 0
+	for i := 0; i < n; i++ {
+		pid, eid := b.u16(4+8*i), b.u16(6+8*i)
+		offset := int(b.u32(8 + 8*i))
+		format := b.u16(offset)
+		var score int
+		switch {
+		case format == 12 && (pid == 0 || (pid == 3 && eid == 10)):
+			score = 3
+		case format == 4 && (pid == 0 || (pid == 3 && eid == 1)):
+			score = 2
+		case format == 4 && pid == 3 && eid == 0:
+			score = 1 // symbol
+		default:
+			continue
+		}
+		if score > best {
+			best, bestOffset = score, offset
+		}
+	}
+	if best < 0 {
+		return nil, errors.New("cmap: no unicode subtable")
+	}
+	if b.u16(bestOffset) == 12 {
+		return parseCmap12(b[bestOffset:]), nil
+	}
+	return parseCmap4(b[bestOffset:]), nil
+}
+
+func parseCmap4(b tableReader) RuneRanges {
+	segs := int(b.u16(6)) / 2
+	ends, starts := 14, 16+2*segs
+	deltas, rangeOffsets := 16+4*segs, 16+6*segs
+	var rs RuneRanges
+	for i := 0; i < segs; i++ {
+		lo, hi := rune(b.u16(starts+2*i)), rune(b.u16(ends+2*i))
+		if lo > hi || lo == 0xffff {
+			continue
+		}
+		delta := b.u16(deltas + 2*i)
+		ro := int(b.u16(rangeOffsets + 2*i))
+		if ro == 0 {
+			// exactly one code point of the segment may map to glyph 0
+			z := rune(-delta)
+			if z < lo || z > hi {
+				rs = append(rs, RuneRange{lo, hi})
+				continue
+			}
+			if z > lo {
+				rs = append(rs, RuneRange{lo, z - 1})
+			}
+			if z < hi {
+				rs = append(rs, RuneRange{z + 1, hi})
+			}
+			continue
+		}
+		start := -1
+		for c := lo; c <= hi; c++ {
+			pos := rangeOffsets + 2*i + ro + 2*int(c-lo)
+			if b.u16(pos) != 0 {
+				if start < 0 {
+					start = int(c)
+				}
+				continue
+			}
+			if start >= 0 {
+				rs = append(rs, RuneRange{rune(start), c - 1})
+				start = -1
+			}
+		}
+		if start >= 0 {
+			rs = append(rs, RuneRange{rune(start), hi})
+		}
+	}
+	return rs.normalize()
+}
+
+func parseCmap12(b tableReader) RuneRanges {
+	n := int(b.u32(12))
+	if n > len(b)/12 {
+		n = len(b) / 12
+	}
+	rs := make(RuneRanges, 0, n)
+	for i := 0; i < n; i++ {
+		lo, hi := rune(b.u32(16+12*i)), rune(b.u32(20+12*i))
+		if b.u32(24+12*i) == 0 {
+			lo++
+		}
+		if lo <= hi {
+			rs = append(rs, RuneRange{lo, hi})
+		}
+	}
+	return rs.normalize()
+}
+
+// parseSingleSubstitutions returns the single glyph substitutions of the
+// GSUB lookups of the features with the given tags, in any script.
+func parseSingleSubstitutions(gsub []byte, tags ...string) map[uint16]uint16 {
+	b := tableReader(gsub)
+	subst := make(map[uint16]uint16)
+	features, lookups := int(b.u16(6)), int(b.u16(8))
+	nlookups := int(b.u16(lookups))
+	seen := make(map[int]bool)
+	for i, n := 0, int(b.u16(features)); i < n; i++ {
+		rec := features + 2 + 6*i
+		if rec+6 > len(b) || !contains(string(b[rec:rec+4]), tags) {
+			continue
+		}
+		feature := features + int(b.u16(rec+4))
+		for j, m := 0, int(b.u16(feature+2)); j < m; j++ {
+			index := int(b.u16(feature + 4 + 2*j))
+			if seen[index] || index >= nlookups {
+				continue
+			}
+			seen[index] = true
+			lookup := lookups + int(b.u16(lookups+2+2*index))
+			typ := b.u16(lookup)
+			for k, l := 0, int(b.u16(lookup+4)); k < l; k++ {
+				sub := lookup + int(b.u16(lookup+6+2*k))
+				if typ == 7 && b.u16(sub+2) == 1 {
+					// extension substitution
+					sub += int(b.u32(sub + 4))
+				} else if typ != 1 {
+					continue
+				}
+				parseSingleSubstitution(b, sub, subst)
+			}
+		}
+	}
+	return subst
+}
+
+func parseSingleSubstitution(b tableReader, sub int, subst map[uint16]uint16) {
+	format := b.u16(sub)
+	coverage := parseCoverage(b, sub+int(b.u16(sub+2)))
+	for i, g := range coverage {
+		switch format {
+		case 1:
+			subst[g] = g + b.u16(sub+4)
+		case 2:
+			if i < int(b.u16(sub+4)) {
+				subst[g] = b.u16(sub + 6 + 2*i)
+			}
+		}
+	}
+}
+
+// parseCoverage returns the glyphs of a coverage table in coverage index order.
+func parseCoverage(b tableReader, offset int) []uint16 {
+	var glyphs []uint16
+	switch b.u16(offset) {
+	case 1:
+		n := int(b.u16(offset + 2))
+		for i := 0; i < n && offset+4+2*i < len(b); i++ {
+			glyphs = append(glyphs, b.u16(offset+4+2*i))
+		}
+	case 2:
+		n := int(b.u16(offset + 2))
+		for i := 0; i < n && offset+4+6*i < len(b); i++ {
+			rec := offset + 4 + 6*i
+			for g := int(b.u16(rec)); g <= int(b.u16(rec+2)); g++ {
+				glyphs = append(glyphs, uint16(g))
+			}
+		}
+	}
+	return glyphs
+}
+
+// verticalMetrics are the vhea and vmtx tables.
+type verticalMetrics struct {
+	n    int // numOfLongVerMetrics
+	vmtx tableReader
+}
+
+func parseVerticalMetrics(vhea, vmtx []byte) *verticalMetrics {
+	n := int(tableReader(vhea).u16(34))
+	if n == 0 || 4*n > len(vmtx) {
+		return nil
+	}
+	return &verticalMetrics{n, vmtx}
+}
+
+// metrics returns the advance height and top side bearing of a glyph in
+// font units.
+func (m *verticalMetrics) metrics(g uint16) (advance uint16, tsb int16) {
+	if int(g) < m.n {
+		return m.vmtx.u16(4 * int(g)), m.vmtx.i16(4*int(g) + 2)
+	}
+	return m.vmtx.u16(4 * (m.n - 1)), m.vmtx.i16(4*m.n + 2*(int(g)-m.n))
+}
+
+// os2Descriptors returns the weight, style and stretch of a face read from
+// the usWeightClass, fsSelection and usWidthClass fields of its OS/2 table.
+// ok is false if the face has no OS/2 table or no weight class.
+func (r *rawFont) os2Descriptors() (weight font.Weight, style font.Style, stretch font.Stretch, ok bool) {
+	os2, err := r.source.table("OS/2")
+	if err != nil {
+		return
+	}
+	t := tableReader(os2)
+	class := int(t.u16(4))
+	if class == 0 {
+		return
+	}
+	// 100 is thin, 400 normal and 900 black
+	weight = font.Weight((class+50)/100 - 4)
+	if weight < font.WeightThin {
+		weight = font.WeightThin
+	} else if weight > font.WeightBlack {
+		weight = font.WeightBlack
+	}
+	switch sel := t.u16(62); {
+	case sel&0x0001 != 0:
+		style = font.StyleItalic
+	case sel&0x0200 != 0:
+		style = font.StyleOblique
+	}
+	// 1 is ultra-condensed, 5 normal and 9 ultra-expanded
+	if width := int(t.u16(6)); width >= 1 && width <= 9 {
+		stretch = font.Stretch(width - 5)
+	}
+	return weight, style, stretch, true
+}
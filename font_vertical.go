@@ -0,0 +1,37 @@
+//go:build !nofont || !wx
+// +build !nofont !wx
+
+package canvas
+
+import (
+	"log"
+)
+
+// verticalTables returns the 'vert' glyph substitutions and the vertical
+// metrics of the font, vmetrics is nil if the font has no vmtx table.
+func (r *rawFont) verticalTables() (vert map[uint16]uint16, vmetrics *verticalMetrics) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.vloaded {
+		return r.vert, r.vmetrics
+	}
+	r.vloaded = true
+	if err := r.parseFont(); err != nil {
+		return nil, nil
+	}
+	if gsub, err := r.source.table("GSUB"); err == nil {
+		r.vert = parseSingleSubstitutions(gsub, "vert", "vrt2")
+	} else if err != errTableNotFound {
+		log.Printf("GSUB: %v, %v\n", r.FullName, err)
+	}
+	vhea, err := r.source.table("vhea")
+	if err != nil {
+		return r.vert, nil
+	}
+	vmtx, err := r.source.table("vmtx")
+	if err != nil {
+		return r.vert, nil
+	}
+	r.vmetrics = parseVerticalMetrics(vhea, vmtx)
+	return r.vert, r.vmetrics
+}
@@ -42,19 +42,28 @@ type WebContext2D struct {
 	ctx2d  js.Value
 	width  int
 	height int
+	text   textState
+	texts  []textState // saved by Save
+}
+
+// textState is the text state the browser does not keep.
+type textState struct {
+	decoration  TextDecoration
+	writingMode WritingMode
+	font        *Font // for the outlines of text on a path
 }
 
 func NewWebContext2DForContext(canvas js.Value, ctx2d js.Value) Context2D {
 	width := canvas.Get("width").Int()
 	height := canvas.Get("height").Int()
-	return &WebContext2D{canvas, ctx2d, width, height}
+	return &WebContext2D{canvas: canvas, ctx2d: ctx2d, width: width, height: height}
 }
 
 func NewWebContext2DForCanvas(canvas js.Value) Context2D {
 	width := canvas.Get("width").Int()
 	height := canvas.Get("height").Int()
 	ctx2d := canvas.Call("getContext", "2d")
-	return &WebContext2D{canvas, ctx2d, width, height}
+	return &WebContext2D{canvas: canvas, ctx2d: ctx2d, width: width, height: height}
 }
 
 func NewWebContext2DForImage(img image.Image) Context2D {
@@ -78,10 +87,15 @@ func (r *WebContext2D) Draw() {
 
 func (r *WebContext2D) Save() {
 	r.ctx2d.Call("save")
+	r.texts = append(r.texts, r.text)
 }
 
 func (r *WebContext2D) Restore() {
 	r.ctx2d.Call("restore")
+	if n := len(r.texts); n > 0 {
+		r.text = r.texts[n-1]
+		r.texts = r.texts[:n-1]
+	}
 }
 
 func (r *WebContext2D) Scale(x float64, y float64) {
@@ -219,20 +233,361 @@ func (r *WebContext2D) Arc(x float64, y float64, radius float64, startAngle floa
 }
 
 func (r *WebContext2D) StrokeText(s string, x, y float64) {
-	r.ctx2d.Call("strokeText", s, x, y)
+	r.drawText(s, x, y, "strokeText", "strokeStyle")
 }
 
 func (r *WebContext2D) FillText(s string, x, y float64) {
-	r.ctx2d.Call("fillText", s, x, y)
+	r.drawText(s, x, y, "fillText", "fillStyle")
+}
+
+// FillTextOnPath fills text set along path with the outlines of the
+// current font in the default font database, the browser cannot set text
+// on a path.
+func (r *WebContext2D) FillTextOnPath(text string, path *Path, offset float64, side TextPathSide) {
+	if p := r.textOnPath(text, path, offset, side); p != nil {
+		r.ctx2d.Call("fill", jsPath2D(p), "nonzero")
+	}
+}
+
+func (r *WebContext2D) StrokeTextOnPath(text string, path *Path, offset float64, side TextPathSide) {
+	if p := r.textOnPath(text, path, offset, side); p != nil {
+		r.ctx2d.Call("stroke", jsPath2D(p))
+	}
+}
+
+func (r *WebContext2D) textOnPath(text string, path *Path, offset float64, side TextPathSide) *Path {
+	if r.text.font == nil {
+		return nil
+	}
+	align := ParserTextAlign(r.ctx2d.Get("textAlign").String())
+	base := ParserTextBaseline(r.ctx2d.Get("textBaseline").String())
+	return textOnPath(text, path, offset, side, align, base, r.text.font, nil)
+}
+
+// FillGlyphs fills the outlines of run, the browser cannot draw glyphs.
+func (r *WebContext2D) FillGlyphs(run *GlyphRun, x, y float64) {
+	p := NewPath()
+	p.AddGlyphs(run, x, y)
+	r.ctx2d.Call("fill", jsPath2D(p), "nonzero")
+}
+
+func (r *WebContext2D) StrokeGlyphs(run *GlyphRun, x, y float64) {
+	p := NewPath()
+	p.AddGlyphs(run, x, y)
+	r.ctx2d.Call("stroke", jsPath2D(p))
+}
+
+// drawText draws text with method and its decoration with the given style
+// of the context.
+func (r *WebContext2D) drawText(s string, x, y float64, method, style string) {
+	if bf, k := (*FontDB)(nil).bitmapFont(r.text.font); bf != nil {
+		r.drawBitmapText(bf, k, s, x, y, style)
+		return
+	}
+	if r.text.writingMode.IsVertical() {
+		r.drawVerticalText(s, x, y, method, style)
+		return
+	}
+	under, through := r.decorationPaths(s, x, y)
+	r.fillDecoration(under, style)
+	r.ctx2d.Call(method, s, x, y)
+	r.fillDecoration(through, style)
+}
+
+func (r *WebContext2D) SetTextDecoration(d TextDecoration) {
+	r.text.decoration = d
+}
+
+func (r *WebContext2D) TextDecoration() TextDecoration {
+	return r.text.decoration
+}
+
+func (r *WebContext2D) SetWritingMode(mode WritingMode) {
+	r.text.writingMode = mode
+}
+
+func (r *WebContext2D) WritingMode() WritingMode {
+	return r.text.writingMode
+}
+
+// SetAntialias maps a to the image smoothing of the browser, which saves
+// and restores it with the context. The browser antialiases paths in any
+// case, CSS shape-rendering applies to SVG only.
+func (r *WebContext2D) SetAntialias(a Antialias) {
+	switch a {
+	case AntialiasNone:
+		r.ctx2d.Set("imageSmoothingEnabled", false)
+	case AntialiasHigh:
+		r.ctx2d.Set("imageSmoothingEnabled", true)
+		r.ctx2d.Set("imageSmoothingQuality", "high")
+	default:
+		r.ctx2d.Set("imageSmoothingEnabled", true)
+		r.ctx2d.Set("imageSmoothingQuality", "low")
+	}
+}
+
+func (r *WebContext2D) Antialias() Antialias {
+	if !r.ctx2d.Get("imageSmoothingEnabled").Bool() {
+		return AntialiasNone
+	}
+	if q := r.ctx2d.Get("imageSmoothingQuality"); q.Type() == js.TypeString && q.String() == "high" {
+		return AntialiasHigh
+	}
+	return AntialiasDefault
+}
+
+// drawBitmapText draws text in a bitmap font of the default font database
+// at the nearest pixel. The glyphs are filled with the style on a scratch
+// canvas, a gradient or pattern is not aligned with the context.
+func (r *WebContext2D) drawBitmapText(bf *BitmapFont, k int, text string, x, y float64, style string) {
+	m := bf.metrics(k)
+	width := float64(bf.Advance(text) * k)
+	y += baselineOffset(ParserTextBaseline(r.ctx2d.Get("textBaseline").String()), m)
+	switch ParserTextAlign(r.ctx2d.Get("textAlign").String()) {
+	case AlignRight:
+		x -= width
+	case AlignCenter:
+		x -= width / 2
+	}
+	under, through := decorationPaths(&r.text.decoration, m, nil, x, y, width)
+	r.fillDecoration(under, style)
+	mask := bf.textMask(text, k)
+	if !mask.Rect.Empty() {
+		glyphs := NewWebContext2DForImage(mask).(*WebContext2D)
+		glyphs.ctx2d.Set("globalCompositeOperation", "source-in")
+		glyphs.ctx2d.Set("fillStyle", r.ctx2d.Get(style))
+		glyphs.ctx2d.Call("fillRect", 0, 0, mask.Rect.Dx(), mask.Rect.Dy())
+		tr := r.ctx2d.Call("getTransform")
+		dx := tr.Get("a").Float()*x + tr.Get("c").Float()*y + tr.Get("e").Float()
+		dy := tr.Get("b").Float()*x + tr.Get("d").Float()*y + tr.Get("f").Float()
+		r.ctx2d.Call("save")
+		r.ctx2d.Call("setTransform", 1, 0, 0, 1, 0, 0)
+		r.ctx2d.Set("imageSmoothingEnabled", false)
+		r.ctx2d.Call("drawImage", glyphs.canvas, math.Round(dx)+float64(mask.Rect.Min.X), math.Round(dy)+float64(mask.Rect.Min.Y))
+		r.ctx2d.Call("restore")
+	}
+	r.fillDecoration(through, style)
+}
+
+// verticalRun is a run of vertical text drawn with one call.
+type verticalRun struct {
+	text    string
+	orient  int
+	combine bool // tate-chu-yoko
+	width   float64
+	advance float64
+}
+
+// verticalRuns splits text into runs of upright characters, rotated text
+// and combined digits. The browser does not apply vertical alternates so
+// brackets are rotated.
+func (r *WebContext2D) verticalRuns(text string, em float64) (runs []verticalRun, height float64) {
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		if n := tateChuYokoLen(runes, i); n > 0 {
+			s := string(runes[i : i+n])
+			runs = append(runs, verticalRun{text: s, combine: true, width: r.measureWidth(s), advance: em})
+			i += n - 1
+			continue
+		}
+		if verticalOrientation(runes[i]) == orientUpright {
+			s := string(runes[i])
+			runs = append(runs, verticalRun{text: s, orient: orientUpright, width: r.measureWidth(s), advance: em})
+			continue
+		}
+		j := i + 1
+		for j < len(runes) && verticalOrientation(runes[j]) != orientUpright && tateChuYokoLen(runes, j) == 0 {
+			j++
+		}
+		s := string(runes[i:j])
+		w := r.measureWidth(s)
+		runs = append(runs, verticalRun{text: s, orient: orientRotated, width: w, advance: w})
+		i = j - 1
+	}
+	for _, run := range runs {
+		height += run.advance
+	}
+	return
+}
+
+func (r *WebContext2D) drawVerticalText(text string, x, y float64, method, style string) {
+	m := r.FontMetrics()
+	em := m.Ascent + m.Descent
+	runs, height := r.verticalRuns(text, em)
+	// center of the line
+	switch ParserTextBaseline(r.ctx2d.Get("textBaseline").String()) {
+	case AlignTop, AlignHanging:
+		x -= em / 2
+	case AlignIdeographic, AlignBottom:
+		x += em / 2
+	case AlignAlphabetic:
+		x += (m.Ascent - m.Descent) / 2
+	}
+	switch ParserTextAlign(r.ctx2d.Get("textAlign").String()) {
+	case AlignRight:
+		y -= height
+	case AlignCenter:
+		y -= height / 2
+	}
+	var under, through *Path
+	if r.text.decoration.Line != DecorationNone {
+		under, through = decorationPaths(&r.text.decoration, m, nil, 0, 0, height)
+		rotate := Matrix{0, 1, -1, 0, x - (m.Ascent-m.Descent)/2, y}
+		for _, l := range []*Path{under, through} {
+			if l != nil {
+				l.Transfrom(rotate)
+			}
+		}
+	}
+	r.fillDecoration(under, style)
+	r.ctx2d.Call("save")
+	r.ctx2d.Set("textAlign", "left")
+	r.ctx2d.Set("textBaseline", "alphabetic")
+	for _, run := range runs {
+		r.ctx2d.Call("save")
+		switch {
+		case run.combine:
+			scale := math.Min(1, em/run.width)
+			r.ctx2d.Call("translate", x-run.width*scale/2, y+m.Ascent)
+			r.ctx2d.Call("scale", scale, 1)
+		case run.orient == orientUpright:
+			r.ctx2d.Call("translate", x-run.width/2, y+m.Ascent)
+		default:
+			r.ctx2d.Call("translate", x-(m.Ascent-m.Descent)/2, y)
+			r.ctx2d.Call("rotate", math.Pi/2)
+		}
+		r.ctx2d.Call(method, run.text, 0, 0)
+		r.ctx2d.Call("restore")
+		y += run.advance
+	}
+	r.ctx2d.Call("restore")
+	r.fillDecoration(through, style)
+}
+
+// decorationPaths returns the decoration of text, without skipping ink as
+// the glyph outlines are unknown.
+func (r *WebContext2D) decorationPaths(text string, x, y float64) (under, through *Path) {
+	if r.text.decoration.Line == DecorationNone {
+		return nil, nil
+	}
+	m := r.FontMetrics()
+	width := r.MeasureText(text)
+	switch ParserTextAlign(r.ctx2d.Get("textAlign").String()) {
+	case AlignRight:
+		x -= width
+	case AlignCenter:
+		x -= width / 2
+	}
+	y += baselineOffset(ParserTextBaseline(r.ctx2d.Get("textBaseline").String()), m)
+	return decorationPaths(&r.text.decoration, m, nil, x, y, width)
+}
+
+// fillDecoration fills p with the decoration color or the given style of
+// the context.
+func (r *WebContext2D) fillDecoration(p *Path, style string) {
+	if p == nil {
+		return
+	}
+	r.ctx2d.Call("save")
+	if r.text.decoration.Color != nil {
+		r.ctx2d.Set("fillStyle", color2html(r.text.decoration.Color))
+	} else {
+		r.ctx2d.Set("fillStyle", r.ctx2d.Get(style))
+	}
+	r.ctx2d.Call("fill", jsPath2D(p), "nonzero")
+	r.ctx2d.Call("restore")
+}
+
+// jsPath2D converts p to a Path2D object.
+func jsPath2D(p *Path) js.Value {
+	path := js.Global().Get("Path2D").New()
+	i := 0
+	for _, cmp := range p.Components {
+		switch cmp {
+		case MoveToCmp:
+			path.Call("moveTo", p.Points[i], p.Points[i+1])
+			i += 2
+		case LineToCmp:
+			path.Call("lineTo", p.Points[i], p.Points[i+1])
+			i += 2
+		case QuadCurveToCmp:
+			path.Call("quadraticCurveTo", p.Points[i], p.Points[i+1], p.Points[i+2], p.Points[i+3])
+			i += 4
+		case CubicCurveToCmp:
+			path.Call("bezierCurveTo", p.Points[i], p.Points[i+1], p.Points[i+2], p.Points[i+3], p.Points[i+4], p.Points[i+5])
+			i += 6
+		case ArcAngleCmp:
+			start, angle := p.Points[i+4], p.Points[i+5]
+			path.Call("ellipse", p.Points[i], p.Points[i+1], p.Points[i+2], p.Points[i+3], 0, start, start+angle, angle < 0)
+			i += 6
+		case CloseCmp:
+			path.Call("closePath")
+		}
+	}
+	return path
 }
 
 func (r *WebContext2D) MeasureText(text string) float64 {
+	if bf, k := (*FontDB)(nil).bitmapFont(r.text.font); bf != nil {
+		return float64(bf.Advance(text) * k)
+	}
+	if r.text.writingMode.IsVertical() {
+		m := r.FontMetrics()
+		_, height := r.verticalRuns(text, m.Ascent+m.Descent)
+		return height
+	}
+	return r.measureWidth(text)
+}
+
+func (r *WebContext2D) measureWidth(text string) float64 {
 	m := r.ctx2d.Call("measureText", text)
 	return m.Get("width").Float()
 }
 
+// FontMetrics approximates the metrics of the current font with
+// measureText, UnitsPerEm is unknown.
+func (r *WebContext2D) FontMetrics() *FontMetrics {
+	if bf, k := (*FontDB)(nil).bitmapFont(r.text.font); bf != nil {
+		return bf.metrics(k)
+	}
+	size := cssFontSize(r.ctx2d.Get("font").String())
+	m := r.ctx2d.Call("measureText", "Hgx")
+	fm := &FontMetrics{}
+	if v := m.Get("fontBoundingBoxAscent"); !v.IsUndefined() {
+		fm.Ascent = v.Float()
+		fm.Descent = m.Get("fontBoundingBoxDescent").Float()
+	} else {
+		fm.Ascent, fm.Descent = size*0.8, size*0.2
+	}
+	if v := r.ctx2d.Call("measureText", "x").Get("actualBoundingBoxAscent"); !v.IsUndefined() {
+		fm.XHeight = v.Float()
+		fm.CapHeight = r.ctx2d.Call("measureText", "H").Get("actualBoundingBoxAscent").Float()
+	} else {
+		fm.XHeight, fm.CapHeight = size*0.5, size*0.7
+	}
+	fm.UnderlineThickness = size / 14
+	fm.UnderlinePosition = size / 10
+	fm.StrikeoutThickness = fm.UnderlineThickness
+	fm.StrikeoutPosition = -fm.XHeight / 2
+	return fm
+}
+
+// cssFontSize returns the pixel size of a CSS font shorthand like the
+// canvas font property, "10px sans-serif".
+func cssFontSize(font string) float64 {
+	for _, v := range strings.Fields(font) {
+		if strings.HasSuffix(v, "px") {
+			if size, err := strconv.ParseFloat(v[:len(v)-2], 64); err == nil {
+				return size
+			}
+		}
+	}
+	return 10
+}
+
 func (r *WebContext2D) SetFont(f *Font) {
 	r.ctx2d.Set("font", f.String())
+	r.text.font = f
 }
 
 func (c *WebContext2D) DrawContext2D(cv Context2D, dx float64, dy float64) {
@@ -14,7 +14,7 @@ func NewWebContext2D(width, height int) Context2D {
 	canvas.Set("width", width)
 	canvas.Set("height", height)
 	ctx2d := canvas.Call("getContext", "2d")
-	return &WebContext2D{canvas, ctx2d, width, height}
+	return &WebContext2D{canvas: canvas, ctx2d: ctx2d, width: width, height: height}
 }
 
 func (c *WebContext2D) SetImage(img image.Image, dx float64, dy float64) {
@@ -15,7 +15,7 @@ func NewWebContext2D(width, height int) Context2D {
 	canvas.Set("width", width)
 	canvas.Set("height", height)
 	ctx2d := canvas.Call("getContext", "2d")
-	return &WebContext2D{canvas, ctx2d, width, height}
+	return &WebContext2D{canvas: canvas, ctx2d: ctx2d, width: width, height: height}
 }
 
 func NewWXGameContext2D() Context2D {
@@ -23,7 +23,7 @@ func NewWXGameContext2D() Context2D {
 	width := canvas.Get("width").Int()
 	height := canvas.Get("height").Int()
 	ctx2d := canvas.Call("getContext", "2d")
-	return &WebContext2D{canvas, ctx2d, width, height}
+	return &WebContext2D{canvas: canvas, ctx2d: ctx2d, width: width, height: height}
 }
 
 var (
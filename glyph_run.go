@@ -0,0 +1,57 @@
+package canvas
+
+import (
+	"golang.org/x/image/font/sfnt"
+)
+
+// Glyph is a positioned glyph of a GlyphRun.
+type Glyph struct {
+	ID      sfnt.GlyphIndex
+	Font    *RawFont // face the glyph comes from, a fallback face if needed
+	Cluster int      // byte offset in the text of the first rune of the glyph
+	Advance float64  // kerning with the next glyph included
+	XOffset float64
+	YOffset float64
+}
+
+// GlyphRun is shaped text, drawn with FillGlyphs and StrokeGlyphs.
+type GlyphRun struct {
+	Text   string
+	Glyphs []Glyph
+}
+
+// Advance returns the advance width of the run.
+func (r *GlyphRun) Advance() float64 {
+	var x float64
+	for i := range r.Glyphs {
+		x += r.Glyphs[i].Advance
+	}
+	return x
+}
+
+// XAt returns the x position of the caret before the byte offset in the
+// text, relative to the start of the run.
+func (r *GlyphRun) XAt(offset int) float64 {
+	var x float64
+	for i := range r.Glyphs {
+		if r.Glyphs[i].Cluster >= offset {
+			break
+		}
+		x += r.Glyphs[i].Advance
+	}
+	return x
+}
+
+// OffsetAt returns the byte offset in the text of the caret nearest to x,
+// relative to the start of the run.
+func (r *GlyphRun) OffsetAt(x float64) int {
+	var pen float64
+	for i := range r.Glyphs {
+		g := &r.Glyphs[i]
+		if x < pen+g.Advance/2 {
+			return g.Cluster
+		}
+		pen += g.Advance
+	}
+	return len(r.Text)
+}
@@ -3,7 +3,6 @@ module github.com/goplus/canvas
 go 1.16
 
 require (
-	github.com/esimov/stackblur-go v1.0.1-0.20190121110005-00e727e3c7a9
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0
 	golang.org/x/image v0.0.0-20210628002857-a66eb6448b8d
 )
@@ -0,0 +1,361 @@
+package canvas
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TextStyle is the style of a range of an AttributedText.
+type TextStyle struct {
+	Font       *Font          // nil keeps the font of the text
+	Size       int            // point size, 0 keeps the size of the font
+	Fill       Pattern        // nil keeps the fill style of the context
+	Decoration TextDecoration // drawn with the fill of the span if no color
+	// BaselineShift raises the span above the baseline, a negative shift
+	// lowers it. A superscript is usually raised by a third of the font
+	// size with a smaller size, a subscript lowered by a fifth.
+	BaselineShift float64
+}
+
+// AttributedText is text with styles applied to byte ranges, laid out as a
+// line or a paragraph of mixed fonts and sizes sharing their baselines.
+type AttributedText struct {
+	Text  string
+	Font  *Font     // font of the unstyled text
+	Align TextAlign // alignment of the lines
+	spans []textSpan
+}
+
+type textSpan struct {
+	start, end int
+	style      TextStyle
+}
+
+// NewAttributedText returns text without styles drawn with fnt.
+func NewAttributedText(text string, fnt *Font) *AttributedText {
+	return &AttributedText{Text: text, Font: fnt}
+}
+
+// SetStyle applies style to the bytes of the text in [start, end), the
+// styles previously set in the range are replaced.
+func (t *AttributedText) SetStyle(start, end int, style TextStyle) {
+	if start < 0 {
+		start = 0
+	}
+	if end > len(t.Text) {
+		end = len(t.Text)
+	}
+	if start >= end {
+		return
+	}
+	var spans []textSpan
+	for _, s := range t.spans {
+		if s.end <= start || s.start >= end {
+			spans = append(spans, s)
+			continue
+		}
+		if s.start < start {
+			spans = append(spans, textSpan{s.start, start, s.style})
+		}
+		if s.end > end {
+			spans = append(spans, textSpan{end, s.end, s.style})
+		}
+	}
+	spans = append(spans, textSpan{start, end, style})
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	t.spans = spans
+}
+
+// style returns the style of span i, -1 for the unstyled text.
+func (t *AttributedText) style(i int) *TextStyle {
+	if i < 0 {
+		return &TextStyle{}
+	}
+	return &t.spans[i].style
+}
+
+// font returns the font of span i.
+func (t *AttributedText) font(i int) *Font {
+	s := t.style(i)
+	f := t.Font
+	if s.Font != nil {
+		f = s.Font
+	}
+	if f == nil || s.Size <= 0 {
+		return f
+	}
+	sized := *f
+	sized.PointSize = s.Size
+	return &sized
+}
+
+// TextBox is the box of a styled range of a TextLayout, relative to the top
+// left corner of the layout.
+type TextBox struct {
+	Start, End int     // byte range of the text
+	Line       int     // index of the line
+	X, Y       float64 // start of the baseline, shifted
+	Width      float64
+	Ascent     float64 // above Y
+	Descent    float64 // below Y
+	span       int
+}
+
+// Bounds returns the rectangle of the box.
+func (b *TextBox) Bounds() (x, y, width, height float64) {
+	return b.X, b.Y - b.Ascent, b.Width, b.Ascent + b.Descent
+}
+
+// TextLine is a line of a TextLayout.
+type TextLine struct {
+	Start, End int     // byte range of the text
+	Baseline   float64 // y of the baseline from the top of the layout
+	Width      float64 // without trailing spaces
+	Ascent     float64
+	Descent    float64
+}
+
+// TextLayout is an AttributedText broken into lines.
+type TextLayout struct {
+	Lines  []TextLine
+	Boxes  []TextBox
+	Width  float64
+	Height float64
+	text   *AttributedText
+}
+
+// textPiece is an unbreakable piece of text in one style.
+type textPiece struct {
+	start, end int
+	span       int
+	breakAfter bool    // a line may break after the piece
+	newline    bool    // the line ends after the piece
+	width      float64 // advance width
+	space      float64 // advance of the trailing spaces
+	ascent     float64 // shifted
+	descent    float64
+	gap        float64
+}
+
+// pieces splits the text at the style boundaries and the line break
+// opportunities: after spaces, around ideographs and at newlines, which
+// are left out of the pieces.
+func (t *AttributedText) pieces() []textPiece {
+	var pieces []textPiece
+	span, next := -1, 0
+	spanAt := func(i int) int {
+		for next < len(t.spans) && t.spans[next].end <= i {
+			next++
+		}
+		if next < len(t.spans) && t.spans[next].start <= i {
+			return next
+		}
+		return -1
+	}
+	start := 0
+	cut := func(end int, breakAfter, newline bool) {
+		if end > start || newline {
+			pieces = append(pieces, textPiece{start: start, end: end, span: span, breakAfter: breakAfter, newline: newline})
+		}
+	}
+	var prev rune
+	for i, r := range t.Text {
+		s := spanAt(i)
+		switch {
+		case r == '\n':
+			cut(i, true, true)
+			start = i + len("\n")
+			span, prev = s, 0
+			continue
+		case i > start && s != span:
+			cut(i, prev == ' ' || isIdeographic(prev) || isIdeographic(r), false)
+			start = i
+		case i > start && ((prev == ' ' && r != ' ') || isIdeographic(prev) || isIdeographic(r)):
+			cut(i, true, false)
+			start = i
+		}
+		span, prev = s, r
+	}
+	if start < len(t.Text) {
+		cut(len(t.Text), true, false)
+	}
+	return pieces
+}
+
+func isIdeographic(r rune) bool {
+	return r >= utf8.RuneSelf && unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// Layout breaks the text into lines no wider than maxWidth, measured with
+// ctx. A maxWidth <= 0 lays out every paragraph on one line.
+func (t *AttributedText) Layout(ctx Context2D, maxWidth float64) *TextLayout {
+	ctx.Save()
+	defer ctx.Restore()
+	ctx.SetWritingMode(HorizontalTB)
+	pieces := t.pieces()
+	metrics := make(map[int]*FontMetrics)
+	for i := range pieces {
+		pc := &pieces[i]
+		if f := t.font(pc.span); f != nil {
+			ctx.SetFont(f)
+		}
+		m, ok := metrics[pc.span]
+		if !ok {
+			if m = ctx.FontMetrics(); m == nil {
+				size := 12.0
+				if f := t.font(pc.span); f != nil {
+					size = float64(f.PointSize)
+				}
+				m = &FontMetrics{Ascent: size * 0.8, Descent: size * 0.2}
+			}
+			metrics[pc.span] = m
+		}
+		s := t.Text[pc.start:pc.end]
+		pc.width = ctx.MeasureText(s)
+		if trimmed := strings.TrimRight(s, " "); len(trimmed) < len(s) {
+			pc.space = pc.width - ctx.MeasureText(trimmed)
+		}
+		shift := t.style(pc.span).BaselineShift
+		pc.ascent, pc.descent, pc.gap = m.Ascent+shift, m.Descent-shift, m.LineGap
+	}
+
+	l := &TextLayout{text: t}
+	var line []textPiece
+	var lineWidth float64
+	flush := func() {
+		l.addLine(line)
+		line, lineWidth = nil, 0
+	}
+	for i := 0; i < len(pieces); {
+		// the pieces of a word
+		j, w := i, 0.0
+		for j < len(pieces) {
+			w += pieces[j].width
+			j++
+			if pieces[j-1].breakAfter {
+				break
+			}
+		}
+		if maxWidth > 0 && len(line) > 0 && lineWidth+w-pieces[j-1].space > maxWidth {
+			flush()
+		}
+		line = append(line, pieces[i:j]...)
+		lineWidth += w
+		if pieces[j-1].newline {
+			flush()
+		}
+		i = j
+	}
+	if len(line) > 0 {
+		flush()
+	}
+
+	width := maxWidth
+	if width <= 0 {
+		width = l.Width
+	}
+	for i := range l.Lines {
+		var dx float64
+		switch t.Align {
+		case AlignCenter:
+			dx = (width - l.Lines[i].Width) / 2
+		case AlignRight:
+			dx = width - l.Lines[i].Width
+		}
+		for j := range l.Boxes {
+			if l.Boxes[j].Line == i {
+				l.Boxes[j].X += dx
+			}
+		}
+	}
+	return l
+}
+
+// addLine appends a line of pieces below the last line, its height is the
+// largest ascent and descent of its pieces with half of the line gap above
+// and below like CSS.
+func (l *TextLayout) addLine(pieces []textPiece) {
+	line := TextLine{Start: pieces[0].start, End: pieces[len(pieces)-1].end}
+	var gap float64
+	for _, pc := range pieces {
+		if pc.ascent > line.Ascent {
+			line.Ascent = pc.ascent
+		}
+		if pc.descent > line.Descent {
+			line.Descent = pc.descent
+		}
+		if pc.gap > gap {
+			gap = pc.gap
+		}
+	}
+	line.Ascent += gap / 2
+	line.Descent += gap / 2
+	line.Baseline = l.Height + line.Ascent
+	n := len(l.Lines)
+	var x float64
+	for _, pc := range pieces {
+		if pc.end > pc.start {
+			shift := l.text.style(pc.span).BaselineShift
+			if k := len(l.Boxes) - 1; k >= 0 && l.Boxes[k].Line == n && l.Boxes[k].span == pc.span && l.Boxes[k].End == pc.start {
+				// continue the box of the previous piece
+				l.Boxes[k].End = pc.end
+				l.Boxes[k].Width += pc.width
+			} else {
+				l.Boxes = append(l.Boxes, TextBox{
+					Start:   pc.start,
+					End:     pc.end,
+					Line:    n,
+					X:       x,
+					Y:       line.Baseline - shift,
+					Width:   pc.width,
+					Ascent:  pc.ascent - shift,
+					Descent: pc.descent + shift,
+					span:    pc.span,
+				})
+			}
+		}
+		x += pc.width
+	}
+	line.Width = x - pieces[len(pieces)-1].space
+	if line.Width > l.Width {
+		l.Width = line.Width
+	}
+	l.Height += line.Ascent + line.Descent
+	l.Lines = append(l.Lines, line)
+}
+
+// Fill draws the layout with ctx, (x, y) is its top left corner.
+func (l *TextLayout) Fill(ctx Context2D, x, y float64) {
+	l.draw(ctx, x, y, ctx.FillText)
+}
+
+// Stroke strokes the text of the layout with ctx, the decorations are
+// filled.
+func (l *TextLayout) Stroke(ctx Context2D, x, y float64) {
+	l.draw(ctx, x, y, ctx.StrokeText)
+}
+
+func (l *TextLayout) draw(ctx Context2D, x, y float64, draw func(text string, x, y float64)) {
+	ctx.Save()
+	defer ctx.Restore()
+	ctx.SetWritingMode(HorizontalTB)
+	ctx.SetTextAlign(AlignLeft)
+	ctx.SetTextBaseline(AlignAlphabetic)
+	for i := range l.Boxes {
+		b := &l.Boxes[i]
+		style := l.text.style(b.span)
+		ctx.Save()
+		if f := l.text.font(b.span); f != nil {
+			ctx.SetFont(f)
+		}
+		if style.Fill != nil {
+			ctx.SetFillStyle(style.Fill)
+			ctx.SetStrokeStyle(style.Fill)
+		}
+		ctx.SetTextDecoration(style.Decoration)
+		draw(l.text.Text[b.Start:b.End], x+b.X, y+b.Y)
+		ctx.Restore()
+	}
+}
@@ -0,0 +1,142 @@
+//go:build !nofont
+// +build !nofont
+
+package canvas
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestSetStyle(t *testing.T) {
+	type span struct{ start, end, size int }
+	tests := []struct {
+		name   string
+		styles []span // set in order, the size tells the style
+		want   []span
+	}{
+		{"one", []span{{2, 5, 1}}, []span{{2, 5, 1}}},
+		{"clamped", []span{{-3, 40, 1}}, []span{{0, 10, 1}}},
+		{"empty", []span{{5, 5, 1}, {6, 2, 2}}, nil},
+		{"sorted", []span{{6, 8, 1}, {0, 2, 2}}, []span{{0, 2, 2}, {6, 8, 1}}},
+		{"split", []span{{0, 10, 1}, {3, 5, 2}}, []span{{0, 3, 1}, {3, 5, 2}, {5, 10, 1}}},
+		{"replaced", []span{{2, 4, 1}, {6, 8, 2}, {0, 10, 3}}, []span{{0, 10, 3}}},
+		{"overlap", []span{{0, 6, 1}, {4, 10, 2}}, []span{{0, 4, 1}, {4, 10, 2}}},
+	}
+	for _, tt := range tests {
+		text := NewAttributedText("0123456789", nil)
+		for _, s := range tt.styles {
+			text.SetStyle(s.start, s.end, TextStyle{Size: s.size})
+		}
+		var got []span
+		for _, s := range text.spans {
+			got = append(got, span{s.start, s.end, s.style.Size})
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: spans %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTextLayout(t *testing.T) {
+	db := NewFontDB()
+	if err := db.LoadFontData(goregular.TTF); err != nil {
+		t.Fatal(err)
+	}
+	fnt := &Font{Family: "Go", PointSize: 20}
+	gc := NewGraphicContext2DWithFonts(200, 200, db)
+	gc.SetFont(fnt)
+	m := gc.FontMetrics()
+	width := func(s string) float64 { return gc.MeasureText(s) }
+	const text = "hello world foo"
+	big := func(t *AttributedText) { t.SetStyle(6, 11, TextStyle{Size: 40}) }
+	raised := func(t *AttributedText) { t.SetStyle(12, 15, TextStyle{BaselineShift: 5}) }
+	tests := []struct {
+		name     string
+		text     string
+		style    func(t *AttributedText)
+		align    TextAlign
+		maxWidth float64
+		lines    []string
+		boxes    []string
+	}{
+		{"one line", text, nil, AlignLeft, 0, []string{text}, []string{text}},
+		{"wide", text, nil, AlignLeft, 1000, []string{text}, []string{text}},
+		{"wrapped", text, nil, AlignLeft, width("hello world") + 1, []string{"hello world ", "foo"}, []string{"hello world ", "foo"}},
+		{"narrow", text, nil, AlignLeft, 1, []string{"hello ", "world ", "foo"}, []string{"hello ", "world ", "foo"}},
+		{"newline", "ab\ncd", nil, AlignLeft, 0, []string{"ab", "cd"}, []string{"ab", "cd"}},
+		{"styled", text, big, AlignLeft, 0, []string{text}, []string{"hello ", "world", " foo"}},
+		{"shifted", text, raised, AlignLeft, 0, []string{text}, []string{"hello world ", "foo"}},
+		{"right", text, nil, AlignRight, 1000, []string{text}, []string{text}},
+		{"center", text, nil, AlignCenter, 1000, []string{text}, []string{text}},
+	}
+	for _, tt := range tests {
+		at := NewAttributedText(tt.text, fnt)
+		at.Align = tt.align
+		if tt.style != nil {
+			tt.style(at)
+		}
+		l := at.Layout(gc, tt.maxWidth)
+		var lines, boxes []string
+		for _, line := range l.Lines {
+			lines = append(lines, tt.text[line.Start:line.End])
+		}
+		for _, b := range l.Boxes {
+			boxes = append(boxes, tt.text[b.Start:b.End])
+		}
+		if !reflect.DeepEqual(lines, tt.lines) || !reflect.DeepEqual(boxes, tt.boxes) {
+			t.Errorf("%s: lines %q, boxes %q, want %q, %q", tt.name, lines, boxes, tt.lines, tt.boxes)
+			continue
+		}
+		for i, line := range l.Lines {
+			if tt.style != nil {
+				break
+			}
+			// trailing spaces do not count
+			if w := width(tt.text[line.Start:line.End]); line.Width > w || line.Width < w-width(" ")-1e-9 {
+				t.Errorf("%s: line %d is %v wide, want at most %v", tt.name, i, line.Width, w)
+			}
+		}
+		b := l.Boxes[0]
+		var x float64
+		switch tt.align {
+		case AlignRight:
+			x = tt.maxWidth - l.Lines[0].Width
+		case AlignCenter:
+			x = (tt.maxWidth - l.Lines[0].Width) / 2
+		}
+		if math.Abs(b.X-x) > 1e-9 {
+			t.Errorf("%s: first box at x %v, want %v", tt.name, b.X, x)
+		}
+	}
+
+	// the line of mixed sizes holds the larger font, the raised span keeps
+	// its height above the shifted baseline
+	at := NewAttributedText(text, fnt)
+	big(at)
+	raised(at)
+	l := at.Layout(gc, 0)
+	line := l.Lines[0]
+	if line.Ascent < 2*m.Ascent-1 || l.Height != line.Ascent+line.Descent {
+		t.Errorf("line ascent %v, height %v, want about %v", line.Ascent, l.Height, 2*m.Ascent)
+	}
+	var w float64
+	for _, b := range l.Boxes {
+		if b.Start != 6 {
+			w += b.Width
+		}
+		shift := 0.0
+		if b.Start == 12 {
+			shift = 5
+		}
+		if b.Y != line.Baseline-shift {
+			t.Errorf("box %q on %v, want %v", text[b.Start:b.End], b.Y, line.Baseline-shift)
+		}
+	}
+	if math.Abs(w-width("hello  foo")) > 1e-9 {
+		t.Errorf("boxes in the font of the text are %v wide, want %v", w, width("hello  foo"))
+	}
+}
@@ -0,0 +1,510 @@
+package canvas
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+// DistanceFieldMode selects the kind of distance field.
+type DistanceFieldMode int
+
+const (
+	// SDF is a single channel signed distance field, written to every
+	// channel of the image. Corners are rounded when it is magnified.
+	SDF DistanceFieldMode = iota
+	// MSDF is a multi-channel signed distance field, the median of the
+	// red, green and blue channels keeps the corners sharp.
+	MSDF
+)
+
+func (m DistanceFieldMode) MarshalText() ([]byte, error) {
+	if m == MSDF {
+		return []byte("msdf"), nil
+	}
+	return []byte("sdf"), nil
+}
+
+// The colors of the edges of an MSDF, a set of channels.
+const (
+	sdfRed   = 1
+	sdfGreen = 2
+	sdfBlue  = 4
+	sdfWhite = sdfRed | sdfGreen | sdfBlue
+)
+
+// sdfColors are cycled at the corners, any two share one channel.
+var sdfColors = [3]uint8{sdfGreen | sdfBlue, sdfRed | sdfBlue, sdfRed | sdfGreen}
+
+// sdfFlattenScale refines the flattening of curves, which is accurate to
+// about half a pixel at scale 1.
+const sdfFlattenScale = 16
+
+// sdfEdge is a smooth run of a contour, flattened into a polyline.
+type sdfEdge struct {
+	points []Vec
+	inner  []bool // segments inside the fill, where contours overlap
+	color  uint8
+	orient float64 // 1 if the inside is on the left of the edge, -1 otherwise
+}
+
+type sdfShape struct {
+	edges    []sdfEdge
+	contours [][2]int // ranges of edges
+	min, max Vec
+}
+
+// edgeCollector collects the polyline of one edge.
+type edgeCollector struct {
+	points []Vec
+}
+
+func (c *edgeCollector) LineTo(x, y float64) {
+	p := Vec{x / sdfFlattenScale, y / sdfFlattenScale}
+	if p != c.points[len(c.points)-1] {
+		c.points = append(c.points, p)
+	}
+}
+
+// newSDFShape splits the subpaths of p into edges at the junctions of its
+// segments that are corners. Every subpath is closed.
+func newSDFShape(p *Path) *sdfShape {
+	const s = sdfFlattenScale
+	shape := &sdfShape{
+		min: Vec{math.Inf(1), math.Inf(1)},
+		max: Vec{math.Inf(-1), math.Inf(-1)},
+	}
+	var contour [][]Vec
+	var start, last Vec
+	addEdge := func(points []Vec) {
+		if len(points) > 1 {
+			contour = append(contour, points)
+		}
+	}
+	closeContour := func() {
+		if last != start {
+			addEdge([]Vec{last, start})
+		}
+		shape.addContour(contour)
+		contour, last = nil, start
+	}
+	i := 0
+	for _, cmp := range p.Components {
+		c := &edgeCollector{points: []Vec{last}}
+		switch cmp {
+		case MoveToCmp:
+			closeContour()
+			start = Vec{p.Points[i], p.Points[i+1]}
+			last = start
+			i += 2
+			continue
+		case LineToCmp:
+			c.LineTo(p.Points[i]*s, p.Points[i+1]*s)
+			i += 2
+		case QuadCurveToCmp:
+			TraceQuad(c, []float64{last.X * s, last.Y * s, p.Points[i] * s, p.Points[i+1] * s, p.Points[i+2] * s, p.Points[i+3] * s}, 0.5)
+			c.LineTo(p.Points[i+2]*s, p.Points[i+3]*s)
+			i += 4
+		case CubicCurveToCmp:
+			TraceCubic(c, []float64{last.X * s, last.Y * s, p.Points[i] * s, p.Points[i+1] * s, p.Points[i+2] * s, p.Points[i+3] * s, p.Points[i+4] * s, p.Points[i+5] * s}, 0.5)
+			c.LineTo(p.Points[i+4]*s, p.Points[i+5]*s)
+			i += 6
+		case ArcAngleCmp:
+			x, y := TraceArc(c, p.Points[i]*s, p.Points[i+1]*s, p.Points[i+2]*s, p.Points[i+3]*s, p.Points[i+4], p.Points[i+5], 1)
+			c.LineTo(x, y)
+			i += 6
+		case CloseCmp:
+			closeContour()
+			continue
+		}
+		addEdge(c.points)
+		last = c.points[len(c.points)-1]
+	}
+	closeContour()
+	shape.splitOverlaps()
+	shape.orient()
+	return shape
+}
+
+// isCorner reports whether the direction turns from a to b by more than
+// about 8 degrees.
+func isCorner(a, b Vec) bool {
+	a, b = a.Unit(), b.Unit()
+	return a.Dot(b) <= 0 || math.Abs(a.Cross(b)) > math.Sin(3)
+}
+
+func edgeStartDir(e []Vec) Vec { return e[1].Sub(e[0]) }
+
+func edgeEndDir(e []Vec) Vec { return e[len(e)-1].Sub(e[len(e)-2]) }
+
+// addContour colors the edges of a closed contour so that the edges meeting
+// at a corner have different colors, and merges the smooth runs.
+func (s *sdfShape) addContour(contour [][]Vec) {
+	if len(contour) == 0 {
+		return
+	}
+	var corners []int // edges starting at a corner
+	for i := range contour {
+		if isCorner(edgeEndDir(contour[(i+len(contour)-1)%len(contour)]), edgeStartDir(contour[i])) {
+			corners = append(corners, i)
+		}
+	}
+	// the polylines of the runs between corners
+	var runs [][]Vec
+	first := 0
+	if len(corners) > 0 {
+		first = corners[0]
+	}
+	for k := range contour {
+		e := contour[(first+k)%len(contour)]
+		if len(runs) == 0 || (len(corners) > 0 && isCornerStart(corners, (first+k)%len(contour))) {
+			runs = append(runs, append([]Vec(nil), e...))
+			continue
+		}
+		runs[len(runs)-1] = append(runs[len(runs)-1], e[1:]...)
+	}
+	var colors []uint8
+	switch len(runs) {
+	case 1:
+		if len(corners) == 0 {
+			colors = []uint8{sdfWhite}
+			break
+		}
+		// a teardrop, split in three around its only corner
+		runs = splitPolyline(runs[0], 3)
+		colors = []uint8{sdfColors[0], sdfWhite, sdfColors[1]}
+	default:
+		colors = make([]uint8, len(runs))
+		for i := range runs {
+			colors[i] = sdfColors[i%3]
+		}
+		if n := len(runs); colors[n-1] == colors[0] {
+			colors[n-1] = sdfColors[3-colorIndex(colors[0])-colorIndex(colors[n-2])]
+		}
+	}
+
+	n := len(s.edges)
+	for i, r := range runs {
+		s.edges = append(s.edges, sdfEdge{points: r, color: colors[i]})
+		for _, p := range r {
+			s.min = Vec{math.Min(s.min.X, p.X), math.Min(s.min.Y, p.Y)}
+			s.max = Vec{math.Max(s.max.X, p.X), math.Max(s.max.Y, p.Y)}
+		}
+	}
+	s.contours = append(s.contours, [2]int{n, len(s.edges)})
+}
+
+// splitOverlaps splits the segments where they cross and marks the pieces
+// with the fill on both sides, which are not part of the outline.
+func (s *sdfShape) splitOverlaps() {
+	type segment struct {
+		a, b     Vec
+		min, max Vec
+	}
+	var segments []segment
+	for _, e := range s.edges {
+		for j := 1; j < len(e.points); j++ {
+			a, b := e.points[j-1], e.points[j]
+			segments = append(segments, segment{a, b,
+				Vec{math.Min(a.X, b.X), math.Min(a.Y, b.Y)},
+				Vec{math.Max(a.X, b.X), math.Max(a.Y, b.Y)}})
+		}
+	}
+	k := 0
+	for i := range s.edges {
+		e := &s.edges[i]
+		points := []Vec{e.points[0]}
+		for j := 1; j < len(e.points); j, k = j+1, k+1 {
+			sg := &segments[k]
+			ab := sg.b.Sub(sg.a)
+			var ts []float64
+			for l := range segments {
+				o := &segments[l]
+				if l == k || o.max.X < sg.min.X || o.min.X > sg.max.X || o.max.Y < sg.min.Y || o.min.Y > sg.max.Y {
+					continue
+				}
+				cd := o.b.Sub(o.a)
+				den := ab.Cross(cd)
+				if den == 0 {
+					continue
+				}
+				ac := o.a.Sub(sg.a)
+				t, u := ac.Cross(cd)/den, ac.Cross(ab)/den
+				if t > 1e-6 && t < 1-1e-6 && u >= 0 && u <= 1 {
+					ts = append(ts, t)
+				}
+			}
+			sort.Float64s(ts)
+			for _, t := range ts {
+				points = append(points, Lerp(sg.a, sg.b, t))
+			}
+			points = append(points, sg.b)
+		}
+		e.points = points
+		e.inner = make([]bool, len(points)-1)
+		for j := range e.inner {
+			a, b := points[j], points[j+1]
+			d := b.Sub(a)
+			if l := d.Len(); l > 0 {
+				n := d.Normal().Mulf(math.Min(1e-3, l/8) / l)
+				m := Lerp(a, b, 0.5)
+				e.inner[j] = s.winding(m.Add(n)) != 0 && s.winding(m.Sub(n)) != 0
+			}
+		}
+	}
+}
+
+// orient orients the contours with the fill of the shape, probed beside the
+// middle of their longest segment.
+func (s *sdfShape) orient() {
+	for _, c := range s.contours {
+		var a, b Vec
+		for _, e := range s.edges[c[0]:c[1]] {
+			for j := 1; j < len(e.points); j++ {
+				if !e.inner[j-1] && e.points[j].Sub(e.points[j-1]).Len() > b.Sub(a).Len() {
+					a, b = e.points[j-1], e.points[j]
+				}
+			}
+		}
+		orient := 1.0
+		d := b.Sub(a)
+		if l := d.Len(); l > 0 {
+			probe := Lerp(a, b, 0.5).Add(d.Normal().Mulf(math.Min(1e-3, l/8) / l))
+			if s.winding(probe) == 0 {
+				orient = -1
+			}
+		}
+		for i := c[0]; i < c[1]; i++ {
+			s.edges[i].orient = orient
+		}
+	}
+}
+
+func isCornerStart(corners []int, i int) bool {
+	for _, c := range corners {
+		if c == i {
+			return true
+		}
+	}
+	return false
+}
+
+func colorIndex(c uint8) int {
+	for i, v := range sdfColors {
+		if v == c {
+			return i
+		}
+	}
+	return 0
+}
+
+// splitPolyline splits a polyline into n runs of about the same length.
+func splitPolyline(points []Vec, n int) [][]Vec {
+	var length float64
+	for i := 1; i < len(points); i++ {
+		length += points[i].Sub(points[i-1]).Len()
+	}
+	runs := make([][]Vec, 0, n)
+	run := []Vec{points[0]}
+	var d float64
+	for i := 1; i < len(points); i++ {
+		a, b := points[i-1], points[i]
+		l := b.Sub(a).Len()
+		for len(runs) < n-1 && d+l >= length*float64(len(runs)+1)/float64(n) {
+			p := Lerp(a, b, (length*float64(len(runs)+1)/float64(n)-d)/l)
+			runs = append(runs, append(run, p))
+			run = []Vec{p}
+		}
+		run = append(run, b)
+		d += l
+	}
+	return append(runs, run)
+}
+
+// winding returns the nonzero winding number of the shape around p.
+func (s *sdfShape) winding(p Vec) int {
+	w := 0
+	for _, e := range s.edges {
+		for j := 1; j < len(e.points); j++ {
+			a, b := e.points[j-1], e.points[j]
+			if a.Y <= p.Y {
+				if b.Y > p.Y && b.Sub(a).Cross(p.Sub(a)) > 0 {
+					w++
+				}
+			} else if b.Y <= p.Y && b.Sub(a).Cross(p.Sub(a)) < 0 {
+				w--
+			}
+		}
+	}
+	return w
+}
+
+// edgeDistance is the distance from a point to an edge.
+type edgeDistance struct {
+	dist   float64 // unsigned distance
+	orth   float64 // sine of the angle between the edge and the point
+	pseudo float64 // signed, to the tangent line beyond the ends
+}
+
+func (a edgeDistance) less(b edgeDistance) bool {
+	if math.Abs(a.dist-b.dist) > 1e-9 {
+		return a.dist < b.dist
+	}
+	return a.orth > b.orth
+}
+
+// distance returns the distance from p to the closest point of the edge,
+// positive inside the shape.
+func (e *sdfEdge) distance(p Vec) edgeDistance {
+	best := edgeDistance{dist: math.Inf(1)}
+	last := len(e.points) - 2
+	for j := 0; j <= last; j++ {
+		a, b := e.points[j], e.points[j+1]
+		ab := b.Sub(a)
+		if ab == (Vec{}) || e.inner[j] {
+			continue
+		}
+		t := math.Max(0, math.Min(1, p.Sub(a).Dot(ab)/ab.Dot(ab)))
+		q := Lerp(a, b, t)
+		d := p.Sub(q).Len()
+		if d >= best.dist+1e-9 {
+			continue
+		}
+		dir := ab.Unit()
+		switch {
+		case t == 0 && j > 0 && !e.inner[j-1]:
+			dir = dir.Add(e.points[j].Sub(e.points[j-1]).Unit()).Unit()
+		case t == 1 && j < last && !e.inner[j+1]:
+			dir = dir.Add(e.points[j+2].Sub(e.points[j+1]).Unit()).Unit()
+		}
+		cross := dir.Cross(p.Sub(q))
+		ed := edgeDistance{dist: d, pseudo: math.Copysign(d, cross*e.orient)}
+		if d > 0 {
+			ed.orth = math.Abs(cross) / d
+		}
+		if (t == 0 && j == 0) || (t == 1 && j == last) {
+			// beyond an end the distance to the tangent keeps the corners
+			ed.pseudo = dir.Cross(p.Sub(q)) * e.orient
+		}
+		if ed.less(best) {
+			best = ed
+		}
+	}
+	return best
+}
+
+// DrawDistanceField draws the distance field of the filled path p, with
+// the nonzero rule, into the rectangle r of dst. sp is the point of the
+// path at r.Min. Distances of distRange/2 pixels and more are saturated.
+func DrawDistanceField(dst *image.NRGBA, r image.Rectangle, p *Path, sp image.Point, mode DistanceFieldMode, distRange float64) {
+	newSDFShape(p).draw(dst, r, Vec{float64(sp.X), float64(sp.Y)}, mode, distRange)
+}
+
+func (s *sdfShape) draw(dst *image.NRGBA, r image.Rectangle, sp Vec, mode DistanceFieldMode, distRange float64) {
+	r = r.Intersect(dst.Rect)
+	w, h := r.Dx(), r.Dy()
+	field := make([][3]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			p := sp.Add(Vec{float64(x) + 0.5, float64(y) + 0.5})
+			var channels [3]edgeDistance
+			nearest := edgeDistance{dist: math.Inf(1)}
+			for i := range channels {
+				channels[i] = nearest
+			}
+			for i := range s.edges {
+				e := &s.edges[i]
+				d := e.distance(p)
+				if d.less(nearest) {
+					nearest = d
+				}
+				if mode == SDF {
+					continue
+				}
+				for c := range channels {
+					if e.color&(1<<c) != 0 && d.less(channels[c]) {
+						channels[c] = d
+					}
+				}
+			}
+			sd := math.Min(nearest.dist, distRange)
+			if s.winding(p) == 0 {
+				sd = -sd
+			}
+			v := &field[y*w+x]
+			*v = [3]float64{sd, sd, sd}
+			if mode == SDF {
+				continue
+			}
+			rd, gd, bd := channels[0].pseudo, channels[1].pseudo, channels[2].pseudo
+			if m := median(rd, gd, bd); (m > 0) == (sd > 0) && !math.IsInf(channels[0].dist, 1) &&
+				!math.IsInf(channels[1].dist, 1) && !math.IsInf(channels[2].dist, 1) {
+				*v = [3]float64{rd, gd, bd}
+			}
+			// else the channels disagree with the outline, the true
+			// distance is kept
+		}
+	}
+	if mode == MSDF {
+		correctClashes(field, w, h)
+	}
+	for y := 0; y < h; y++ {
+		i := dst.PixOffset(r.Min.X, r.Min.Y+y)
+		for x := 0; x < w; x++ {
+			v := &field[y*w+x]
+			pix := dst.Pix[i : i+4 : i+4]
+			for c := 0; c < 3; c++ {
+				pix[c] = uint8(math.Max(0, math.Min(1, 0.5+v[c]/distRange))*255 + 0.5)
+			}
+			pix[3] = 0xff
+			if mode == SDF {
+				pix[3] = pix[0]
+			}
+			i += 4
+		}
+	}
+}
+
+// correctClashes equalizes the channels of the texels that interpolate
+// with a neighbor to a wrong median, where two channels change by more than
+// the distance between the texels.
+func correctClashes(field [][3]float64, w, h int) {
+	var clashes []int
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			a := &field[y*w+x]
+			if (x > 0 && clash(a, &field[y*w+x-1], 1.001)) ||
+				(x < w-1 && clash(a, &field[y*w+x+1], 1.001)) ||
+				(y > 0 && clash(a, &field[(y-1)*w+x], 1.001)) ||
+				(y < h-1 && clash(a, &field[(y+1)*w+x], 1.001)) {
+				clashes = append(clashes, y*w+x)
+			}
+		}
+	}
+	for _, i := range clashes {
+		m := median(field[i][0], field[i][1], field[i][2])
+		field[i] = [3]float64{m, m, m}
+	}
+}
+
+// clash reports whether texels a and b clash and a is the farther from
+// the outline.
+func clash(a, b *[3]float64, threshold float64) bool {
+	// sort the channels by the difference between the texels
+	a0, a1, a2 := a[0], a[1], a[2]
+	b0, b1, b2 := b[0], b[1], b[2]
+	if math.Abs(b0-a0) < math.Abs(b1-a1) {
+		a0, a1, b0, b1 = a1, a0, b1, b0
+	}
+	if math.Abs(b1-a1) < math.Abs(b2-a2) {
+		a1, a2, b1, b2 = a2, a1, b2, b1
+		if math.Abs(b0-a0) < math.Abs(b1-a1) {
+			a0, a1, b0, b1 = a1, a0, b1, b0
+		}
+	}
+	return math.Abs(b1-a1) >= threshold && !(b0 == b1 && b0 == b2) && math.Abs(a2) >= math.Abs(b2)
+}
+
+func median(a, b, c float64) float64 {
+	return math.Max(math.Min(a, b), math.Min(math.Max(a, b), c))
+}
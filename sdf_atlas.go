@@ -0,0 +1,255 @@
+package canvas
+
+import (
+	"encoding/json"
+	"errors"
+	"image"
+	"math"
+	"sort"
+)
+
+// ErrAtlasFull is returned when a glyph does not fit in an SDFAtlas.
+var ErrAtlasFull = errors.New("atlas is full")
+
+// SDFGlyph is a glyph or a shape of an SDFAtlas. Its cell is the bounds of
+// its outline padded with half of the distance range, in pixels of the
+// atlas with the origin of the outline at (-BearingX, BearingY) in the
+// cell, y down.
+type SDFGlyph struct {
+	Rune     rune    `json:"unicode,omitempty"`
+	Name     string  `json:"name,omitempty"`
+	Advance  float64 `json:"advance"`
+	BearingX float64 `json:"bearingX"` // from the origin to the left of the cell
+	BearingY float64 `json:"bearingY"` // from the baseline up to the top of the cell
+	X        int     `json:"x"`
+	Y        int     `json:"y"`
+	Width    int     `json:"width"`
+	Height   int     `json:"height"`
+	U0       float64 `json:"u0"` // texture coordinates of the cell, v down
+	V0       float64 `json:"v0"`
+	U1       float64 `json:"u1"`
+	V1       float64 `json:"v1"`
+}
+
+// SDFKerning is the kerning of a pair of runes of an SDFAtlas, added to the
+// advance of the first when it is followed by the second.
+type SDFKerning struct {
+	Rune1   rune    `json:"unicode1"`
+	Rune2   rune    `json:"unicode2"`
+	Advance float64 `json:"advance"`
+}
+
+// SDFAtlas packs the distance fields of glyphs and shapes into one image,
+// so that text can be drawn at any scale by a shader: with an SDF the
+// outline is where the alpha crosses 0.5, with an MSDF where the median of
+// the red, green and blue channels does. The atlas marshals to the JSON
+// metrics of its glyphs.
+type SDFAtlas struct {
+	Image      *image.NRGBA      `json:"-"`
+	Mode       DistanceFieldMode `json:"mode"`
+	Range      float64           `json:"distanceRange"` // in pixels
+	Size       float64           `json:"size"`          // em size of the glyphs in pixels
+	Ascent     float64           `json:"ascent"`
+	Descent    float64           `json:"descent"`
+	LineHeight float64           `json:"lineHeight"`
+	Glyphs     []*SDFGlyph       `json:"glyphs"`
+	Kerning    []*SDFKerning     `json:"kerning,omitempty"`
+	shelves    []atlasShelf
+	runes      map[rune]*SDFGlyph
+	kerning    map[[2]rune]*SDFKerning
+}
+
+// atlasShelf is a row of the atlas filled from left to right.
+type atlasShelf struct {
+	y, height, x int
+}
+
+// atlasGap separates the cells so that filtering does not bleed.
+const atlasGap = 1
+
+// NewSDFAtlas returns an empty atlas of width x height pixels. distRange
+// is the distance in pixels covered by the values of the field, from the
+// outline distRange/2 in and out.
+func NewSDFAtlas(width, height int, mode DistanceFieldMode, distRange float64) *SDFAtlas {
+	if distRange <= 0 {
+		distRange = 4
+	}
+	return &SDFAtlas{
+		Image:   image.NewNRGBA(image.Rect(0, 0, width, height)),
+		Mode:    mode,
+		Range:   distRange,
+		runes:   make(map[rune]*SDFGlyph),
+		kerning: make(map[[2]rune]*SDFKerning),
+	}
+}
+
+func (a *SDFAtlas) MarshalJSON() ([]byte, error) {
+	type atlas SDFAtlas
+	b := a.Image.Bounds()
+	return json.Marshal(&struct {
+		Width  int `json:"width"`
+		Height int `json:"height"`
+		*atlas
+	}{b.Dx(), b.Dy(), (*atlas)(a)})
+}
+
+// Glyph returns the glyph of r added by AddText, or nil.
+func (a *SDFAtlas) Glyph(r rune) *SDFGlyph {
+	return a.runes[r]
+}
+
+// Kern returns the kerning of r1 followed by r2, for the pairs of runes of
+// the text given to AddText.
+func (a *SDFAtlas) Kern(r1, r2 rune) float64 {
+	if k := a.kerning[[2]rune{r1, r2}]; k != nil {
+		return k.Advance
+	}
+	return 0
+}
+
+// atlasCell is a shape waiting to be packed.
+type atlasCell struct {
+	glyph *SDFGlyph
+	shape *sdfShape
+	min   image.Point // of the cell in the coordinates of the shape
+}
+
+func (a *SDFAtlas) newCell(g *SDFGlyph, p *Path) *atlasCell {
+	c := &atlasCell{glyph: g, shape: newSDFShape(p)}
+	if len(c.shape.edges) == 0 {
+		return c
+	}
+	pad := math.Ceil(a.Range / 2)
+	c.min = image.Pt(int(math.Floor(c.shape.min.X-pad)), int(math.Floor(c.shape.min.Y-pad)))
+	g.Width = int(math.Ceil(c.shape.max.X+pad)) - c.min.X
+	g.Height = int(math.Ceil(c.shape.max.Y+pad)) - c.min.Y
+	g.BearingX, g.BearingY = float64(c.min.X), -float64(c.min.Y)
+	return c
+}
+
+// AddPath adds the distance field of the filled path p, its origin is
+// (0, 0) and its unit a pixel of the atlas.
+func (a *SDFAtlas) AddPath(name string, p *Path, advance float64) (*SDFGlyph, error) {
+	g := &SDFGlyph{Name: name, Advance: advance}
+	if err := a.add([]*atlasCell{a.newCell(g, p)}); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// AddText adds the glyphs of the runes of text missing from the atlas,
+// looked up through the fallback chain of fnt in db, a nil db is the
+// default font database. The glyphs are set at the point size of fnt in
+// pixels, the first font added sets the size and the metrics of the atlas.
+// Glyphs that do not fit are left out and ErrAtlasFull is returned. The
+// kerning of the pairs of runes of text is added to Kerning, so that the
+// advances of the glyphs with Kern lay out text like FillText.
+func (a *SDFAtlas) AddText(text string, fnt *Font, db *FontDB) error {
+	if db == nil {
+		db = FontDatabase()
+	}
+	if a.Size == 0 && fnt != nil {
+		a.Size = float64(fnt.PointSize)
+		if m, err := NewPath().FontMetricsByDB(fnt, db); err == nil {
+			a.Ascent, a.Descent, a.LineHeight = m.Ascent, m.Descent, m.LineHeight()
+		}
+	}
+	var cells []*atlasCell
+	seen := make(map[rune]bool)
+	for _, r := range text {
+		if a.runes[r] != nil || seen[r] {
+			continue
+		}
+		seen[r] = true
+		// shaped alone, without kerning
+		run := db.ShapeText(string(r), fnt)
+		if len(run.Glyphs) == 0 {
+			continue
+		}
+		p := NewPath()
+		p.AddGlyphs(run, 0, 0)
+		cells = append(cells, a.newCell(&SDFGlyph{Rune: r, Advance: run.Advance()}, p))
+	}
+	err := a.add(cells)
+	a.addKerning(text, fnt, db)
+	return err
+}
+
+// addKerning adds the kerning of the pairs of runes of text in the atlas,
+// the advance of the first rune shaped with the second less its own.
+func (a *SDFAtlas) addKerning(text string, fnt *Font, db *FontDB) {
+	prev := rune(-1)
+	for _, r := range text {
+		pair := [2]rune{prev, r}
+		prev = r
+		g := a.runes[pair[0]]
+		if g == nil || a.runes[r] == nil || a.kerning[pair] != nil {
+			continue
+		}
+		run := db.ShapeText(string(pair[:]), fnt)
+		if len(run.Glyphs) != 2 {
+			continue
+		}
+		if k := run.Glyphs[0].Advance - g.Advance; k != 0 {
+			kern := &SDFKerning{Rune1: pair[0], Rune2: r, Advance: k}
+			a.kerning[pair] = kern
+			a.Kerning = append(a.Kerning, kern)
+		}
+	}
+}
+
+// add packs the cells, the tallest first, and draws their fields.
+func (a *SDFAtlas) add(cells []*atlasCell) error {
+	sort.SliceStable(cells, func(i, j int) bool { return cells[i].glyph.Height > cells[j].glyph.Height })
+	var err error
+	for _, c := range cells {
+		g := c.glyph
+		if g.Width > 0 && g.Height > 0 {
+			pt, ok := a.pack(g.Width, g.Height)
+			if !ok {
+				err = ErrAtlasFull
+				continue
+			}
+			b := a.Image.Bounds()
+			g.X, g.Y = pt.X, pt.Y
+			g.U0, g.V0 = float64(g.X)/float64(b.Dx()), float64(g.Y)/float64(b.Dy())
+			g.U1, g.V1 = float64(g.X+g.Width)/float64(b.Dx()), float64(g.Y+g.Height)/float64(b.Dy())
+			r := image.Rect(g.X, g.Y, g.X+g.Width, g.Y+g.Height)
+			c.shape.draw(a.Image, r, Vec{float64(c.min.X), float64(c.min.Y)}, a.Mode, a.Range)
+		}
+		a.Glyphs = append(a.Glyphs, g)
+		if g.Rune != 0 {
+			a.runes[g.Rune] = g
+		}
+	}
+	return err
+}
+
+// pack places a w x h cell on the shortest shelf it fits, or on a new shelf.
+func (a *SDFAtlas) pack(w, h int) (image.Point, bool) {
+	b := a.Image.Bounds()
+	if w > b.Dx() {
+		return image.Point{}, false
+	}
+	best := -1
+	for i, s := range a.shelves {
+		if h <= s.height && s.x+w <= b.Dx() && (best < 0 || s.height < a.shelves[best].height) {
+			best = i
+		}
+	}
+	if best < 0 {
+		y := 0
+		if n := len(a.shelves); n > 0 {
+			y = a.shelves[n-1].y + a.shelves[n-1].height + atlasGap
+		}
+		if y+h > b.Dy() {
+			return image.Point{}, false
+		}
+		a.shelves = append(a.shelves, atlasShelf{y: y, height: h})
+		best = len(a.shelves) - 1
+	}
+	s := &a.shelves[best]
+	pt := image.Pt(s.x, s.y)
+	s.x += w + atlasGap
+	return pt, true
+}
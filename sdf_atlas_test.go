@@ -0,0 +1,74 @@
+//go:build !nofont
+// +build !nofont
+
+package canvas
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestSDFAtlasAddText(t *testing.T) {
+	db := NewFontDB()
+	if err := db.LoadFontData(withKern(t, goregular.TTF, -400, [2]rune{'A', 'V'})); err != nil {
+		t.Fatal(err)
+	}
+	fnt := &Font{Family: "Go", PointSize: 20}
+	atlas := NewSDFAtlas(256, 256, MSDF, 0)
+	if err := atlas.AddText("AVA V", fnt, db); err != nil {
+		t.Fatal(err)
+	}
+	if err := atlas.AddText("VAV", fnt, db); err != nil {
+		t.Fatal(err)
+	}
+	m, err := db.LoadRawFont(fnt).FontMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if atlas.Size != 20 || atlas.Ascent != m.Ascent || atlas.Descent != m.Descent {
+		t.Errorf("atlas size %v, ascent %v, descent %v", atlas.Size, atlas.Ascent, atlas.Descent)
+	}
+	if len(atlas.Glyphs) != 3 {
+		t.Errorf("atlas has %d glyphs, want A, V and the space", len(atlas.Glyphs))
+	}
+	kern := db.ShapeText("AV", fnt).Advance() - db.ShapeText("A", fnt).Advance() - db.ShapeText("V", fnt).Advance()
+	tests := []struct {
+		r1, r2 rune
+		want   float64
+	}{
+		{'A', 'V', kern},
+		{'V', 'A', 0},
+		{'A', 'A', 0},
+		{'A', 'x', 0},
+	}
+	for _, tt := range tests {
+		if k := atlas.Kern(tt.r1, tt.r2); k != tt.want {
+			t.Errorf("Kern(%q, %q) = %v, want %v", tt.r1, tt.r2, k, tt.want)
+		}
+	}
+	if kern >= 0 || len(atlas.Kerning) != 1 {
+		t.Errorf("kerning of AV %v, %d pairs", kern, len(atlas.Kerning))
+	}
+	for _, r := range "AV " {
+		g := atlas.Glyph(r)
+		if a := db.ShapeText(string(r), fnt).Advance(); g == nil || g.Advance != a {
+			t.Errorf("glyph %q = %+v, want advance %v", r, g, a)
+		}
+	}
+	if g := atlas.Glyph(' '); g.Width != 0 || g.Height != 0 {
+		t.Errorf("space has a cell of %dx%d", g.Width, g.Height)
+	}
+
+	b, err := json.Marshal(atlas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{`"mode":"msdf"`, `"size":20`, `"unicode":65`, `"kerning":[{"unicode1":65,"unicode2":86,`} {
+		if !strings.Contains(string(b), s) {
+			t.Errorf("JSON %s has no %s", b, s)
+		}
+	}
+}
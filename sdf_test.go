@@ -0,0 +1,119 @@
+package canvas
+
+import (
+	"encoding/json"
+	"image"
+	"strings"
+	"testing"
+)
+
+// square returns the path of a square of side size at (x, y).
+func square(x, y, size float64) *Path {
+	p := NewPath()
+	p.MoveTo(x, y)
+	p.LineTo(x+size, y)
+	p.LineTo(x+size, y+size)
+	p.LineTo(x, y+size)
+	p.Close()
+	return p
+}
+
+func TestDrawDistanceField(t *testing.T) {
+	const distRange = 4
+	tests := []struct {
+		name string
+		x, y int
+		want uint8 // 0.5 + distance/distRange, inside positive
+	}{
+		{"center", 20, 20, 0xff},
+		{"far", 0, 0, 0},
+		{"inside the edge", 10, 20, 159},   // 0.5 in
+		{"outside the edge", 9, 20, 96},    // 0.5 out
+		{"inside the corner", 29, 29, 159}, // 0.5 in from two edges
+		{"range", 20, 7, 0},                // 2.5 out, saturated
+		{"in range", 20, 8, 32},            // 1.5 out
+	}
+	for _, mode := range []DistanceFieldMode{SDF, MSDF} {
+		img := image.NewNRGBA(image.Rect(0, 0, 40, 40))
+		DrawDistanceField(img, img.Rect, square(10, 10, 20), image.Point{}, mode, distRange)
+		for _, tt := range tests {
+			c := img.NRGBAAt(tt.x, tt.y)
+			got := c.A
+			if mode == MSDF {
+				got = uint8(median(float64(c.R), float64(c.G), float64(c.B)))
+			}
+			if got != tt.want {
+				t.Errorf("mode %d, %s: %d, want %d", mode, tt.name, got, tt.want)
+			}
+		}
+	}
+
+	// outside a corner the MSDF keeps the square sharp, the SDF rounds it
+	sdf := image.NewNRGBA(image.Rect(0, 0, 40, 40))
+	DrawDistanceField(sdf, sdf.Rect, square(10, 10, 20), image.Point{}, SDF, distRange)
+	msdf := image.NewNRGBA(image.Rect(0, 0, 40, 40))
+	DrawDistanceField(msdf, msdf.Rect, square(10, 10, 20), image.Point{}, MSDF, distRange)
+	c := msdf.NRGBAAt(30, 30)
+	if s, m := sdf.NRGBAAt(30, 30).A, median(float64(c.R), float64(c.G), float64(c.B)); m != 96 || s >= 96 {
+		t.Errorf("outside the corner SDF %d, MSDF %v, want less than 96 and 96", s, m)
+	}
+
+	// the field is drawn in r only, from sp of the path
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 40))
+	DrawDistanceField(img, image.Rect(5, 5, 15, 15), square(10, 10, 20), image.Pt(15, 15), SDF, distRange)
+	if a := img.NRGBAAt(4, 4).A; a != 0 {
+		t.Errorf("outside r: %d", a)
+	}
+	if a := img.NRGBAAt(10, 10).A; a != 0xff {
+		t.Errorf("at 20,20 of the path: %d, want 255", a)
+	}
+}
+
+func TestSDFAtlasAddPath(t *testing.T) {
+	atlas := NewSDFAtlas(64, 32, SDF, 0)
+	tests := []struct {
+		name string
+		size float64
+		x, y int
+		err  error
+	}{
+		// a cell of 10 pixels padded by half of the range of 4
+		{"first", 10, 0, 0, nil},
+		{"next", 10, 15, 0, nil},
+		{"taller", 12, 0, 0, nil}, // on a new shelf
+		{"too large", 70, 0, 0, ErrAtlasFull},
+	}
+	for _, tt := range tests {
+		g, err := atlas.AddPath(tt.name, square(0, 0, tt.size), tt.size)
+		if err != tt.err {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		size := int(tt.size) + 4
+		if g.Width != size || g.Height != size || g.BearingX != -2 || g.BearingY != 2 {
+			t.Errorf("%s: cell %dx%d, bearing %v,%v", tt.name, g.Width, g.Height, g.BearingX, g.BearingY)
+		}
+		if tt.name == "taller" {
+			tt.y = 15
+		}
+		if g.X != tt.x || g.Y != tt.y || g.U1 != float64(g.X+size)/64 || g.V1 != float64(g.Y+size)/32 {
+			t.Errorf("%s: at %d,%d %v,%v, want %d,%d", tt.name, g.X, g.Y, g.U1, g.V1, tt.x, tt.y)
+		}
+		if a := atlas.Image.NRGBAAt(g.X+size/2, g.Y+size/2).A; a != 0xff {
+			t.Errorf("%s: center of the cell %d, want 255", tt.name, a)
+		}
+	}
+
+	b, err := json.Marshal(atlas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{`"width":64`, `"height":32`, `"mode":"sdf"`, `"distanceRange":4`, `"name":"next"`} {
+		if !strings.Contains(string(b), s) {
+			t.Errorf("JSON %s has no %s", b, s)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package canvas
+
+import (
+	"math"
+	"sort"
+)
+
+// baselineOffset returns the offset to add to y to draw text on the
+// alphabetic baseline when y is at the given baseline.
+func baselineOffset(base TextBaseline, m *FontMetrics) float64 {
+	switch base {
+	case AlignTop, AlignHanging:
+		return m.Ascent
+	case AlignMiddle:
+		return m.Ascent/2 - m.Descent/2
+	case AlignIdeographic, AlignBottom:
+		return -m.Descent
+	}
+	return 0
+}
+
+// decorationPaths returns the lines of d for a text of the given width whose
+// alphabetic baseline starts at (x, y). under holds the underline and the
+// overline that are drawn below the text, through the line-through drawn
+// over it. text is the outline of the text used to skip ink, it may be nil.
+func decorationPaths(d *TextDecoration, m *FontMetrics, text *Path, x, y, width float64) (under, through *Path) {
+	if d.Line == DecorationNone || m == nil || width <= 0 {
+		return nil, nil
+	}
+	if d.Line&DecorationUnderline != 0 {
+		t := decorationThickness(d, m.UnderlineThickness)
+		under = appendDecoration(under, d, text, x, y+m.UnderlinePosition, width, t, 1)
+	}
+	if d.Line&DecorationOverline != 0 {
+		t := decorationThickness(d, m.UnderlineThickness)
+		under = appendDecoration(under, d, text, x, y-m.Ascent+t/2, width, t, -1)
+	}
+	if d.Line&DecorationLineThrough != 0 {
+		t := decorationThickness(d, m.StrikeoutThickness)
+		through = appendDecoration(through, d, nil, x, y+m.StrikeoutPosition, width, t, 0)
+	}
+	return
+}
+
+func decorationThickness(d *TextDecoration, t float64) float64 {
+	if d.Thickness > 0 {
+		return d.Thickness
+	}
+	if t <= 0 {
+		return 1
+	}
+	return t
+}
+
+// appendDecoration adds one decoration line centered on cy. dir is the side
+// of the second line of a double decoration, 0 centers both lines on cy.
+func appendDecoration(p *Path, d *TextDecoration, text *Path, x, cy, width, t float64, dir float64) *Path {
+	if p == nil {
+		p = NewPath()
+	}
+	// vertical extent of the decoration around cy
+	lo, hi := cy-t/2, cy+t/2
+	switch d.Style {
+	case DecorationDouble:
+		// the lines are at cy and cy+2t for dir 1, cy-2t and cy for dir -1
+		lo = cy - t/2 + (dir-1)*t
+		hi = lo + 3*t
+	case DecorationWavy:
+		lo, hi = lo-t, hi+t
+	}
+	spans := [][2]float64{{x, x + width}}
+	if d.SkipInk && text != nil {
+		spans = subtractSpans(spans, inkSpans(text, lo-t, hi+t, t))
+	}
+	for _, s := range spans {
+		switch d.Style {
+		case DecorationDouble:
+			p.AddRectangle(s[0], lo, s[1]-s[0], t)
+			p.AddRectangle(s[0], lo+2*t, s[1]-s[0], t)
+		case DecorationDashed:
+			// the dash phase starts at the text origin, not at the span
+			dash, gap := 3*t, 2*t
+			period := dash + gap
+			start := x + math.Floor((s[0]-x)/period)*period
+			for a := start; a < s[1]; a += period {
+				a0, a1 := math.Max(a, s[0]), math.Min(a+dash, s[1])
+				if a1 > a0 {
+					p.AddRectangle(a0, cy-t/2, a1-a0, t)
+				}
+			}
+		case DecorationWavy:
+			addWave(p, x, s[0], s[1], cy, t)
+		default:
+			p.AddRectangle(s[0], cy-t/2, s[1]-s[0], t)
+		}
+	}
+	return p
+}
+
+// addWave adds a sine wave of thickness t between x0 and x1, in phase with
+// a wave starting at x.
+func addWave(p *Path, x, x0, x1, cy, t float64) {
+	amplitude, wavelength := t, 6*t
+	step := wavelength / 16
+	n := int(math.Ceil((x1 - x0) / step))
+	if n < 1 {
+		n = 1
+	}
+	wave := func(i int) (float64, float64) {
+		px := x0 + (x1-x0)*float64(i)/float64(n)
+		return px, cy + amplitude*math.Sin(2*math.Pi*(px-x)/wavelength)
+	}
+	px, py := wave(0)
+	p.MoveTo(px, py-t/2)
+	for i := 1; i <= n; i++ {
+		px, py = wave(i)
+		p.LineTo(px, py-t/2)
+	}
+	for i := n; i >= 0; i-- {
+		px, py = wave(i)
+		p.LineTo(px, py+t/2)
+	}
+	p.Close()
+}
+
+// inkSpans returns the horizontal extents, widened by pad, of the contours
+// of text where they cross the band lo <= y <= hi.
+func inkSpans(text *Path, lo, hi, pad float64) [][2]float64 {
+	ink := &inkFlattener{lo: lo, hi: hi, min: math.Inf(1), max: math.Inf(-1)}
+	Flatten(text, ink, 1)
+	for i := range ink.spans {
+		ink.spans[i][0] -= pad
+		ink.spans[i][1] += pad
+	}
+	return ink.spans
+}
+
+type inkFlattener struct {
+	lo, hi   float64
+	x, y     float64
+	min, max float64
+	spans    [][2]float64
+}
+
+func (f *inkFlattener) MoveTo(x, y float64) {
+	f.End()
+	f.x, f.y = x, y
+}
+
+func (f *inkFlattener) LineTo(x, y float64) {
+	x0, y0 := f.x, f.y
+	f.x, f.y = x, y
+	if (y0 < f.lo && y < f.lo) || (y0 > f.hi && y > f.hi) {
+		return
+	}
+	// clip the segment to the band
+	t0, t1 := 0.0, 1.0
+	if y != y0 {
+		ta, tb := (f.lo-y0)/(y-y0), (f.hi-y0)/(y-y0)
+		if ta > tb {
+			ta, tb = tb, ta
+		}
+		t0, t1 = math.Max(t0, ta), math.Min(t1, tb)
+	}
+	for _, t := range []float64{t0, t1} {
+		px := x0 + (x-x0)*t
+		f.min, f.max = math.Min(f.min, px), math.Max(f.max, px)
+	}
+}
+
+func (f *inkFlattener) LineJoin() {}
+
+func (f *inkFlattener) Close() {}
+
+func (f *inkFlattener) End() {
+	if f.min <= f.max {
+		f.spans = append(f.spans, [2]float64{f.min, f.max})
+	}
+	f.min, f.max = math.Inf(1), math.Inf(-1)
+}
+
+// subtractSpans removes the spans of cut from spans.
+func subtractSpans(spans, cut [][2]float64) [][2]float64 {
+	sort.Slice(cut, func(i, j int) bool { return cut[i][0] < cut[j][0] })
+	for _, c := range cut {
+		var out [][2]float64
+		for _, s := range spans {
+			if c[1] <= s[0] || c[0] >= s[1] {
+				out = append(out, s)
+				continue
+			}
+			if c[0] > s[0] {
+				out = append(out, [2]float64{s[0], c[0]})
+			}
+			if c[1] < s[1] {
+				out = append(out, [2]float64{c[1], s[1]})
+			}
+		}
+		spans = out
+	}
+	return spans
+}
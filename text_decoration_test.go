@@ -0,0 +1,88 @@
+package canvas
+
+import (
+	"math"
+	"testing"
+)
+
+// pathBounds returns the bounds of the points of a path of lines.
+func pathBounds(p *Path) (x0, y0, x1, y1 float64) {
+	x0, y0 = math.Inf(1), math.Inf(1)
+	x1, y1 = math.Inf(-1), math.Inf(-1)
+	for i := 0; i+1 < len(p.Points); i += 2 {
+		x0, x1 = math.Min(x0, p.Points[i]), math.Max(x1, p.Points[i])
+		y0, y1 = math.Min(y0, p.Points[i+1]), math.Max(y1, p.Points[i+1])
+	}
+	return
+}
+
+// subpaths returns the number of subpaths of p.
+func subpaths(p *Path) int {
+	n := 0
+	for _, c := range p.Components {
+		if c == MoveToCmp {
+			n++
+		}
+	}
+	return n
+}
+
+func TestDecorationPaths(t *testing.T) {
+	m := &FontMetrics{
+		Ascent:             10,
+		Descent:            3,
+		UnderlinePosition:  2,
+		UnderlineThickness: 1,
+		StrikeoutPosition:  -4,
+		StrikeoutThickness: 1,
+	}
+	// the outline of a glyph crossing the underline between x 10 and 12
+	glyph := NewPath()
+	glyph.AddRectangle(10, 12, 2, 12)
+	const x, y, width = 5, 20, 28 // the dashes end at x+width
+	tests := []struct {
+		name    string
+		d       TextDecoration
+		through bool    // the line is drawn over the text
+		y0, y1  float64 // vertical extent of the lines
+		n       int     // number of subpaths
+	}{
+		{"underline", TextDecoration{Line: DecorationUnderline}, false, 21.5, 22.5, 1},
+		{"overline", TextDecoration{Line: DecorationOverline}, false, 10, 11, 1},
+		{"line-through", TextDecoration{Line: DecorationLineThrough}, true, 15.5, 16.5, 1},
+		{"thickness", TextDecoration{Line: DecorationUnderline, Thickness: 2}, false, 21, 23, 1},
+		{"double", TextDecoration{Line: DecorationUnderline, Style: DecorationDouble}, false, 21.5, 24.5, 2},
+		{"double overline", TextDecoration{Line: DecorationOverline, Style: DecorationDouble}, false, 8, 11, 2},
+		{"dashed", TextDecoration{Line: DecorationUnderline, Style: DecorationDashed}, false, 21.5, 22.5, 6},
+		{"wavy", TextDecoration{Line: DecorationUnderline, Style: DecorationWavy}, false, 20.5, 23.5, 1},
+		{"skip-ink", TextDecoration{Line: DecorationUnderline, SkipInk: true}, false, 21.5, 22.5, 2},
+	}
+	for _, tt := range tests {
+		under, through := decorationPaths(&tt.d, m, glyph, x, y, width)
+		p, other := under, through
+		if tt.through {
+			p, other = through, under
+		}
+		if p == nil || other != nil {
+			t.Errorf("%s: under %v, through %v", tt.name, under, through)
+			continue
+		}
+		x0, y0, x1, y1 := pathBounds(p)
+		if x0 != x || x1 != x+width || math.Abs(y0-tt.y0) > 0.01 || math.Abs(y1-tt.y1) > 0.01 {
+			t.Errorf("%s: bounds %v,%v %v,%v, want %v,%v %v,%v", tt.name, x0, y0, x1, y1, x, tt.y0, x+width, tt.y1)
+		}
+		if n := subpaths(p); n != tt.n {
+			t.Errorf("%s: %d subpaths, want %d", tt.name, n, tt.n)
+		}
+		if tt.d.SkipInk {
+			for i := 0; i < len(p.Points); i += 2 {
+				if px := p.Points[i]; px > 10 && px < 12 {
+					t.Errorf("%s: line crosses the glyph at x %v", tt.name, px)
+				}
+			}
+		}
+	}
+	if under, through := decorationPaths(&TextDecoration{}, m, nil, x, y, width); under != nil || through != nil {
+		t.Error("no decoration draws lines")
+	}
+}
@@ -0,0 +1,21 @@
+package canvas
+
+// textOnPath returns the outlines of text set along path with fnt, aligned
+// on offset and its baseline on path.
+func textOnPath(text string, path *Path, offset float64, side TextPathSide, align TextAlign, base TextBaseline, fnt *Font, db *FontDB) *Path {
+	p := NewPath()
+	switch align {
+	case AlignRight:
+		offset -= p.MeasureTextByDB(text, fnt, db)
+	case AlignCenter:
+		offset -= p.MeasureTextByDB(text, fnt, db) / 2
+	}
+	var dy float64
+	if base != AlignAlphabetic {
+		if m, err := p.FontMetricsByDB(fnt, db); err == nil {
+			dy = baselineOffset(base, m)
+		}
+	}
+	p.addTextOnPath(text, path, offset, dy, side, fnt, db)
+	return p
+}
@@ -0,0 +1,128 @@
+//go:build !nofont
+// +build !nofont
+
+package canvas
+
+import (
+	"math"
+	"testing"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestPathMeasure(t *testing.T) {
+	corner := NewPath()
+	corner.MoveTo(0, 0)
+	corner.LineTo(30, 0)
+	corner.LineTo(30, 40)
+	gap := NewPath()
+	gap.MoveTo(0, 0)
+	gap.LineTo(10, 0)
+	gap.MoveTo(100, 100)
+	gap.LineTo(100, 110)
+	circle := NewPath()
+	circle.Arc(0, 0, 10, 0, 2*math.Pi, false)
+	tests := []struct {
+		name   string
+		p      *Path
+		length float64
+		d      float64
+		x, y   float64
+		angle  float64
+	}{
+		{"start", corner, 70, 0, 0, 0, 0},
+		{"first line", corner, 70, 10, 10, 0, 0},
+		{"second line", corner, 70, 50, 30, 20, math.Pi / 2},
+		{"before", corner, 70, -5, 0, 0, 0},
+		{"after", corner, 70, 100, 30, 40, math.Pi / 2},
+		{"subpaths", gap, 20, 15, 100, 105, math.Pi / 2},
+		{"empty", NewPath(), 0, 5, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		m := NewPathMeasure(tt.p)
+		if l := m.Length(); math.Abs(l-tt.length) > 1e-9 {
+			t.Errorf("%s: length %v, want %v", tt.name, l, tt.length)
+		}
+		x, y, angle := m.PointAt(tt.d)
+		if math.Abs(x-tt.x) > 1e-9 || math.Abs(y-tt.y) > 1e-9 || math.Abs(angle-tt.angle) > 1e-9 {
+			t.Errorf("%s: PointAt(%v) = %v,%v %v, want %v,%v %v", tt.name, tt.d, x, y, angle, tt.x, tt.y, tt.angle)
+		}
+	}
+	// the flattened circle is a little shorter than the circle
+	if l := NewPathMeasure(circle).Length(); l > 20*math.Pi || l < 20*math.Pi-0.5 {
+		t.Errorf("circle length %v, want about %v", l, 20*math.Pi)
+	}
+}
+
+func TestTextOnPath(t *testing.T) {
+	db := NewFontDB()
+	if err := db.LoadFontData(goregular.TTF); err != nil {
+		t.Fatal(err)
+	}
+	fnt := &Font{Family: "Go", PointSize: 20}
+	const text = "Hello"
+	width := NewPath().MeasureTextByDB(text, fnt, db)
+	horizontal := NewPath()
+	horizontal.AddTextByDB(text, 10, 50, fnt, db)
+	hx0, hy0, hx1, hy1 := pathBounds(horizontal)
+
+	line := NewPath()
+	line.MoveTo(0, 50)
+	line.LineTo(200, 50)
+	down := NewPath()
+	down.MoveTo(50, 0)
+	down.LineTo(50, 200)
+	tests := []struct {
+		name           string
+		path           *Path
+		offset         float64
+		side           TextPathSide
+		x0, y0, x1, y1 float64 // bounds of the outlines
+	}{
+		// along a line the text is set like FillText
+		{"line", line, 10, TextPathLeft, hx0, hy0, hx1, hy1},
+		// the right side follows the line backwards, upside down
+		{"right side", line, 10, TextPathRight, 200 - hx1, 100 - hy1, 200 - hx0, 100 - hy0},
+		// rotated clockwise, the top of the text on the right
+		{"down", down, 10, TextPathLeft, 100 - hy1, hx0, 100 - hy0, hx1},
+	}
+	for _, tt := range tests {
+		p := NewPath()
+		if w := p.AddTextOnPathByDB(text, tt.path, tt.offset, tt.side, fnt, db); math.Abs(w-width) > 1e-9 {
+			t.Errorf("%s: advance %v, want %v", tt.name, w, width)
+		}
+		x0, y0, x1, y1 := pathBounds(p)
+		if math.Abs(x0-tt.x0) > 1e-6 || math.Abs(y0-tt.y0) > 1e-6 || math.Abs(x1-tt.x1) > 1e-6 || math.Abs(y1-tt.y1) > 1e-6 {
+			t.Errorf("%s: bounds %v,%v %v,%v, want %v,%v %v,%v", tt.name, x0, y0, x1, y1, tt.x0, tt.y0, tt.x1, tt.y1)
+		}
+	}
+
+	// glyphs whose middle is off the path are dropped
+	short := NewPath()
+	short.MoveTo(0, 50)
+	short.LineTo(20, 50)
+	p := NewPath()
+	p.AddTextOnPathByDB(text, short, 0, TextPathLeft, fnt, db)
+	if _, _, x1, _ := pathBounds(p); len(p.Points) == 0 || x1 > 30 {
+		t.Errorf("text on a short path ends at %v", x1)
+	}
+	p = NewPath()
+	if p.AddTextOnPathByDB(text, short, 100, TextPathLeft, fnt, db); len(p.Points) != 0 {
+		t.Errorf("text after the end of the path has %d points", len(p.Points))
+	}
+
+	// alignment on the offset
+	for _, tt := range []struct {
+		align TextAlign
+		shift float64
+	}{
+		{AlignLeft, 0},
+		{AlignCenter, -width / 2},
+		{AlignRight, -width},
+	} {
+		p := textOnPath(text, line, 100, TextPathLeft, tt.align, AlignAlphabetic, fnt, db)
+		if x0, _, _, _ := pathBounds(p); math.Abs(x0-(hx0+90+tt.shift)) > 1e-6 {
+			t.Errorf("align %v: starts at %v, want %v", tt.align, x0, hx0+90+tt.shift)
+		}
+	}
+}
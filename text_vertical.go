@@ -0,0 +1,53 @@
+package canvas
+
+// orientation of a character in vertical text, a simplification of the
+// Unicode Vertical_Orientation property (UAX #50).
+const (
+	orientRotated     = iota // rotated 90 degrees clockwise
+	orientUpright            // upright, using a vertical alternate if any
+	orientTransformed        // upright vertical alternate, rotated without one
+)
+
+func verticalOrientation(r rune) int {
+	switch {
+	case r >= 0x3008 && r <= 0x3011, r >= 0x3014 && r <= 0x301F, r == 0x3030,
+		r == 0x30A0, r == 0x30FC, r == 0xFF08, r == 0xFF09, r == 0xFF0D,
+		r >= 0xFF1A && r <= 0xFF1E, r == 0xFF3B, r == 0xFF3D, r == 0xFF3F,
+		r >= 0xFF5B && r <= 0xFF60:
+		// brackets, dashes and the prolonged sound mark
+		return orientTransformed
+	case r >= 0x1100 && r <= 0x11FF, // Hangul Jamo
+		r >= 0x2E80 && r <= 0xA4CF, // CJK radicals to Yi
+		r >= 0xA960 && r <= 0xA97F, // Hangul Jamo extended-A
+		r >= 0xAC00 && r <= 0xD7FF, // Hangul syllables
+		r >= 0xF900 && r <= 0xFAFF, // CJK compatibility ideographs
+		r >= 0xFE10 && r <= 0xFE1F, // vertical forms
+		r >= 0xFE30 && r <= 0xFE4F, // CJK compatibility forms
+		r >= 0xFF01 && r <= 0xFF60, // fullwidth forms
+		r >= 0xFFE0 && r <= 0xFFE6,
+		r >= 0x1F000 && r <= 0x1FAFF, // symbols and emoji
+		r >= 0x20000 && r <= 0x3FFFD: // CJK extensions
+		return orientUpright
+	}
+	return orientRotated
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+// tateChuYokoLen returns the length of the run of digits set horizontally
+// in vertical text starting at i, like CSS text-combine-upright: digits 2.
+func tateChuYokoLen(runes []rune, i int) int {
+	if !isDigit(runes[i]) || (i > 0 && isDigit(runes[i-1])) {
+		return 0
+	}
+	n := 1
+	for i+n < len(runes) && isDigit(runes[i+n]) {
+		n++
+	}
+	if n > 2 {
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,114 @@
+//go:build !nofont
+// +build !nofont
+
+package canvas
+
+import (
+	"math"
+	"testing"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestVerticalOrientation(t *testing.T) {
+	tests := []struct {
+		r    rune
+		want int
+	}{
+		{'a', orientRotated},
+		{'1', orientRotated},
+		{'中', orientUpright},
+		{'あ', orientUpright},
+		{'한', orientUpright},
+		{'！', orientUpright},
+		{'「', orientTransformed},
+		{'ー', orientTransformed},
+		{'（', orientTransformed},
+	}
+	for _, tt := range tests {
+		if got := verticalOrientation(tt.r); got != tt.want {
+			t.Errorf("verticalOrientation(%q) = %d, want %d", tt.r, got, tt.want)
+		}
+	}
+}
+
+func TestTateChuYokoLen(t *testing.T) {
+	tests := []struct {
+		text string
+		i    int
+		want int
+	}{
+		{"第1回", 1, 1},
+		{"第12回", 1, 2},
+		{"第12回", 2, 0},  // inside the run
+		{"第123回", 1, 0}, // too long, rotated
+		{"12", 0, 2},
+		{"a", 0, 0},
+	}
+	for _, tt := range tests {
+		if got := tateChuYokoLen([]rune(tt.text), tt.i); got != tt.want {
+			t.Errorf("tateChuYokoLen(%q, %d) = %d, want %d", tt.text, tt.i, got, tt.want)
+		}
+	}
+}
+
+func TestVerticalText(t *testing.T) {
+	db := NewFontDB()
+	if err := db.LoadFontData(goregular.TTF); err != nil {
+		t.Fatal(err)
+	}
+	fnt := &Font{Family: "Go", PointSize: 20}
+	m, err := db.LoadRawFont(fnt).FontMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	em := m.Ascent + m.Descent
+	width := func(s string) float64 { return NewPath().MeasureTextByDB(s, fnt, db) }
+	tests := []struct {
+		text string
+		want float64 // advance height
+	}{
+		{"abc", width("abc")},      // rotated, advancing by the widths
+		{"12", em},                 // set horizontally in one em
+		{"a12b", width("ab") + em}, // mixed
+		{"123", width("123")},      // too long for tate-chu-yoko
+		{"a 9", width("a ") + em},  // a single digit
+		{"", 0},
+	}
+	const x, y = 50, 10
+	for _, tt := range tests {
+		if h := NewPath().MeasureVerticalTextByDB(tt.text, fnt, db); math.Abs(h-tt.want) > 1e-9 {
+			t.Errorf("MeasureVerticalTextByDB(%q) = %v, want %v", tt.text, h, tt.want)
+		}
+		p := NewPath()
+		if h := p.AddVerticalTextByDB(tt.text, x, y, fnt, db); math.Abs(h-tt.want) > 1e-9 {
+			t.Errorf("AddVerticalTextByDB(%q) = %v, want %v", tt.text, h, tt.want)
+		}
+		if len(p.Points) == 0 {
+			continue
+		}
+		// the glyphs stay in the em box centered on x, between y and the advance
+		x0, y0, x1, y1 := pathBounds(p)
+		if x0 < x-em/2 || x1 > x+em/2 || y0 < y-1 || y1 > y+tt.want+1 {
+			t.Errorf("AddVerticalTextByDB(%q) bounds %v,%v %v,%v", tt.text, x0, y0, x1, y1)
+		}
+	}
+
+	gc := NewGraphicContext2DWithFonts(100, 100, db)
+	gc.SetFont(fnt)
+	gc.SetWritingMode(VerticalRL)
+	if h := gc.MeasureText("a12b"); math.Abs(h-width("ab")-em) > 1e-9 {
+		t.Errorf("MeasureText in %v = %v, want %v", gc.WritingMode(), h, width("ab")+em)
+	}
+}
+
+func TestParserWritingMode(t *testing.T) {
+	for _, m := range []WritingMode{HorizontalTB, VerticalRL, VerticalLR} {
+		if got := ParserWritingMode(m.String()); got != m {
+			t.Errorf("ParserWritingMode(%q) = %v", m.String(), got)
+		}
+	}
+	if m := ParserWritingMode("sideways-rl"); m != HorizontalTB || m.IsVertical() {
+		t.Errorf("ParserWritingMode(sideways-rl) = %v", m)
+	}
+}